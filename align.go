@@ -35,7 +35,8 @@ func (self Align) Vert() Align { return alignVertBits & self }
 
 // Returns the horizontal component of the align. If the
 // align is valid and [Align.HasHorzComponent]() is true,
-// the result can only be [Left], [HorzCenter] or [Right].
+// the result can only be [Left], [HorzCenter], [Right],
+// [Justify] or [HorzNeutral].
 func (self Align) Horz() Align { return alignHorzBits & self }
 
 // Returns whether the vertical component of the align is set.
@@ -65,12 +66,12 @@ func (self Align) Adjusted(align Align) Align {
 }
 
 // Returns a value between 'left' and 'right' based on the current horizontal align:
-//  - [Left]: the function returns 'left'.
+//  - [Left], [Justify] or [HorzNeutral]: the function returns 'left'.
 //  - [Right]: the function returns 'right'.
 //  - Otherwise: the function returns the middle point between 'left' and 'right'.
 func (self Align) GetHorzAnchor(left, right int) int {
 	switch self.Horz() {
-	case Left  : return left
+	case Left, Justify, HorzNeutral : return left
 	case Right : return right
 	default: // assume horz center even when undefined
 		return (left + right) >> 1
@@ -110,6 +111,8 @@ func (self Align) horzString() string {
 	case Left: return "Left"
 	case HorzCenter: return "HorzCenter"
 	case Right: return "Right"
+	case Justify: return "Justify"
+	case HorzNeutral: return "HorzNeutral"
 	default:
 		return "HorzUnknown"
 	}
@@ -122,15 +125,35 @@ func (self Align) horzString() string {
 // bitwise operations and use [Align.Vert]() and [Align.Horz]()
 // instead.
 //
-// Note: LastBaseline is undefined for [Vertical] rendering
-// and will panic.
+// For [Vertical] text, VertCenter, Bottom and LastBaseline
+// are applied to each line (column) independently, with
+// LastBaseline referring to the baseline of the last glyph
+// of each column.
+//
+// Justify behaves like Left, but lines broken by line wrapping
+// (see [Renderer.DrawWithWrap]()) are stretched to fill the whole
+// wrap length. See [Justify] for further details.
 const (
 	// Horizontal aligns
 	Left       Align = 0b0010_0000
 	HorzCenter Align = 0b0100_0000
 	Right      Align = 0b1000_0000
-	// TODO: a neutral align might be relevant for vertical text (HorzNeutral, acts as Left on
-	//       any direction that's not Vertical?)
+
+	// Justify spreads the leftover width of wrapped lines across their
+	// spaces (glyphs that can be elided on line wrapping), in whole
+	// pixels. Extra pixels that can't be spread evenly go to the first
+	// spaces of the line. The last line of each paragraph, lines without
+	// spaces and [Vertical] text are aligned as with [Left] instead
+	// ([Right] for the [RightToLeft] direction).
+	// See also [RendererAdvanced.SetJustifyInterspacingEnabled]().
+	Justify    Align = 0b0001_0000
+
+	// HorzNeutral acts as [Left] for all directions except [Vertical],
+	// where the x coordinate is interpreted as the horizontal center of
+	// the first line (column) instead of a side of the text box, and
+	// [RightToLeft], where it acts as [Right]. This keeps glyphs at the
+	// same position regardless of the text width and [BoundingMode].
+	HorzNeutral Align = 0b0011_0000
 
 	// Vertical aligns
 	Top          Align = 0b0000_0001 // top of font's ascent
@@ -0,0 +1,183 @@
+package ptxt
+
+import "unicode"
+
+// Bidirectional character types, as defined by the Unicode
+// Bidirectional Algorithm (UAX #9). Explicit embeddings, overrides
+// and isolates are not supported, and their formatting characters
+// are classified as boundary neutrals.
+type bidiClass uint8
+const (
+	bidiL bidiClass = iota // left to right
+	bidiR // right to left
+	bidiAL // arabic letter
+	bidiEN // european number
+	bidiES // european separator
+	bidiET // european terminator
+	bidiAN // arabic number
+	bidiCS // common separator
+	bidiNSM // nonspacing mark
+	bidiBN // boundary neutral
+	bidiB // paragraph separator
+	bidiS // segment separator
+	bidiWS // whitespace
+	bidiON // other neutral
+)
+
+// Returns whether the class is a neutral or separator for the
+// purposes of rules N1 and N2.
+func (self bidiClass) isNeutral() bool {
+	return self == bidiB || self == bidiS || self == bidiWS || self == bidiON
+}
+
+// Returns the bidi class of the given code point. The classification
+// covers the ranges relevant for common scripts, but it's not an
+// exhaustive implementation of the Unicode character database.
+func getBidiClass(codePoint rune) bidiClass {
+	if codePoint < 0x80 { return getAsciiBidiClass(codePoint) }
+
+	switch codePoint {
+	case 0x0085, 0x2029:
+		return bidiB
+	case 0x2028:
+		return bidiWS
+	case 0x00A0, 0x060C, 0x202F, 0x2044, 0xFE50, 0xFE52, 0xFE55, 0xFF0C, 0xFF0E, 0xFF0F, 0xFF1A:
+		return bidiCS
+	case 0x00B2, 0x00B3, 0x00B9, 0x2070:
+		return bidiEN
+	case 0x00B0, 0x00B1, 0x0609, 0x060A, 0x066A, 0x212E, 0x2213, 0xFE5F, 0xFE69, 0xFE6A, 0xFFE0, 0xFFE1, 0xFFE5, 0xFFE6:
+		return bidiET
+	case 0x207A, 0x207B, 0x208A, 0x208B, 0x2212, 0xFB29, 0xFE62, 0xFE63, 0xFF0B, 0xFF0D:
+		return bidiES
+	case 0x066B, 0x066C, 0x06DD, 0x08E2:
+		return bidiAN
+	case 0x200E: // left-to-right mark
+		return bidiL
+	case 0x200F: // right-to-left mark
+		return bidiR
+	case 0x061C: // arabic letter mark
+		return bidiAL
+	}
+
+	switch {
+	case codePoint < 0xA0:
+		return bidiBN // C1 controls
+	case codePoint >= 0x00A2 && codePoint <= 0x00A5:
+		return bidiET
+	case codePoint >= 0x0600 && codePoint <= 0x0605:
+		return bidiAN
+	case codePoint >= 0x0660 && codePoint <= 0x0669:
+		return bidiAN
+	case codePoint >= 0x10E60 && codePoint <= 0x10E7E:
+		return bidiAN
+	case codePoint >= 0x06F0 && codePoint <= 0x06F9:
+		return bidiEN
+	case codePoint >= 0x2074 && codePoint <= 0x2079:
+		return bidiEN
+	case codePoint >= 0x2080 && codePoint <= 0x2089:
+		return bidiEN
+	case codePoint >= 0x2488 && codePoint <= 0x249B:
+		return bidiEN
+	case codePoint >= 0xFF10 && codePoint <= 0xFF19:
+		return bidiEN
+	case codePoint >= 0x1D7CE && codePoint <= 0x1D7FF:
+		return bidiEN
+	case codePoint >= 0x2030 && codePoint <= 0x2034:
+		return bidiET
+	case codePoint >= 0x20A0 && codePoint <= 0x20CF:
+		return bidiET
+	case codePoint >= 0xFF03 && codePoint <= 0xFF05:
+		return bidiET
+	case unicode.In(codePoint, unicode.Mn, unicode.Me):
+		return bidiNSM
+	case unicode.Is(unicode.Cf, codePoint):
+		return bidiBN
+	case isArabicLetterRange(codePoint):
+		return bidiAL
+	case isRightToLeftRange(codePoint):
+		return bidiR
+	case unicode.Is(unicode.Zs, codePoint):
+		return bidiWS
+	case unicode.In(codePoint, unicode.P, unicode.S, unicode.No):
+		return bidiON
+	default:
+		return bidiL
+	}
+}
+
+func getAsciiBidiClass(codePoint rune) bidiClass {
+	switch {
+	case codePoint >= '0' && codePoint <= '9':
+		return bidiEN
+	case codePoint >= 'a' && codePoint <= 'z', codePoint >= 'A' && codePoint <= 'Z':
+		return bidiL
+	}
+	switch codePoint {
+	case '+', '-': return bidiES
+	case '#', '$', '%': return bidiET
+	case ',', '.', '/', ':': return bidiCS
+	case '\t', 0x0B, 0x1F: return bidiS
+	case '\n', '\r', 0x1C, 0x1D, 0x1E: return bidiB
+	case ' ', 0x0C: return bidiWS
+	}
+	if codePoint < 0x20 || codePoint == 0x7F { return bidiBN }
+	return bidiON
+}
+
+func isArabicLetterRange(codePoint rune) bool {
+	switch {
+	case codePoint >= 0x0600 && codePoint <= 0x07BF: return true // arabic, syriac, thaana
+	case codePoint >= 0x0860 && codePoint <= 0x08FF: return true // syriac sup., arabic ext.
+	case codePoint >= 0xFB50 && codePoint <= 0xFDFF: return true // arabic presentation forms-a
+	case codePoint >= 0xFE70 && codePoint <= 0xFEFF: return true // arabic presentation forms-b
+	case codePoint >= 0x10D00 && codePoint <= 0x10D3F: return true // hanifi rohingya
+	case codePoint >= 0x10F30 && codePoint <= 0x10F6F: return true // sogdian
+	case codePoint >= 0x1EC70 && codePoint <= 0x1ECBF: return true // indic siyaq numbers
+	case codePoint >= 0x1ED00 && codePoint <= 0x1ED4F: return true // ottoman siyaq numbers
+	case codePoint >= 0x1EE00 && codePoint <= 0x1EEFF: return true // arabic math symbols
+	default:
+		return false
+	}
+}
+
+func isRightToLeftRange(codePoint rune) bool {
+	switch {
+	case codePoint >= 0x0590 && codePoint <= 0x05FF: return true // hebrew
+	case codePoint >= 0x07C0 && codePoint <= 0x085F: return true // nko, samaritan, mandaic
+	case codePoint >= 0xFB1D && codePoint <= 0xFB4F: return true // hebrew presentation forms
+	case codePoint >= 0x10800 && codePoint <= 0x10FFF: return true
+	case codePoint >= 0x1E800 && codePoint <= 0x1EFFF: return true
+	default:
+		return false
+	}
+}
+
+// Returns the mirrored code point for paired brackets and similar
+// characters, which are displayed mirrored in right-to-left runs, or
+// false if the code point has no mirror.
+func getBidiMirror(codePoint rune) (rune, bool) {
+	switch codePoint {
+	case '(': return ')', true
+	case ')': return '(', true
+	case '<': return '>', true
+	case '>': return '<', true
+	case '[': return ']', true
+	case ']': return '[', true
+	case '{': return '}', true
+	case '}': return '{', true
+	case '«': return '»', true
+	case '»': return '«', true
+	case '‹': return '›', true
+	case '›': return '‹', true
+	case '⁅': return '⁆', true
+	case '⁆': return '⁅', true
+	case '≤': return '≥', true
+	case '≥': return '≤', true
+	case '⟨': return '⟩', true
+	case '⟩': return '⟨', true
+	case '「': return '」', true
+	case '」': return '「', true
+	default:
+		return codePoint, false
+	}
+}
@@ -3,13 +3,23 @@ package ptxt
 import "strconv"
 
 // Determines the main direction of the text. See [Renderer.SetDirection]().
+//
+// [Horizontal] and [RightToLeft] text containing right-to-left scripts
+// (e.g. Hebrew or Arabic) is reordered line by line following the
+// Unicode Bidirectional Algorithm, with the direction as the paragraph
+// direction. Line wrapping still happens at logical positions, and
+// numbers within right-to-left text keep their left-to-right order.
+// Explicit embeddings, overrides and isolates are not supported, and
+// tab stops are always measured from the left side of the line. Bidi
+// reordering is not applied to twines or other directions.
 type Direction uint8
 
 const (
 	Horizontal Direction = iota // left to right
-	Vertical // [UNIMPLEMENTED] vertical, lines going LTR. font needs vert layout
+	Vertical // vertical, lines going LTR. font needs vert layout
 	Sideways // sideways, glyph tops on the left side, bottom to top
 	SidewaysRight // sideways, glyph tops on the right side, top to bottom
+	RightToLeft // horizontal, right to left, mixed runs reordered (bidi)
 )
 
 // Returns a textual representation of the direction.
@@ -19,6 +29,7 @@ func (self Direction) String() string {
 	case Vertical: return "Vertical"
 	case Sideways: return "Sideways"
 	case SidewaysRight: return "SidewaysRight"
+	case RightToLeft: return "RightToLeft"
 	default:
 		return "DirectionInvalid#" + strconv.Itoa(int(self))
 	}
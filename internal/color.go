@@ -10,3 +10,12 @@ func RGBAToFloat32(rgba color.RGBA) [4]float32 {
 		float32(rgba.A)/255,
 	}
 }
+
+func Float32ToRGBA(rgba [4]float32) color.RGBA {
+	return color.RGBA{
+		uint8(rgba[0]*255 + 0.5),
+		uint8(rgba[1]*255 + 0.5),
+		uint8(rgba[2]*255 + 0.5),
+		uint8(rgba[3]*255 + 0.5),
+	}
+}
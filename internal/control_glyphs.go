@@ -5,4 +5,18 @@ import "github.com/tinne26/ggfnt"
 const (
 	MissingSpaceGlyph ggfnt.GlyphIndex = 57000 + iota
 	TwineEffectMarkerGlyph
+	NotdefGlyph // standard notdef box, see GlyphMissEmptyRect
+	FallbackGlyph // marks the previous glyph as coming from a fallback strand, followed by the fallback index
+	SoftHyphenGlyph // hyphenation point, see ptxt.Hyphenator
+	TabGlyph // '\t' on fonts that don't map it, see ptxt.RendererAdvanced.SetTabStops
+)
+
+// Glyph miss policies, shared by ptxt and ptxt/strand.
+// See ptxt.GlyphMissPolicy for the exported version.
+const (
+	GlyphMissPanic uint8 = iota
+	GlyphMissSkip
+	GlyphMissNotdef
+	GlyphMissEmptyRect
+	GlyphMissTryUppercase uint8 = 0b1000_0000 // flag
 )
@@ -0,0 +1,65 @@
+package ptxt
+
+import "image"
+
+import "github.com/tinne26/ptxt/internal"
+
+import "github.com/tinne26/ggfnt"
+
+// Helpers for the standard notdef glyph, which can be used on
+// glyph misses (see GlyphMissEmptyRect). This glyph doesn't exist
+// on the fonts, so whenever we need glyph metrics or masks we must
+// go through the functions defined here.
+
+// Returns whether the glyph index is a font glyph or the standard notdef.
+func isDrawableGlyph(glyphIndex ggfnt.GlyphIndex) bool {
+	return glyphIndex < ggfnt.MaxGlyphs || glyphIndex == internal.NotdefGlyph
+}
+
+// Unscaled advance, like font.Glyphs().Advance(), but also valid
+// for the standard notdef glyph.
+func glyphAdvance(font *ggfnt.Font, glyphIndex ggfnt.GlyphIndex) int {
+	if glyphIndex == internal.NotdefGlyph {
+		width, _ := notdefSize(font)
+		return width
+	}
+	return int(font.Glyphs().Advance(glyphIndex))
+}
+
+// Like font.Glyphs().Placement(), but also valid for the standard
+// notdef glyph.
+func glyphPlacement(font *ggfnt.Font, glyphIndex ggfnt.GlyphIndex) ggfnt.GlyphPlacement {
+	if glyphIndex == internal.NotdefGlyph {
+		width, height := notdefSize(font)
+		return ggfnt.GlyphPlacement{
+			Advance: uint8(width),
+			TopAdvance: uint8(height),
+			HorzCenter: uint8(width >> 1),
+		}
+	}
+	return font.Glyphs().Placement(glyphIndex)
+}
+
+// Returns the unscaled width and height of the standard notdef
+// glyph for the given font. The glyph sits on the baseline.
+func notdefSize(font *ggfnt.Font) (int, int) {
+	height := int(font.Metrics().UppercaseAscent())
+	if height == 0 { height = int(font.Metrics().Ascent()) }
+	height = max(height, 3)
+	return max((height + 1) >> 1, 3), height
+}
+
+// Creates the mask for the standard notdef glyph: a hollow
+// rectangle covering the whole glyph advance.
+func rasterizeNotdefMask(font *ggfnt.Font) *image.Alpha {
+	width, height := notdefSize(font)
+	mask := image.NewAlpha(image.Rect(0, -height, width, 0))
+	for y := -height; y < 0; y++ {
+		for x := 0; x < width; x++ {
+			if y == -height || y == -1 || x == 0 || x == width - 1 {
+				mask.Pix[mask.PixOffset(x, y)] = 255
+			}
+		}
+	}
+	return mask
+}
@@ -33,40 +33,84 @@ type Renderer struct {
 	direction Direction
 	scale uint8
 	strandIndex StrandIndex
+	fallbackStrand *strand.Strand // only set while processing fallback glyphs
+	layoutStrands []*strand.Strand // main strand and fallbacks, only set while drawing a TextLayout
 	boundingMode BoundingMode
+	glyphMissPolicy GlyphMissPolicy
 	parBreakEnabled bool
+	justifyInterspacing bool
+	ellipsis string
+	hyphenator Hyphenator
+	tabSpaces int
+	tabStops []TabStop
+	revealLimit int // negative if unlimited
 	
 	blendMode core.BlendMode
 	fallbackMainDye color.RGBA // for strands with inactive main dye
 	
 	drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)
 	drawPassListener func(*Renderer, DrawPass)
+	glyphLayoutFn func(int, GlyphLayout) // only set during Renderer.eachGlyphLayout()
+	twineOperator twineOperator
+	twineFuncs []any // registered twine functions, indexed by TwineFuncID
+	twineTick uint64
+	layoutCache layoutCache
 	
 	// operation buffers
-	run struct {
-		// measurings based on (0, 0) origin
-		left int // can only be non-zero on mask bounding
-		right int
-		top int
-		bottom int
-		
-		// main run data
-		// NOTE: for sanity and safety, slices can't exceed 32k elements in size.
-		//       this is checked while we generate the slices and so on.
-		glyphIndices []ggfnt.GlyphIndex // for twine measuring and drawing, already on the relevant font
-		lineLengths []uint16
-		advances []uint16 // for measuring and drawing, already scaled
-		horzShifts []uint16 // for vertical measuring and drawing, already scaled
-		kernings []int16 // for measuring and drawing, already scaled (int16 is such a waste...)
-		wrapIndices []uint16 // indices before which we append wrap line breaks
-		                     // (top bit [0x8000] used as replace bit flag [0x7FFF for value])
-		// NOTE: (we could probably join advances + kernings into a single int16?)
-
-		// aux data for some specific use-cases
-		firstRowAscent int // we need this for reused draws. already scaled
-		lastRowDescent int // "row" is equivalent to "line" for all aligns except Vertical
-		isMultiline bool // necessary for LastBaseline align
-	}
+	run textRun
+}
+
+// Glyph run and layout data for measuring and drawing operations.
+// Renderers keep the data for the last operation, and [TextLayout]
+// objects keep their own copy.
+type textRun struct {
+	// measurings based on (0, 0) origin
+	left int // can only be non-zero on mask bounding
+	right int
+	top int
+	bottom int
+	
+	// main run data
+	// NOTE: for sanity and safety, slices can't exceed 32k elements in size.
+	//       this is checked while we generate the slices and so on.
+	glyphIndices []ggfnt.GlyphIndex // for twine measuring and drawing, already on the relevant font
+	glyphSources []uint32 // source text or twine contents byte offsets for each glyph index
+	runeOffsets []uint32 // aux buffer for glyphSources
+	sourceLen int // source text or twine contents length in bytes
+	lineLengths []uint16
+	lineIndents []uint16 // for twines with padders or line restart markers. included in lineLengths
+	lineLefts []int // start of each line's lineLengths (only non-zero for mask bounding), already scaled
+	advances []uint16 // for measuring and drawing, already scaled
+	horzShifts []uint16 // for vertical measuring and drawing, already scaled
+	kernings []int16 // for measuring and drawing, already scaled (int16 is such a waste...)
+	wrapIndices []uint16 // indices before which we append wrap line breaks
+	                     // (top bit [0x8000] used as replace bit flag [0x7FFF for value])
+	lineAdvances []int // line break advances, already scaled (last baseline of each line for Vertical)
+	twineContents []byte // nil unless the run comes from a twine
+	twineStrands []*strand.Strand // strands with active glyph picker passes for the twine
+	twineGfxFlags uint8 // whether the twine has gfx effects (twineGfxBackFlag, twineGfxFrontFlag)
+	twineGfxSpans []drawGfxSpan // buffer for drawGfxTempVariables
+	// NOTE: (we could probably join advances + kernings into a single int16?)
+
+	// aux data for some specific use-cases
+	firstRowAscent int // we need this for reused draws. already scaled
+	lastRowDescent int // "row" is equivalent to "line" for all aligns except Vertical
+	isMultiline bool // necessary for LastBaseline align
+	caretStops []caretStop // aux buffer for caret positioning and hit-testing
+	justifyPoints []uint16 // aux buffer for Justify align
+	limitCuts []limitCut // aux buffer for Renderer.DrawWithLimits() and similar
+	pageLines []pageLine // aux buffer for Renderer.AppendPages() and similar
+	ruleBreaks []bool // whether wrap rules allow wrapping before each glyph (empty if no rules apply)
+	hyphenWord []byte // aux buffer for renderer.insertSoftHyphens()
+	hyphenRunes []hyphenRune // aux buffer for renderer.insertSoftHyphens()
+	hyphenSplits []int // aux buffer for renderer.insertSoftHyphens()
+	hyphenInserts []uint16 // aux buffer for renderer.insertSoftHyphens()
+	hyphenWraps []uint16 // indices of the soft hyphens where lines have been wrapped
+	bidiLevels []uint8 // bidi embedding level of each glyph (empty if no reordering is needed)
+	bidiClasses []bidiClass // aux buffer for renderer.computeBidiLevels()
+	bidiSequence []int // aux buffer for renderer.resolveBidiParagraph()
+	bidiCells []bidiCell // aux buffer for renderer.computeBidiPositions()
+	bidiPositions []int // visual x of each glyph relative to its line start, already scaled (empty if no reordering is needed)
 }
 
 // Creates a new [Renderer] with the following defaults:
@@ -75,6 +119,10 @@ type Renderer struct {
 //  - Bounding mode set to [LogicalBounding].
 //  - Align set to (ptxt.[Left] | ptxt.[Baseline]).
 //  - Fallback main dye color set to white.
+//  - Glyph miss policy set to [GlyphMissPanic].
+//  - No reveal limit (see [RendererAdvanced.SetRevealLimit]()).
+//  - Ellipsis set to "..." (see [RendererAdvanced.SetEllipsis]()).
+//  - Tab spaces set to 4 (see [RendererAdvanced.SetTabSpaces]()).
 //
 // Beyond these properties, you must still set a font [*strand.Strand]
 // through [Renderer.SetStrand]() before being able to operate with 
@@ -87,6 +135,9 @@ func NewRenderer() *Renderer {
 	renderer.scale = 1
 	renderer.boundingMode = LogicalBounding
 	renderer.fallbackMainDye = color.RGBA{255, 255, 255, 255}
+	renderer.revealLimit = -1
+	renderer.ellipsis = "..."
+	renderer.tabSpaces = 4
 	return &renderer
 }
 
@@ -208,7 +259,12 @@ func (self *Renderer) GetScale() uint8 {
 // Returns the currently active font [*strand.Strand]. Shorthand for:
 //   index := renderer.Strands().Index()
 //   return renderer.Strands().Get(index)
+// The only exception happens within custom draw functions, where the
+// fallback strand is returned for glyphs coming from fallbacks (see
+// [strand.StrandMapping.SetFallbacks]()).
 func (self *Renderer) Strand() *strand.Strand {
+	if self.fallbackStrand != nil { return self.fallbackStrand }
+	if self.layoutStrands != nil { return self.layoutStrands[0] }
 	return self.strands[self.strandIndex]
 }
 
@@ -237,26 +293,27 @@ func (self *Renderer) Draw(target core.Target, text string, x, y int) {
 //
 // Text can't exceed 32k glyphs.
 func (self *Renderer) DrawWithWrap(target core.Target, text string, x, y int, maxLineLen int) {
-	// convert the input from code points to glyphs
-	// (this includes rewrite rules and glyph selection)
 	if self.Strand() == nil {
 		panic("ptxt.Renderer can't operate with a nil strand... maybe someone forgot to Renderer.SetStrand()?")
 	}
 
+	// reuse cached layout if possible
+	cacheKey, cacheable := self.layoutCacheKey(text, maxLineLen)
+	if cacheable && self.loadCachedLayout(cacheKey) {
+		self.drawFromBuffer(target, x, y)
+		return
+	}
+
+	// convert the input from code points to glyphs
+	// (this includes rewrite rules and glyph selection)
 	mapping := self.Strand().Mapping()
-	err := lnkBeginPass(mapping, strand.DrawPass)
+	err := lnkBeginPass(mapping, strand.DrawPass, uint8(self.glyphMissPolicy))
 	if err != nil { panic(err) }
-	self.run.glyphIndices = self.run.glyphIndices[ : 0]
-	for _, codePoint := range text {
-		self.run.glyphIndices = lnkAppendCodePoint(mapping, codePoint, self.run.glyphIndices)
-		if len(self.run.glyphIndices) > 32000 {
-			panic("text run exceeding 32k glyph indices")
-		}
-	}
-	self.run.glyphIndices = lnkFinishMapping(mapping, self.run.glyphIndices)
+	self.textToGlyphs(mapping, text)
 	
 	// compute text advances and metrics
 	self.computeRunLayout(maxLineLen)
+	if cacheable { self.storeCachedLayout(cacheKey) }
 
 	// determine text baseline origin (x matters if text is vertical or sideways)
 	x, y = self.computeTextOrigin(x, y)
@@ -312,24 +369,67 @@ func (self *Renderer) MeasureWithWrap(text string, maxLineLen int) (width, heigh
 		panic("ptxt.Renderer can't operate with a nil strand... maybe someone forgot to Renderer.SetStrand()?")
 	}
 
+	// reuse cached layout if possible
+	cacheKey, cacheable := self.layoutCacheKey(text, maxLineLen)
+	if cacheable && self.loadCachedLayout(cacheKey) {
+		return self.run.right - self.run.left, self.run.bottom - self.run.top
+	}
+
 	// convert the input from code points to glyphs
 	// (this includes rewrite rules and glyph selection)
 	mapping := self.Strand().Mapping()
-	err := lnkBeginPass(mapping, strand.MeasurePass)
+	err := lnkBeginPass(mapping, strand.MeasurePass, uint8(self.glyphMissPolicy))
 	if err != nil { panic(err) }
+	self.textToGlyphs(mapping, text)
+
+	// get text bounding box and advances
+	self.computeRunLayout(maxLineLen)
+	if cacheable { self.storeCachedLayout(cacheKey) }
+
+	// cleanup and return
+	lnkFinishPass(mapping, strand.MeasurePass)
+	return self.run.right - self.run.left, self.run.bottom - self.run.top
+}
+
+// Converts the text to glyph indices, also recording the source byte
+// offset of each glyph in renderer.run.glyphSources.
+//
+// Rewrite rules can replace multiple runes with one or more glyphs,
+// so glyphs are matched to runes based on the inputs consumed by the
+// rule testers at each step. Glyphs resulting from a replacement get
+// the offset of the first rune in the replaced sequence.
+func (self *Renderer) textToGlyphs(mapping *strand.StrandMapping, text string) {
 	self.run.glyphIndices = self.run.glyphIndices[ : 0]
-	for _, codePoint := range text {
+	self.run.glyphSources = self.run.glyphSources[ : 0]
+	self.run.runeOffsets  = self.run.runeOffsets[ : 0]
+	self.run.sourceLen = len(text)
+	self.run.twineContents = nil
+	var consumed int
+	for offset, codePoint := range text {
+		self.run.runeOffsets = append(self.run.runeOffsets, uint32(offset))
 		self.run.glyphIndices = lnkAppendCodePoint(mapping, codePoint, self.run.glyphIndices)
 		if len(self.run.glyphIndices) > 32000 {
 			panic("text run exceeding 32k glyph indices")
 		}
+		consumed = self.appendGlyphSources(consumed, len(self.run.runeOffsets) - lnkNumPendingInputs(mapping))
 	}
 	self.run.glyphIndices = lnkFinishMapping(mapping, self.run.glyphIndices)
+	_ = self.appendGlyphSources(consumed, len(self.run.runeOffsets))
+	self.insertSoftHyphens(textRuneAt(text))
+	self.computeRuleBreaks(textRuneAt(text))
+	self.computeBidiLevels(textRuneAt(text))
+}
 
-	// get text bounding box and advances
-	self.computeRunLayout(maxLineLen)
-
-	// cleanup and return
-	lnkFinishPass(mapping, strand.MeasurePass)
-	return self.run.right - self.run.left, self.run.bottom - self.run.top
+// Appends the glyph sources for the glyphs added since the last call,
+// which must come from the runes in [from, to). Returns the new number
+// of consumed runes.
+func (self *Renderer) appendGlyphSources(from, to int) int {
+	to = max(from, to)
+	start := len(self.run.glyphSources)
+	for i := start; i < len(self.run.glyphIndices); i++ {
+		runeIndex := from + min(i - start, to - from - 1)
+		runeIndex = clamp(runeIndex, 0, len(self.run.runeOffsets) - 1)
+		self.run.glyphSources = append(self.run.glyphSources, self.run.runeOffsets[runeIndex])
+	}
+	return to
 }
@@ -1,5 +1,6 @@
 package ptxt
 
+import "image"
 import "strconv"
 
 import "github.com/tinne26/ptxt/internal"
@@ -29,6 +30,11 @@ type MaskDrawParameters struct {
 
 // Sets a custom drawing function for the renderer.
 // Can be set to nil to go back to the default drawing function.
+//
+// With Ebitengine, the default drawing function packs glyph masks into
+// shared atlas pages and draws all the glyphs of each draw pass with a
+// single triangles call (as long as the strand doesn't change). Custom
+// drawing functions draw glyphs immediately instead.
 func (self *RendererAdvanced) SetDrawFunc(fn func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
 	self.drawFunc = fn
 }
@@ -38,6 +44,10 @@ type DrawPass uint8
 const (
 	MainDrawPass DrawPass = iota
 	ShadowDrawPass
+
+	gfxBackDrawPass // internal, for twine gfx effects
+	gfxFrontDrawPass // internal, for twine gfx effects
+	glyphLayoutPass // internal, for RendererAdvanced.EachGlyphLayout()
 )
 
 // Allows the user to be notified of [MainDrawPass] and [ShadowDrawPass]
@@ -59,7 +69,12 @@ func (self *Renderer) loadMask(glyphIndex ggfnt.GlyphIndex, font *ggfnt.Font) co
 	if found { return mask }
 
 	// mask not found, obtain and cache
-	alphaMask := font.Glyphs().RasterizeMask(glyphIndex)
+	var alphaMask *image.Alpha
+	if glyphIndex == internal.NotdefGlyph {
+		alphaMask = rasterizeNotdefMask(font)
+	} else {
+		alphaMask = font.Glyphs().RasterizeMask(glyphIndex)
+	}
 	mask = alphaMaskToMask(alphaMask)
 	internal.DefaultCache.SetGlyphMask(fontKey, glyphIndex, mask)
 	return mask
@@ -72,7 +87,7 @@ func (self *Renderer) loadMask(glyphIndex ggfnt.GlyphIndex, font *ggfnt.Font) co
 // renderer's current direction.
 func (self *RendererAdvanced) DrawMask(target core.Target, mask core.GlyphMask, fontStrand *strand.Strand, params MaskDrawParameters) {
 	switch self.direction {
-	case Horizontal, Vertical:
+	case Horizontal, Vertical, RightToLeft:
 		lnkDrawHorzMask(fontStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 	case Sideways:
 		lnkDrawSidewaysMask(fontStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
@@ -136,6 +151,79 @@ func (self *RendererAdvanced) LastBoundsOffset() (int, int) {
 	return self.run.left, self.run.top
 }
 
+// Glyph information yielded by [RendererAdvanced.EachGlyphLayout]().
+type GlyphLayout struct {
+	GlyphIndex ggfnt.GlyphIndex
+	SourceOffset int // byte offset of the glyph's source rune in the text, or -1 for twines
+	Line int // line index, starting at zero and including wrapped lines
+	X, Y int // glyph origin, like MaskDrawParameters.X and MaskDrawParameters.Y
+	Advance int // horizontal or vertical advance, already scaled
+	Scale int
+}
+
+// Iterates the glyphs of the last measured or drawn text, as if it
+// was drawn at the given coordinates. This allows implementing custom
+// effects, hit-testing or debug overlays without having to replicate
+// the line breaking and wrapping logic.
+//
+// The yielded origins are the same that would be passed to custom draw
+// functions (see [RendererAdvanced.SetDrawFunc]()), except that twine
+// motions and shadow offsets are not applied. Control glyphs, like line
+// breaks, and glyphs elided at line wraps are not yielded. Reveal limits
+// are ignored.
+//
+// Source offsets are only available for strings, and glyphs resulting
+// from rewrite rules get the offset of the first rune they replace.
+func (self *RendererAdvanced) EachGlyphLayout(x, y int, fn func(GlyphLayout)) {
+	(*Renderer)(self).eachGlyphLayout(x, y,
+		func(_ int, layout GlyphLayout) {
+			if isDrawableGlyph(layout.GlyphIndex) { fn(layout) }
+		},
+	)
+}
+
+// Line breaks are also reported here, with the position at the start
+// of the new line. The index is the index in renderer.run.glyphIndices.
+func (self *Renderer) eachGlyphLayout(x, y int, fn func(int, GlyphLayout)) {
+	if len(self.run.glyphIndices) == 0 { return }
+	prevRevealLimit := self.revealLimit
+	self.revealLimit = -1
+	self.glyphLayoutFn = fn
+
+	x, y = self.computeTextOrigin(x, y)
+	params := self.prepareDrawParams(x, y)
+	switch self.direction {
+	case Horizontal, RightToLeft:
+		self.runHorzIterate(nil, glyphLayoutPass, params, 0, 0, nil)
+	case Vertical:
+		self.runVertIterate(nil, glyphLayoutPass, params, 0, 0, nil)
+	case Sideways:
+		self.runSidewaysIterate(nil, glyphLayoutPass, params, 0, 0, nil)
+	case SidewaysRight:
+		self.runSidewaysRightIterate(nil, glyphLayoutPass, params, 0, 0, nil)
+	default:
+		panic("unexpected direction '" + self.direction.String() + "'")
+	}
+
+	self.glyphLayoutFn = nil
+	self.revealLimit = prevRevealLimit
+}
+
+func (self *Renderer) notifyGlyphLayout(index int, lineIndex uint16, x, y int, scale int) {
+	sourceOffset := -1
+	if self.run.twineContents == nil && index < len(self.run.glyphSources) {
+		sourceOffset = int(self.run.glyphSources[index])
+	}
+	self.glyphLayoutFn(index, GlyphLayout{
+		GlyphIndex: self.run.glyphIndices[index],
+		SourceOffset: sourceOffset,
+		Line: int(lineIndex),
+		X: x, Y: y,
+		Advance: int(self.run.advances[index]),
+		Scale: scale,
+	})
+}
+
 // This would also be interesting.
 // func (self *RendererAdvanced) LastOpFinalGlyphOrigin() (int, int)
 // func (self *RendererAdvanced) FinalGlyphOrigin() (int, int)
@@ -210,9 +298,6 @@ func (self *Renderer) isRuneAvailable(codePoint rune) bool {
 	return found
 }
 
-// func (self *RendererAdvanced) SetTabSpaces(n int) {}
-// func (self *RendererAdvanced) GetTabSpaces() int {}
-
 // A configuration to advance two consecutive line breaks as x1.5 line 
 // height instead of x2. When it comes to long text, this tends to make
 // the spacing between paragraphs look more natural.
@@ -229,6 +314,73 @@ func (self *RendererAdvanced) GetParBreakEnabled() bool {
 	return self.parBreakEnabled
 }
 
+// When enabled, the [Justify] align spreads the leftover width of
+// wrapped lines across all the gaps between glyphs instead of only
+// across spaces. This also allows justifying lines without spaces.
+// Disabled by default.
+func (self *RendererAdvanced) SetJustifyInterspacingEnabled(enabled bool) {
+	self.justifyInterspacing = enabled
+}
+
+// Returns whether [Justify] also spreads leftover width across glyph
+// interspacing. See [RendererAdvanced.SetJustifyInterspacingEnabled]().
+func (self *RendererAdvanced) GetJustifyInterspacingEnabled() bool {
+	return self.justifyInterspacing
+}
+
+// Sets the text appended to truncated text on [Renderer.DrawWithLimits]()
+// and [Renderer.MeasureWithLimits](). The ellipsis is mapped to glyphs
+// together with the rest of the text, so rewrite rules can be used to
+// turn "..." into a dedicated ellipsis glyph. Can be empty. The default
+// value is "...".
+func (self *RendererAdvanced) SetEllipsis(ellipsis string) {
+	self.ellipsis = ellipsis
+}
+
+// Returns the current ellipsis. See [RendererAdvanced.SetEllipsis]().
+func (self *RendererAdvanced) GetEllipsis() string {
+	return self.ellipsis
+}
+
+// Sets the hyphenator used to find split points within words when
+// wrapping lines (see also [HyphenDictionary]). Words are sequences of
+// letters, even if interrupted by twine directives. When a line wraps
+// at a split point, the font's hyphen glyph (U+2010 or '-') is drawn
+// at the end of the line. Fonts without hyphen glyphs are never split.
+//
+// Split points are only used for line wrapping and don't affect the
+// source offsets. Inserted hyphens are not reported as glyphs on
+// [RendererAdvanced.EachGlyphLayout](), and they are ignored for
+// the [Vertical] direction. Nil by default.
+func (self *RendererAdvanced) SetHyphenator(hyphenator Hyphenator) {
+	self.hyphenator = hyphenator
+	self.ClearLayoutCache()
+}
+
+// Returns the current hyphenator. See [RendererAdvanced.SetHyphenator]().
+func (self *RendererAdvanced) GetHyphenator() Hyphenator {
+	return self.hyphenator
+}
+
+// Limits drawing to the first n glyphs of the text, which is useful
+// for typewriter effects (see also [Typewriter]). Line breaks and
+// other control glyphs don't count towards the limit, and layout is
+// still computed for the whole text, so aligns and line wrapping
+// don't change while the text is being revealed. Measuring is not
+// affected by the limit. Pass a negative value to remove the limit.
+//
+// Combined with [RendererAdvanced.DrawFromBuffer](), this allows
+// revealing text progressively without recomputing its layout.
+func (self *RendererAdvanced) SetRevealLimit(n int) {
+	self.revealLimit = max(n, -1)
+}
+
+// Returns the current reveal limit, or -1 if there's no limit.
+// See [RendererAdvanced.SetRevealLimit]().
+func (self *RendererAdvanced) GetRevealLimit() int {
+	return self.revealLimit
+}
+
 // Uses the data from the previous measure or draw operation to draw
 // it directly without additional recomputations. This obviously
 // makes this operation very low-level and unsafe.
@@ -240,6 +392,9 @@ func (self *RendererAdvanced) GetParBreakEnabled() bool {
 // You may change the target, horz/sideways text directions and colors
 // if you want, but you can't change scale nor line wrap max length...
 // or things will get messy. Well, maybe that counts as a use-case...
+//
+// To keep multiple layouts around and draw them safely across frames,
+// see [Renderer.Layout]() and [TextLayout] instead.
 func (self *RendererAdvanced) DrawFromBuffer(target core.Target, x, y int) {
 	(*Renderer)(self).drawFromBuffer(target, x, y)
 }
@@ -250,24 +405,69 @@ func (self *Renderer) drawFromBuffer(target core.Target, x, y int) {
 	}
 
 	mapping := self.Strand().Mapping()
-	err := lnkBeginPass(mapping, strand.BufferPass)
+	err := lnkBeginPass(mapping, strand.BufferPass, uint8(self.glyphMissPolicy))
 	if err != nil { panic(err) }
 	x, y = self.computeTextOrigin(x, y)
 	self.drawText(target, x, y)
+	_ = lnkFinishMapping(mapping, nil) // close rewrite rule sequences, nothing was fed
 	lnkFinishPass(mapping, strand.BufferPass)
 }
 
 // func (self *RendererAdvanced) LastOpEndPos() (x, y int, outOfBounds bool) {}
-// func (self *RendererAdvanced) SetGlyphMissPolicy(GlyphMissPolicy) {}
-// func (self *RendererAdvanced) GetGlyphMissPolicy() GlyphMissPolicy {}
-// type GlyphMissPolicy uint8
-// const (
-//    // NOTE: could also try uppercase if available..?
-// 	GlyphMissPanic GlyphMissPolicy = iota // panic on missing glyph
-// 	GlyphMissSkip // skip and ignore missing glyphs
-// 	GlyphMissNotdef // draw a notdef glyph (use the font's "notdef" if present)
-// 	GlyphMissEmptyRect // draw a standard notdef glyph, ignoring the font's "notdef"
-// )
+
+// See [RendererAdvanced.SetGlyphMissPolicy]().
+type GlyphMissPolicy uint8
+const (
+	GlyphMissPanic     GlyphMissPolicy = GlyphMissPolicy(internal.GlyphMissPanic) // panic on missing glyph
+	GlyphMissSkip      GlyphMissPolicy = GlyphMissPolicy(internal.GlyphMissSkip) // skip and ignore missing glyphs
+	GlyphMissNotdef    GlyphMissPolicy = GlyphMissPolicy(internal.GlyphMissNotdef) // draw the font's "notdef" glyph if present, or a standard one otherwise
+	GlyphMissEmptyRect GlyphMissPolicy = GlyphMissPolicy(internal.GlyphMissEmptyRect) // draw a standard notdef glyph, ignoring the font's "notdef"
+
+	// Flag that can be combined with any other policy, like
+	// (GlyphMissSkip | GlyphMissTryUppercase). When a glyph
+	// is missing, the uppercase version of the code point will
+	// be tried first. Useful for fonts without lowercase letters.
+	GlyphMissTryUppercase GlyphMissPolicy = GlyphMissPolicy(internal.GlyphMissTryUppercase)
+)
+
+// Returns a string representation of the glyph miss policy.
+func (self GlyphMissPolicy) String() string {
+	var str string
+	switch self & ^GlyphMissTryUppercase {
+	case GlyphMissPanic     : str = "GlyphMissPanic"
+	case GlyphMissSkip      : str = "GlyphMissSkip"
+	case GlyphMissNotdef    : str = "GlyphMissNotdef"
+	case GlyphMissEmptyRect : str = "GlyphMissEmptyRect"
+	default:
+		return "GlyphMissPolicyUndefined#" + strconv.Itoa(int(self))
+	}
+	if self & GlyphMissTryUppercase != 0 { str += "|GlyphMissTryUppercase" }
+	return str
+}
+
+// Sets the policy to follow when the text contains code points that
+// aren't available on the strand's font. By default, the renderer will
+// panic ([GlyphMissPanic]), but when dealing with user input or
+// translations you might prefer to skip missing glyphs or draw a
+// notdef glyph instead.
+//
+// The standard notdef glyph is a hollow rectangle sized after the
+// font's uppercase ascent. Custom draw functions will receive it
+// with an index above [ggfnt.MaxGlyphs], but [RendererAdvanced.LoadMask]()
+// can still be used with it.
+//
+// The line break '\n' is never considered missing.
+func (self *RendererAdvanced) SetGlyphMissPolicy(policy GlyphMissPolicy) {
+	if policy & ^GlyphMissTryUppercase > GlyphMissEmptyRect {
+		panic("invalid glyph miss policy " + policy.String())
+	}
+	self.glyphMissPolicy = policy
+}
+
+// See [RendererAdvanced.SetGlyphMissPolicy]().
+func (self *RendererAdvanced) GetGlyphMissPolicy() GlyphMissPolicy {
+	return self.glyphMissPolicy
+}
 
 // func (self *RendererAdvanced) StoreState() {} // dubious due to necessarily patchy implementation
 // func (self *RendererAdvanced) RestoreState() {} // same as above
@@ -0,0 +1,388 @@
+package ptxt
+
+import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ggfnt"
+
+// Bidi levels are computed right after converting the text to glyphs,
+// while the source is still available, and stored in renderer.run.bidiLevels
+// (one level per glyph index, with bidiWhitespaceFlag set for whitespace,
+// as trailing whitespace is reset to the paragraph level on each line).
+// Layout and line wrapping work in logical order. Once the layout is
+// known, each line is reordered and the visual x of each glyph relative
+// to its line start is stored in renderer.run.bidiPositions, which draws
+// use instead of the logical pen position.
+//
+// Levels are only computed for [Horizontal] and [RightToLeft] text
+// when the text contains right-to-left characters or the direction is
+// RightToLeft. Twine directives are treated as boundary neutrals, and
+// their padding moves with the glyph that precedes them. The other
+// directions are never reordered.
+
+const bidiWhitespaceFlag uint8 = 0x80
+
+// Aux layout data for a glyph within a line being reordered.
+type bidiCell struct {
+	index int // index in renderer.run.glyphIndices
+	width int // distance from the start of the glyph to the start of the next one
+	offset int // distance from the start of the cell to the glyph origin
+	level uint8
+}
+
+// Returns the paragraph embedding level for the current direction.
+func (self *Renderer) bidiBaseLevel() uint8 {
+	if self.direction == RightToLeft { return 1 }
+	return 0
+}
+
+// Side effects: updates renderer.run.bidiLevels and, for mirrored
+// characters in right-to-left runs, renderer.run.glyphIndices. The
+// runeAt function must behave like in computeRuleBreaks().
+func (self *Renderer) computeBidiLevels(runeAt func(offset int) (rune, bool)) {
+	self.run.bidiLevels = self.run.bidiLevels[ : 0]
+	if self.direction != Horizontal && self.direction != RightToLeft { return }
+
+	// classify glyphs
+	numGlyphs := len(self.run.glyphIndices)
+	classes := setBufferSize(self.run.bidiClasses, numGlyphs)
+	hasRightToLeft := (self.direction == RightToLeft)
+	prevSource, prevClass := -1, bidiON
+	for index := 0; index < numGlyphs; index++ {
+		glyphIndex := self.run.glyphIndices[index]
+		if !isDrawableGlyph(glyphIndex) {
+			switch glyphIndex {
+			case ggfnt.GlyphNewLine:
+				classes[index] = bidiB
+			case internal.TabGlyph:
+				classes[index] = bidiS
+			case internal.FallbackGlyph, internal.TwineEffectMarkerGlyph:
+				classes[index] = bidiBN
+				index += 1 // skip pair
+				classes[index] = bidiBN
+			default:
+				classes[index] = bidiBN
+			}
+			prevSource = -1
+			continue
+		}
+
+		source := int(self.run.glyphSources[index])
+		if source != prevSource { // new rune sequence
+			codePoint, found := runeAt(source)
+			prevSource, prevClass = source, bidiON
+			if found { prevClass = getBidiClass(codePoint) }
+			switch prevClass {
+			case bidiR, bidiAL, bidiAN: hasRightToLeft = true
+			}
+		}
+		classes[index] = prevClass
+	}
+	self.run.bidiClasses = classes
+	if !hasRightToLeft { return }
+
+	// resolve levels for each paragraph
+	self.run.bidiLevels = setBufferSize(self.run.bidiLevels, numGlyphs)
+	start := 0
+	for index := 0; index <= numGlyphs; index++ {
+		if index < numGlyphs && classes[index] != bidiB { continue }
+		self.resolveBidiParagraph(start, index)
+		if index < numGlyphs { self.run.bidiLevels[index] = self.bidiBaseLevel() }
+		start = index + 1
+	}
+	self.mirrorBidiGlyphs(runeAt)
+}
+
+// Resolves the levels of the glyphs in [start, end), which must
+// form a paragraph, following rules W1-W7, N1-N2, I1-I2 and the
+// segment separator part of L1 from the Unicode Bidirectional
+// Algorithm. Boundary neutrals are skipped (rule X9) and take the
+// level of the preceding glyph.
+func (self *Renderer) resolveBidiParagraph(start, end int) {
+	classes, levels := self.run.bidiClasses, self.run.bidiLevels
+	baseLevel := self.bidiBaseLevel()
+	sos := bidiL // start and end of sequence type
+	if baseLevel & 1 == 1 { sos = bidiR }
+
+	// collect non boundary neutral glyphs and flag whitespace
+	seq := self.run.bidiSequence[ : 0]
+	for index := start; index < end; index++ {
+		levels[index] = 0
+		switch classes[index] {
+		case bidiWS, bidiBN:
+			levels[index] = bidiWhitespaceFlag
+		}
+		if classes[index] != bidiBN { seq = append(seq, index) }
+	}
+	self.run.bidiSequence = seq
+	t := func(k int) bidiClass { return classes[seq[k]] }
+	set := func(k int, class bidiClass) { classes[seq[k]] = class }
+
+	// W1: nonspacing marks take the type of the previous character
+	for k := range seq {
+		if t(k) != bidiNSM { continue }
+		if k == 0 { set(k, sos) } else { set(k, t(k - 1)) }
+	}
+
+	// W2: european numbers after arabic letters become arabic numbers.
+	// W3: arabic letters become R
+	lastStrong := sos
+	for k := range seq {
+		switch t(k) {
+		case bidiL, bidiR, bidiAL:
+			lastStrong = t(k)
+		case bidiEN:
+			if lastStrong == bidiAL { set(k, bidiAN) }
+		}
+	}
+	for k := range seq {
+		if t(k) == bidiAL { set(k, bidiR) }
+	}
+
+	// W4: single separators between numbers of the same type
+	for k := 1; k < len(seq) - 1; k++ {
+		prev, next := t(k - 1), t(k + 1)
+		switch t(k) {
+		case bidiES:
+			if prev == bidiEN && next == bidiEN { set(k, bidiEN) }
+		case bidiCS:
+			if prev == next && (prev == bidiEN || prev == bidiAN) { set(k, prev) }
+		}
+	}
+
+	// W5: terminators adjacent to european numbers
+	for k := range seq {
+		if t(k) != bidiEN { continue }
+		for j := k - 1; j >= 0 && t(j) == bidiET; j-- { set(j, bidiEN) }
+		for j := k + 1; j < len(seq) && t(j) == bidiET; j++ { set(j, bidiEN) }
+	}
+
+	// W6: remaining separators and terminators become neutrals.
+	// W7: european numbers after L become L
+	lastStrong = sos
+	for k := range seq {
+		switch t(k) {
+		case bidiES, bidiET, bidiCS:
+			set(k, bidiON)
+		case bidiL, bidiR:
+			lastStrong = t(k)
+		case bidiEN:
+			if lastStrong == bidiL { set(k, bidiL) }
+		}
+	}
+
+	// N1 and N2: neutrals take the direction of the surrounding strong
+	// text if both sides agree (numbers count as R), or the embedding
+	// direction otherwise
+	strongDir := func(class bidiClass) bidiClass {
+		if class == bidiEN || class == bidiAN { return bidiR }
+		return class
+	}
+	for k := 0; k < len(seq); k++ {
+		if !t(k).isNeutral() { continue }
+		runEnd := k
+		for runEnd < len(seq) && t(runEnd).isNeutral() { runEnd += 1 }
+		prev, next := sos, sos
+		if k > 0 { prev = strongDir(t(k - 1)) }
+		if runEnd < len(seq) { next = strongDir(t(runEnd)) }
+		resolved := sos
+		if prev == next { resolved = prev }
+		for j := k; j < runEnd; j++ {
+			if t(j) != bidiB && t(j) != bidiS { set(j, resolved) }
+		}
+		k = runEnd - 1
+	}
+
+	// I1 and I2: implicit levels
+	for _, index := range seq {
+		level := baseLevel
+		switch classes[index] {
+		case bidiR:
+			if baseLevel & 1 == 0 { level += 1 }
+		case bidiAN, bidiEN:
+			if baseLevel & 1 == 0 { level += 2 } else { level += 1 }
+		case bidiL:
+			if baseLevel & 1 == 1 { level += 1 }
+		}
+		levels[index] |= level
+	}
+
+	// X9: boundary neutrals take the level of the previous glyph
+	prevLevel := baseLevel
+	for index := start; index < end; index++ {
+		if classes[index] == bidiBN {
+			levels[index] |= prevLevel
+		} else {
+			prevLevel = levels[index] &^ bidiWhitespaceFlag
+		}
+	}
+
+	// L1: segment separators and the whitespace before them
+	for index := start; index < end; index++ {
+		if classes[index] != bidiS { continue }
+		levels[index] = baseLevel
+		for j := index - 1; j >= start && levels[j] & bidiWhitespaceFlag != 0; j-- {
+			levels[j] = baseLevel | bidiWhitespaceFlag
+		}
+	}
+}
+
+// Replaces mirrored characters in right-to-left runs with their mirror
+// glyphs, if the font has them. Glyphs from fallback strands are left
+// as they are. With twines, each glyph is mirrored with the strand
+// active at its position.
+func (self *Renderer) mirrorBidiGlyphs(runeAt func(offset int) (rune, bool)) {
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
+	for index := 0; index < len(self.run.glyphIndices); index++ {
+		glyphIndex := self.run.glyphIndices[index]
+		if !isDrawableGlyph(glyphIndex) {
+			switch glyphIndex {
+			case internal.FallbackGlyph:
+				index += 1 // skip fallback index
+			case internal.TwineEffectMarkerGlyph:
+				index += 1 // skip directive offset
+				_ = self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+			}
+			continue
+		}
+		if self.run.bidiLevels[index] & 1 == 0 { continue }
+		if index + 1 < len(self.run.glyphIndices) && self.run.glyphIndices[index + 1] == internal.FallbackGlyph {
+			continue
+		}
+		codePoint, found := runeAt(int(self.run.glyphSources[index]))
+		if !found { continue }
+		mirror, hasMirror := getBidiMirror(codePoint)
+		if !hasMirror { continue }
+		fontStrand := self.strands[self.strandIndex]
+		settings := fontStrand.UnderlyingSettingsCache().UnsafeSlice()
+		group, found := fontStrand.Font().Mapping().Utf8(mirror, settings)
+		if found && group.Size() > 0 {
+			self.run.glyphIndices[index] = group.Select(0)
+		}
+	}
+	if twining { self.twineOperator.End() }
+}
+
+// Returns the kerning between the given glyphs, swapping them for
+// right-to-left glyphs so the pair matches their visual order.
+func (self *Renderer) horzKerning(font *ggfnt.Font, prevGlyph, glyph ggfnt.GlyphIndex, index int) int {
+	if index < len(self.run.bidiLevels) && self.run.bidiLevels[index] & 1 == 1 {
+		prevGlyph, glyph = glyph, prevGlyph
+	}
+	return int(font.Kerning().Get(prevGlyph, glyph))
+}
+
+// Side effects: updates renderer.run.bidiPositions. Must be called once
+// the layout has been computed. The positions replicate the pen
+// movements of runHorzIterate().
+func (self *Renderer) computeBidiPositions() {
+	self.run.bidiPositions = self.run.bidiPositions[ : 0]
+	if len(self.run.bidiLevels) == 0 { return }
+	if len(self.run.bidiLevels) != len(self.run.glyphIndices) { panic(brokenCode) }
+
+	self.run.bidiPositions = setBufferSize(self.run.bidiPositions, len(self.run.glyphIndices))
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
+	scale := int(self.scale)
+	interspacing := strandFullGlyphInterspacing(self.Strand())*scale
+	var drawWrapTemps drawWrapTempVariables
+	drawWrapTemps.Init(self)
+	cells := self.run.bidiCells[ : 0]
+	var x int
+	for index := 0; index < len(self.run.glyphIndices); index++ {
+		// line wrap case
+		if drawWrapTemps.IsLineWrapIndex(index) {
+			elide := drawWrapTemps.WrapTypeIsElide()
+			cells, x = self.reorderBidiLine(cells), 0
+			drawWrapTemps.Update(self)
+			if elide { continue }
+		}
+
+		glyphIndex := self.run.glyphIndices[index]
+		level := self.run.bidiLevels[index]
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				interspacing = strandFullGlyphInterspacing(self.Strand())*scale
+			}
+			drawWrapTemps.NotifyNonBreak()
+			kerning := int(self.run.kernings[index])
+			width := kerning + int(self.run.advances[index]) + interspacing
+			if level & 1 == 1 { kerning = 0 } // kerning goes after the glyph
+			cells = append(cells, bidiCell{ index: index, width: width, offset: kerning, level: level })
+			x += width
+		} else { // control glyph
+			switch glyphIndex {
+			case ggfnt.GlyphNewLine:
+				if !drawWrapTemps.AbsorbLineBreak() {
+					cells, x = self.reorderBidiLine(cells), 0
+				}
+			case internal.FallbackGlyph:
+				index += 1 // skip fallback index
+			case internal.TwineEffectMarkerGlyph:
+				index += 1 // skip directive offset
+				changes := self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					scale = int(self.scale)
+					interspacing = strandFullGlyphInterspacing(self.Strand())*scale
+				}
+				if self.run.advances[index] != 0 { // padding
+					width := int(self.run.advances[index])
+					cells = append(cells, bidiCell{ index: index, width: width, level: level })
+					x += width
+				}
+			case internal.TabGlyph:
+				width := int(self.run.advances[index])
+				cells = append(cells, bidiCell{ index: index, width: width, level: level })
+				x += width
+			case internal.SoftHyphenGlyph:
+				if !drawWrapTemps.IsHyphenWrap(self, index) { break }
+				hyphen, _ := strandHyphenGlyph(self.Strand())
+				width := glyphAdvance(self.Strand().Font(), hyphen)*scale
+				cells = append(cells, bidiCell{ index: index, width: width, level: level })
+			}
+		}
+	}
+	self.run.bidiCells = self.reorderBidiLine(cells)
+	self.fallbackStrand = nil
+	if twining { self.twineOperator.End() }
+}
+
+// Applies rules L1 (trailing whitespace) and L2 (reordering) to the
+// given line cells, and stores the visual position of each cell's glyph
+// in renderer.run.bidiPositions. Returns the cells slice emptied.
+func (self *Renderer) reorderBidiLine(cells []bidiCell) []bidiCell {
+	baseLevel := self.bidiBaseLevel()
+	for i := len(cells) - 1; i >= 0 && cells[i].level & bidiWhitespaceFlag != 0; i-- {
+		cells[i].level = baseLevel
+	}
+
+	// find highest level and lowest odd level
+	var highest uint8
+	lowestOdd := uint8(0xFF)
+	for i := range cells {
+		cells[i].level &^= bidiWhitespaceFlag
+		level := cells[i].level
+		highest = max(highest, level)
+		if level & 1 == 1 { lowestOdd = min(lowestOdd, level) }
+	}
+
+	// reverse runs from the highest level to the lowest odd level
+	for level := highest; level >= lowestOdd && level > 0; level-- {
+		for i := 0; i < len(cells); i++ {
+			if cells[i].level < level { continue }
+			j := i
+			for j < len(cells) && cells[j].level >= level { j += 1 }
+			for a, b := i, j - 1; a < b; a, b = a + 1, b - 1 {
+				cells[a], cells[b] = cells[b], cells[a]
+			}
+			i = j
+		}
+	}
+
+	// store visual positions
+	var x int
+	for _, cell := range cells {
+		self.run.bidiPositions[cell.index] = x + cell.offset
+		x += cell.width
+	}
+	return cells[ : 0]
+}
@@ -0,0 +1,117 @@
+package ptxt
+
+import "image"
+import "strconv"
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
+func TestBidi(t *testing.T) {
+	// build a small font with 4 pixel wide glyphs and a 2 pixel wide space
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(0)
+	codePoints := []rune{ 'a', 'b', 'א', 'ב', '1', '2', '(', ')', ' ' }
+	for _, codePoint := range codePoints {
+		width := 4
+		if codePoint == ' ' { width = 2 }
+		mask := image.NewAlpha(image.Rect(0, -4, width, 0))
+		for i := range mask.Pix { mask.Pix[i] = 255 }
+		uid, err := fontBuilder.AddGlyph(mask)
+		if err != nil { t.Fatal(err) }
+		err = fontBuilder.Map(codePoint, uid)
+		if err != nil { t.Fatal(err) }
+	}
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+	glyphRunes := make(map[ggfnt.GlyphIndex]rune)
+	for _, codePoint := range codePoints {
+		group, found := font.Mapping().Utf8(codePoint, nil)
+		if !found { t.Fatalf("%q not mapped", codePoint) }
+		glyphRunes[group.Select(0)] = codePoint
+	}
+
+	// create strand and renderer
+	fontStrand, err := NewStrand(font)
+	if err != nil { t.Fatal(err) }
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+	var drawn []string
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawn = append(drawn, string(glyphRunes[glyphIndex]) + "@" + strconv.Itoa(params.X))
+		},
+	)
+
+	tests := []struct {
+		direction Direction
+		align Align
+		text string
+		wrap int
+		expected string
+	}{
+		{ Horizontal, Left, "ab", 0, "a@0 b@4" },
+		{ Horizontal, Left, "ab אב", 0, "a@0 b@4  @8 א@14 ב@10" },
+		{ RightToLeft, Left, "אב", 0, "א@4 ב@0" },
+		{ RightToLeft, HorzNeutral, "אב", 0, "א@-4 ב@-8" },
+		{ RightToLeft, Right, "ab", 0, "a@-8 b@-4" },
+		{ RightToLeft, Left, "אב 12", 0, "א@14 ב@10  @8 1@0 2@4" },
+		{ RightToLeft, Left, "אב ab", 0, "א@14 ב@10  @8 a@0 b@4" },
+		{ Horizontal, Left, "א 12 ב", 0, "א@16  @14 1@6 2@10  @4 ב@0" },
+		{ RightToLeft, Left, "(א)", 0, ")@8 א@4 (@0" }, // mirrored
+		{ RightToLeft, Left, "אב בא", 9, "א@4 ב@0 ב@4 א@0" },
+		{ RightToLeft, Left, "אב בא", 10, "א@6 ב@2  @0 ב@4 א@0" }, // trailing space on the left
+		{ RightToLeft, Right, "אב\nבאב", 0, "א@-4 ב@-8 ב@-4 א@-8 ב@-12" },
+	}
+	for _, test := range tests {
+		renderer.SetDirection(test.direction)
+		renderer.SetAlign(test.align)
+		drawn = drawn[ : 0]
+		if test.wrap > 0 {
+			renderer.DrawWithWrap(nil, test.text, 0, 0, test.wrap)
+		} else {
+			renderer.Draw(nil, test.text, 0, 0)
+		}
+		var result string
+		for i, glyph := range drawn {
+			if i > 0 { result += " " }
+			result += glyph
+		}
+		if result != test.expected {
+			t.Fatalf("%s, %s, %q: expected %q, got %q", test.direction, test.align, test.text, test.expected, result)
+		}
+	}
+
+	// carets
+	renderer.SetDirection(RightToLeft)
+	renderer.SetAlign(Left)
+	_, _ = renderer.Measure("אב")
+	for offset, expectedX := range map[int]int{ 0: 8, 2: 4, 4: 0 } {
+		caretX, _, _ := renderer.CaretAt(0, 0, offset)
+		if caretX != expectedX {
+			t.Fatalf("offset %d: expected caret x %d, got %d", offset, expectedX, caretX)
+		}
+	}
+
+	// selection rects are split on visual gaps ("b א" leaves ב out)
+	renderer.SetDirection(Horizontal)
+	_, _ = renderer.Measure("ab אב")
+	for _, boundingMode := range []BoundingMode{ LogicalBounding, MaskBounding } {
+		renderer.Advanced().SetBoundingMode(boundingMode)
+		rects := renderer.AppendSelectionRects(nil, 0, 0, 1, 5)
+		if len(rects) != 2 || rects[0].Min.X != 4 || rects[0].Max.X != 10 || rects[1].Min.X != 14 || rects[1].Max.X != 18 {
+			t.Fatalf("%s: expected selection rects at x = [4, 10) and [14, 18), got %v", boundingMode, rects)
+		}
+	}
+	renderer.Advanced().SetBoundingMode(LogicalBounding)
+	rects := renderer.AppendSelectionRects(nil, 0, 0, 2, 7)
+	if len(rects) != 1 || rects[0].Min.X != 8 || rects[0].Max.X != 18 {
+		t.Fatalf("expected a single selection rect at x = [8, 18), got %v", rects)
+	}
+}
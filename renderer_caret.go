@@ -0,0 +1,249 @@
+package ptxt
+
+import "github.com/tinne26/ptxt/strand"
+
+import "github.com/tinne26/ggfnt"
+
+// A valid caret position within the last laid out text. The along
+// coordinate is x for Horizontal and y for the other directions.
+type caretStop struct {
+	offset int // byte offset in the source text or twine contents
+	line int
+	along int
+	cross int // column center x, only used for Vertical text
+	strand *strand.Strand // strand of the glyph the stop belongs to
+	scale int // scale of the glyph the stop belongs to
+}
+
+// Returns the caret position for the given byte offset of the last
+// measured or drawn text, as if the text was drawn at (x, y). This
+// is mainly intended for editable text fields.
+//
+// For [Horizontal] and [RightToLeft] text, the caret is a vertical
+// segment going from (caretX, caretY) to (caretX, caretY + length).
+// For [Sideways], [SidewaysRight] and [Vertical] text, the caret is a
+// horizontal segment going from (caretX, caretY) to (caretX + length,
+// caretY). The length is the scaled font ascent plus descent (or the
+// column width for Vertical text), using the font of the glyph the
+// caret is attached to, which can come from a fallback strand.
+//
+// Line wrapping, align, scale and kerning are all taken into account.
+// Offsets falling in the middle of a glyph sequence replaced through
+// rewrite rules are moved to the start of the sequence. Offsets out of
+// bounds are clamped. With bidirectional text, the caret follows the
+// visual position of each glyph, so offsets at direction boundaries
+// are placed next to the glyph that comes before them logically.
+//
+// For twines, offsets refer to the raw twine contents, like the pages
+// returned by [RendererTwine.AppendPages](). Caret positions only exist
+// around glyphs, so offsets within twine directives are moved back to
+// the closest glyph boundary.
+func (self *Renderer) CaretAt(x, y int, offset int) (caretX, caretY, length int) {
+	self.collectCaretStops(x, y)
+	offset = clamp(offset, 0, self.run.sourceLen)
+	best := self.run.caretStops[0]
+	for _, stop := range self.run.caretStops {
+		if stop.offset <= offset { best = stop }
+	}
+
+	if self.direction == Vertical {
+		width := self.caretColumnWidth(best.strand, best.scale)
+		return best.cross - (width >> 1), best.along, width
+	}
+	ox, oy := self.computeTextOrigin(x, y)
+	ascent, descent := self.caretMetrics(best.strand, best.scale)
+	baseline := self.caretLineBaseline(ox, oy, best.line)
+	switch self.direction {
+	case Horizontal, RightToLeft : return best.along, baseline - ascent, ascent + descent
+	case Sideways      : return baseline - ascent, best.along, ascent + descent
+	case SidewaysRight : return baseline - descent, best.along, ascent + descent
+	default:
+		panic(brokenCode)
+	}
+}
+
+// Returns the byte offset of the last measured or drawn text that's
+// closest to the given point, as if the text was drawn at (x, y). This
+// is the inverse of [Renderer.CaretAt](), and can be used to position
+// the caret when clicking on a text field. The returned offset is
+// always at a rune boundary (or a glyph boundary for twines).
+//
+// Points outside the text get the offset of the closest line and caret
+// position.
+func (self *Renderer) OffsetAt(x, y int, pointX, pointY int) int {
+	self.collectCaretStops(x, y)
+
+	// find closest line
+	var bestLine int
+	if self.direction == Vertical {
+		bestLine = self.caretClosestColumn(pointX)
+	} else {
+		bestLine = self.caretClosestLine(x, y, pointX, pointY)
+	}
+
+	// find closest caret stop within the line
+	along := pointX
+	if self.direction != Horizontal && self.direction != RightToLeft { along = pointY }
+	bestOffset := 0
+	bestDist := -1
+	for _, stop := range self.run.caretStops {
+		if stop.line != bestLine { continue }
+		dist := stop.along - along
+		if dist < 0 { dist = -dist }
+		if bestDist == -1 || dist < bestDist {
+			bestOffset, bestDist = stop.offset, dist
+		}
+	}
+	return bestOffset
+}
+
+func (self *Renderer) caretClosestLine(x, y int, pointX, pointY int) int {
+	// get line band boundaries and point coordinate
+	ox, oy := self.computeTextOrigin(x, y)
+	ascent, descent := self.caretMetrics(self.strands[self.strandIndex], int(self.scale))
+	var bandStart, bandEnd int
+	var perp int
+	switch self.direction {
+	case Horizontal, RightToLeft : bandStart, bandEnd, perp = -ascent, descent, pointY
+	case Sideways      : bandStart, bandEnd, perp = -ascent, descent, pointX
+	case SidewaysRight : bandStart, bandEnd, perp = -descent, ascent, pointX
+	default:
+		panic(brokenCode)
+	}
+
+	var bestLine int
+	bestDist := -1
+	for line := 0; line < len(self.run.lineLengths); line++ {
+		baseline := self.caretLineBaseline(ox, oy, line)
+		var dist int
+		if perp < baseline + bandStart {
+			dist = baseline + bandStart - perp
+		} else if perp >= baseline + bandEnd {
+			dist = perp - (baseline + bandEnd) + 1
+		}
+		if bestDist == -1 || dist < bestDist {
+			bestLine, bestDist = line, dist
+		}
+	}
+	return bestLine
+}
+
+// Like caretClosestLine(), but for Vertical text, where the line
+// (column) positions are taken from the caret stops.
+func (self *Renderer) caretClosestColumn(pointX int) int {
+	width := self.caretColumnWidth(self.strands[self.strandIndex], int(self.scale))
+	var bestLine int
+	bestDist := -1
+	for _, stop := range self.run.caretStops {
+		left := stop.cross - (width >> 1)
+		var dist int
+		if pointX < left {
+			dist = left - pointX
+		} else if pointX >= left + width {
+			dist = pointX - (left + width) + 1
+		}
+		if bestDist == -1 || dist < bestDist {
+			bestLine, bestDist = stop.line, dist
+		}
+	}
+	return bestLine
+}
+
+// Side effects: updates renderer.run.caretStops.
+func (self *Renderer) collectCaretStops(x, y int) {
+	ox, oy := self.computeTextOrigin(x, y)
+	mainStrand, mainScale := self.strands[self.strandIndex], int(self.scale)
+	self.run.caretStops = self.run.caretStops[ : 0]
+	firstStop := caretStop{ offset: 0, line: 0, strand: mainStrand, scale: mainScale }
+	if self.direction == Vertical {
+		firstStop.along, firstStop.cross = self.computeVertLineStart(oy, 0), ox
+	} else {
+		firstStop.along = self.caretLineStart(ox, oy, 0)
+	}
+	self.run.caretStops = append(self.run.caretStops, firstStop)
+	self.eachGlyphLayout(x, y, func(index int, layout GlyphLayout) {
+		if layout.GlyphIndex == ggfnt.GlyphNewLine {
+			stop := caretStop{
+				offset: int(self.run.glyphSources[index]) + 1, line: layout.Line,
+				strand: mainStrand, scale: mainScale,
+			}
+			if self.direction == Vertical {
+				stop.along, stop.cross = layout.Y, layout.X // new column start
+			} else {
+				stop.along = self.caretLineStart(ox, oy, layout.Line)
+			}
+			self.run.caretStops = append(self.run.caretStops, stop)
+		} else if isDrawableGlyph(layout.GlyphIndex) {
+			glyphStrand := self.Strand() // fallback strand, if any
+			var cross int
+			start, end := layout.X, layout.X + layout.Advance
+			switch self.direction {
+			case Sideways      : start, end = layout.Y, layout.Y - layout.Advance
+			case SidewaysRight : start, end = layout.Y, layout.Y + layout.Advance
+			case Vertical:
+				placement := glyphPlacement(glyphStrand.Font(), layout.GlyphIndex)
+				start = layout.Y - int(placement.TopAdvance)*layout.Scale
+				end = layout.Y + int(placement.BottomAdvance)*layout.Scale
+				cross = layout.X + int(self.run.horzShifts[index])
+			}
+			if len(self.run.bidiLevels) > 0 && self.run.bidiLevels[index] & 1 == 1 {
+				start, end = end, start // right to left glyph
+			}
+			self.run.caretStops = append(self.run.caretStops,
+				caretStop{ offset: int(self.run.glyphSources[index]), line: layout.Line, along: start, cross: cross, strand: glyphStrand, scale: layout.Scale },
+				caretStop{ offset: self.nextGlyphSource(index), line: layout.Line, along: end, cross: cross, strand: glyphStrand, scale: layout.Scale },
+			)
+		}
+	})
+}
+
+// Returns the source offset of the first glyph after the given
+// index that comes from a different rune sequence, or the source
+// text length if there's none.
+func (self *Renderer) nextGlyphSource(index int) int {
+	source := self.run.glyphSources[index]
+	for i := index + 1; i < len(self.run.glyphSources); i++ {
+		if self.run.glyphSources[i] > source {
+			return int(self.run.glyphSources[i])
+		}
+	}
+	return self.run.sourceLen
+}
+
+func (self *Renderer) caretLineStart(ox, oy int, lineIndex int) int {
+	if lineIndex >= len(self.run.lineLengths) { // empty text
+		if self.direction == Horizontal || self.direction == RightToLeft { return ox }
+		return oy
+	}
+	switch self.direction {
+	case Horizontal    : return self.computeLineStart(ox, uint16(lineIndex))
+	case RightToLeft   : return self.computeLineStart(ox, uint16(lineIndex)) + int(self.run.lineLengths[lineIndex])
+	case Sideways      : return oy - (self.computeLineStart(oy, uint16(lineIndex)) - oy)
+	case SidewaysRight : return self.computeLineStart(oy, uint16(lineIndex))
+	default:
+		panic(brokenCode)
+	}
+}
+
+func (self *Renderer) caretLineBaseline(ox, oy int, lineIndex int) int {
+	var advance int
+	for i := 0; i < lineIndex; i++ {
+		advance += self.run.lineAdvances[i]
+	}
+	switch self.direction {
+	case Horizontal, RightToLeft : return oy + advance
+	case Sideways      : return ox + advance
+	case SidewaysRight : return ox - advance
+	default:
+		panic(brokenCode)
+	}
+}
+
+func (self *Renderer) caretMetrics(fontStrand *strand.Strand, scale int) (ascent, descent int) {
+	font := fontStrand.Font()
+	return int(font.Metrics().Ascent())*scale, int(font.Metrics().Descent())*scale
+}
+
+func (self *Renderer) caretColumnWidth(fontStrand *strand.Strand, scale int) int {
+	return int(fontStrand.Font().Metrics().VertLineWidth())*scale
+}
@@ -0,0 +1,57 @@
+package ptxt
+
+import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ptxt/strand"
+
+// Glyphs from fallback strands (see strand.StrandMapping.SetFallbacks)
+// are stored in renderer.run.glyphIndices followed by a FallbackGlyph
+// control glyph and the index of the fallback strand. While processing
+// these glyphs, renderer.fallbackStrand is set, so Renderer.Strand()
+// returns the fallback strand instead of the main one.
+
+// Sets renderer.fallbackStrand to the fallback strand of the glyph at
+// the given index, or nil if the glyph comes from the main strand.
+// Returns whether the active strand has changed, in which case any
+// values derived from the strand must be refreshed.
+func (self *Renderer) syncGlyphFallback(index int) bool {
+	var fallback *strand.Strand
+	if index + 2 < len(self.run.glyphIndices) && self.run.glyphIndices[index + 1] == internal.FallbackGlyph {
+		fallback = self.mainFallbacks()[self.run.glyphIndices[index + 2]]
+	}
+	if fallback == self.fallbackStrand { return false }
+	self.fallbackStrand = fallback
+	return true
+}
+
+// Returns the fallbacks of the main strand. While drawing a TextLayout,
+// these are the fallbacks captured when the layout was created.
+func (self *Renderer) mainFallbacks() []*strand.Strand {
+	if self.layoutStrands != nil { return self.layoutStrands[1 : ] }
+	return self.strands[self.strandIndex].Mapping().GetFallbacks()
+}
+
+// Clears renderer.fallbackStrand. Returns whether the active strand
+// has changed.
+func (self *Renderer) clearFallback() bool {
+	if self.fallbackStrand == nil { return false }
+	self.fallbackStrand = nil
+	return true
+}
+
+// Returns the updated color and offsets after the active strand
+// changes due to fallbacks.
+func (self *Renderer) refreshFallbackDrawParams(pass DrawPass, rgba [4]float32, offsetX, offsetY int) ([4]float32, int, int) {
+	switch pass {
+	case MainDrawPass:
+		if self.run.twineContents != nil {
+			rgba = self.twineOperator.MainColor()
+		} else {
+			rgba = self.strandMainColor(self.Strand())
+		}
+	case ShadowDrawPass:
+		rgba, offsetX, offsetY = self.strandShadowParams(self.Strand())
+	default:
+		// nothing to refresh
+	}
+	return rgba, offsetX, offsetY
+}
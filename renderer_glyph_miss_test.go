@@ -0,0 +1,139 @@
+package ptxt
+
+import "image"
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+import "github.com/tinne26/ptxt/internal"
+
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
+func TestGlyphMissPolicy(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+	renderer.SetScale(2)
+	widthAB, heightAB := renderer.Measure("AB")
+
+	// default policy panics (separate strand, as the panic
+	// leaves the mapping in the middle of an operation)
+	func() {
+		defer func() {
+			if recover() == nil { t.Fatal("expected panic on missing glyph") }
+		}()
+		panicStrand, _ := NewStrand(testFont)
+		panicRenderer := NewRenderer()
+		panicRenderer.SetStrand(panicStrand)
+		panicRenderer.Measure("AñB")
+	}()
+
+	xB, _, _ := renderer.CaretAt(0, 0, 1)
+
+	// skip
+	renderer.Advanced().SetGlyphMissPolicy(GlyphMissSkip)
+	width, height := renderer.Measure("AñB")
+	if width != widthAB || height != heightAB {
+		t.Fatalf("expected skipped glyph measure %dx%d, got %dx%d", widthAB, heightAB, width, height)
+	}
+	x, _, _ := renderer.CaretAt(0, 0, 3) // 'B' after the two-byte 'ñ'
+	if x != xB {
+		t.Fatalf("expected caret at %d after skipped glyph, got %d", xB, x)
+	}
+
+	// standard notdef (the test font has no "notdef" glyph)
+	for _, policy := range []GlyphMissPolicy{ GlyphMissNotdef, GlyphMissEmptyRect } {
+		renderer.Advanced().SetGlyphMissPolicy(policy)
+		var drawn []ggfnt.GlyphIndex
+		renderer.Advanced().SetDrawFunc(
+			func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+				drawn = append(drawn, glyphIndex)
+				if renderer.Advanced().LoadMask(glyphIndex) == nil {
+					t.Fatalf("%s: nil mask for glyph %d", policy, glyphIndex)
+				}
+			},
+		)
+		renderer.Draw(nil, "AñB", 0, 0)
+		if len(drawn) != 3 || drawn[1] != internal.NotdefGlyph {
+			t.Fatalf("%s: unexpected drawn glyphs %v", policy, drawn)
+		}
+		notdefWidth, _ := notdefSize(testFont)
+		interspacing := strandFullGlyphInterspacing(strand)
+		width, _ = renderer.Measure("AñB")
+		if width != widthAB + (notdefWidth + interspacing)*2 {
+			t.Fatalf("%s: unexpected measure width %d", policy, width)
+		}
+		renderer.Advanced().SetDrawFunc(nil)
+	}
+
+	// uppercase fallback (dotless i maps to I)
+	renderer.Advanced().SetGlyphMissPolicy(GlyphMissPanic | GlyphMissTryUppercase)
+	widthI, _ := renderer.Measure("I")
+	width, _ = renderer.Measure("ı")
+	if width != widthI {
+		t.Fatalf("expected uppercase fallback width %d, got %d", widthI, width)
+	}
+	if renderer.Advanced().GetGlyphMissPolicy().String() != "GlyphMissPanic|GlyphMissTryUppercase" {
+		t.Fatalf("unexpected policy string %s", renderer.Advanced().GetGlyphMissPolicy())
+	}
+}
+
+func TestStrandFallbacks(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// build a small fallback font with a single 'ñ' glyph
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(0)
+	uid, err := fontBuilder.AddGlyph(image.NewAlpha(image.Rect(0, -4, 6, 0)))
+	if err != nil { t.Fatal(err) }
+	err = fontBuilder.Map('ñ', uid)
+	if err != nil { t.Fatal(err) }
+	fallbackFont, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+
+	// create strands and renderer
+	strand, _ := NewStrand(testFont)
+	fallback, _ := NewStrand(fallbackFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+	widthAB, heightAB := renderer.Measure("AB")
+	strand.Mapping().SetFallbacks(fallback)
+
+	// measuring (the interspacing after 'ñ' comes from the fallback font)
+	width, height := renderer.Measure("AñB")
+	if width != widthAB + 6 || height != heightAB {
+		t.Fatalf("expected fallback measure %dx%d, got %dx%d", widthAB + 6, heightAB, width, height)
+	}
+
+	// drawing
+	var fromFallback []bool
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			fromFallback = append(fromFallback, renderer.Strand() == fallback)
+		},
+	)
+	renderer.Draw(nil, "AñB", 0, 0)
+	if len(fromFallback) != 3 || fromFallback[0] || !fromFallback[1] || fromFallback[2] {
+		t.Fatalf("unexpected fallback strands while drawing %v", fromFallback)
+	}
+	if renderer.Strand() != strand {
+		t.Fatal("expected main strand to be restored after drawing")
+	}
+
+	// invalid fallbacks
+	func() {
+		defer func() {
+			if recover() == nil { t.Fatal("expected panic on self-referencing fallback") }
+		}()
+		strand.Mapping().SetFallbacks(strand)
+	}()
+}
@@ -0,0 +1,173 @@
+package ptxt
+
+import "strings"
+import "unicode"
+import "unicode/utf8"
+
+import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ptxt/strand"
+import "github.com/tinne26/ggfnt"
+
+// Hyphenators find the points where words can be split with a hyphen
+// when wrapping lines. See [RendererAdvanced.SetHyphenator]().
+type Hyphenator interface {
+	// Appends the byte offsets where the given word can be split to
+	// the given slice, and returns the resulting slice. Offsets must
+	// be in increasing order and fall on rune boundaries. Offsets of
+	// zero or len(word) are ignored.
+	AppendSplits(splits []int, word string) []int
+}
+
+// A simple [Hyphenator] based on a list of words with their split
+// points marked by hyphens:
+//   var dict ptxt.HyphenDictionary
+//   dict.Add("Donau-dampf-schiff-fahrt", "Ge-sell-schaft")
+//   renderer.Advanced().SetHyphenator(&dict)
+// Lookups ignore case as long as lowercasing doesn't change the
+// length of the word. Words not in the dictionary aren't split.
+type HyphenDictionary struct {
+	splits map[string][]int
+}
+
+// Adds the given words to the dictionary, with their split points
+// marked by hyphens. Words that were already present are replaced.
+func (self *HyphenDictionary) Add(words ...string) {
+	if self.splits == nil { self.splits = make(map[string][]int) }
+	var plain []byte
+	for _, word := range words {
+		var splits []int
+		plain = plain[ : 0]
+		for i := 0; i < len(word); i++ {
+			if word[i] == '-' {
+				splits = append(splits, len(plain))
+			} else {
+				plain = append(plain, word[i])
+			}
+		}
+		self.splits[string(plain)] = splits
+		lower := strings.ToLower(string(plain))
+		if len(lower) == len(plain) { self.splits[lower] = splits }
+	}
+}
+
+// Implements [Hyphenator].
+func (self *HyphenDictionary) AppendSplits(splits []int, word string) []int {
+	wordSplits, found := self.splits[word]
+	if !found {
+		lower := strings.ToLower(word)
+		if len(lower) == len(word) { wordSplits = self.splits[lower] }
+	}
+	return append(splits, wordSplits...)
+}
+
+// Hyphenation points are computed right after converting the text
+// to glyphs, and they are left on renderer.run.glyphIndices as single
+// internal.SoftHyphenGlyph control glyphs. Layout considers them as
+// wrap points with the width of the hyphen glyph included, and lines
+// wrapped at them are recorded on renderer.run.hyphenWraps so the
+// hyphen can be drawn. Inserted hyphens are not reported as glyphs on
+// RendererAdvanced.EachGlyphLayout(), and the Vertical direction
+// ignores hyphenation points.
+
+// A rune within a word being hyphenated.
+type hyphenRune struct {
+	offset int // byte offset within the word
+	end int // glyph index after the rune's glyphs
+}
+
+// Side effects: updates renderer.run.glyphIndices and glyphSources,
+// adding internal.SoftHyphenGlyph glyphs where the hyphenator allows.
+// The runeAt function must behave like in computeRuleBreaks().
+func (self *Renderer) insertSoftHyphens(runeAt func(offset int) (rune, bool)) {
+	if self.hyphenator == nil { return }
+
+	// find words and their split points
+	word, runes := self.run.hyphenWord[ : 0], self.run.hyphenRunes[ : 0]
+	splits, inserts := self.run.hyphenSplits[ : 0], self.run.hyphenInserts[ : 0]
+	flushWord := func() {
+		if len(runes) > 1 {
+			splits = self.hyphenator.AppendSplits(splits[ : 0], string(word))
+			k := 1
+			for _, split := range splits {
+				for k < len(runes) && runes[k].offset < split { k += 1 }
+				if k == len(runes) { break }
+				if runes[k].offset == split {
+					inserts = append(inserts, uint16(runes[k - 1].end))
+				}
+			}
+		}
+		word, runes = word[ : 0], runes[ : 0]
+	}
+
+	prevSource := -1
+	for index := 0; index < len(self.run.glyphIndices); index++ {
+		glyphIndex := self.run.glyphIndices[index]
+		if !isDrawableGlyph(glyphIndex) {
+			switch glyphIndex {
+			case internal.FallbackGlyph:
+				if len(runes) > 0 && runes[len(runes) - 1].end == index {
+					runes[len(runes) - 1].end = index + 2
+				}
+				index += 1 // skip fallback index
+			case internal.TwineEffectMarkerGlyph:
+				index += 1 // skip directive offset
+			default:
+				flushWord()
+				prevSource = -1
+			}
+			continue
+		}
+
+		source := int(self.run.glyphSources[index])
+		if source == prevSource { // same rune sequence
+			if len(runes) > 0 { runes[len(runes) - 1].end = index + 1 }
+			continue
+		}
+		prevSource = source
+		codePoint, found := runeAt(source)
+		if !found || !(unicode.IsLetter(codePoint) || unicode.IsMark(codePoint)) {
+			flushWord()
+			continue
+		}
+		runes = append(runes, hyphenRune{ offset: len(word), end: index + 1 })
+		word = utf8.AppendRune(word, codePoint)
+	}
+	flushWord()
+	self.run.hyphenWord, self.run.hyphenRunes = word, runes
+	self.run.hyphenSplits, self.run.hyphenInserts = splits, inserts
+	if len(inserts) == 0 { return }
+
+	// expand glyph indices and sources, filling them from the end
+	numGlyphs := len(self.run.glyphIndices)
+	if numGlyphs + len(inserts) > 32000 {
+		panic("text run exceeding 32k glyph indices")
+	}
+	for range inserts {
+		self.run.glyphIndices = append(self.run.glyphIndices, internal.SoftHyphenGlyph)
+		self.run.glyphSources = append(self.run.glyphSources, 0)
+	}
+	target := len(self.run.glyphIndices)
+	for i := len(inserts) - 1; i >= 0; i-- {
+		insertAt := int(inserts[i])
+		for index := numGlyphs - 1; index >= insertAt; index-- {
+			target -= 1
+			self.run.glyphIndices[target] = self.run.glyphIndices[index]
+			self.run.glyphSources[target] = self.run.glyphSources[index]
+		}
+		numGlyphs = insertAt
+		target -= 1
+		self.run.glyphIndices[target] = internal.SoftHyphenGlyph
+		self.run.glyphSources[target] = self.run.glyphSources[insertAt + i + 1]
+	}
+}
+
+// Returns the hyphen glyph of the given strand, or false if its font
+// maps neither U+2010 nor '-'.
+func strandHyphenGlyph(fontStrand *strand.Strand) (ggfnt.GlyphIndex, bool) {
+	settings := fontStrand.UnderlyingSettingsCache().UnsafeSlice()
+	mapping := fontStrand.Font().Mapping()
+	group, found := mapping.Utf8('‐', settings)
+	if !found { group, found = mapping.Utf8('-', settings) }
+	if !found || group.Size() == 0 { return ggfnt.GlyphMissing, false }
+	return group.Select(0), true
+}
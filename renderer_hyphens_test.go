@@ -0,0 +1,94 @@
+package ptxt
+
+import "image"
+import "testing"
+import "image/color"
+
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
+func TestHyphenation(t *testing.T) {
+	// build a small font with 4 pixel wide letters and a 2 pixel wide hyphen
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(0)
+	for _, codePoint := range []rune{ 'a', 'b', 'c', 'd', '-' } {
+		width := 4
+		if codePoint == '-' { width = 2 }
+		uid, err := fontBuilder.AddGlyph(image.NewAlpha(image.Rect(0, -4, width, 0)))
+		if err != nil { t.Fatal(err) }
+		err = fontBuilder.Map(codePoint, uid)
+		if err != nil { t.Fatal(err) }
+	}
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+
+	// create strand and renderer
+	fontStrand, err := NewStrand(font)
+	if err != nil { t.Fatal(err) }
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+	_, twoLinesHeight := renderer.Measure("a\na")
+
+	// without hyphenation, the word is cut at the last glyph that fits
+	width, height := renderer.MeasureWithWrap("abcd", 12)
+	if width != 12 || height != twoLinesHeight {
+		t.Fatalf("expected 12x%d without hyphenation, got %dx%d", twoLinesHeight, width, height)
+	}
+
+	// dictionary
+	var dict HyphenDictionary
+	dict.Add("ab-cd")
+	splits := dict.AppendSplits(nil, "Abcd")
+	if len(splits) != 1 || splits[0] != 2 {
+		t.Fatalf("unexpected dictionary splits %v", splits)
+	}
+	renderer.Advanced().SetHyphenator(&dict)
+
+	// measuring
+	width, height = renderer.MeasureWithWrap("abcd", 12)
+	if width != 10 || height != twoLinesHeight {
+		t.Fatalf("expected 10x%d with hyphenation, got %dx%d", twoLinesHeight, width, height)
+	}
+	width, height = renderer.MeasureWithWrap("abcd", 9) // hyphen doesn't fit
+	if width != 8 || height != twoLinesHeight {
+		t.Fatalf("expected 8x%d with hyphenation, got %dx%d", twoLinesHeight, width, height)
+	}
+	width, _ = renderer.MeasureWithWrap("abcd", 16) // no wrapping
+	if width != 16 {
+		t.Fatalf("expected width 16 without wrapping, got %d", width)
+	}
+
+	// drawing
+	hyphen, _ := strandHyphenGlyph(fontStrand)
+	var drawn []ggfnt.GlyphIndex
+	var drawnX []int
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawn = append(drawn, glyphIndex)
+			drawnX = append(drawnX, params.X)
+		},
+	)
+	renderer.DrawWithWrap(nil, "abcd", 0, 0, 12)
+	if len(drawn) != 5 || drawn[2] != hyphen || drawnX[2] != 8 || drawnX[3] != 0 {
+		t.Fatalf("unexpected drawn glyphs %v at %v", drawn, drawnX)
+	}
+	drawn = drawn[ : 0]
+	renderer.DrawWithWrap(nil, "abcd", 0, 0, 16)
+	if len(drawn) != 4 {
+		t.Fatalf("expected no hyphen without wrapping, got %v", drawn)
+	}
+	renderer.Advanced().SetDrawFunc(nil)
+
+	// twines (directives don't interrupt words)
+	twine := Weave("ab", color.RGBA{255, 0, 0, 255}, "cd", Pop)
+	width, height = renderer.Twine().MeasureWithWrap(twine, 12)
+	if width != 10 || height != twoLinesHeight {
+		t.Fatalf("expected twine measure 10x%d, got %dx%d", twoLinesHeight, width, height)
+	}
+}
@@ -0,0 +1,100 @@
+package ptxt
+
+import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ptxt/strand"
+import "github.com/tinne26/ggfnt"
+
+// Justification is applied after the regular layout computation,
+// by increasing the advances of the relevant glyphs on each wrapped
+// line. This way, drawing, measuring and glyph layout operations
+// don't need to know anything about justification. Lines are only
+// justified if they are followed by more glyphs on the same paragraph,
+// so wrapped lines immediately followed by a line break (which gets
+// absorbed by the wrap) are left as they are.
+
+// Precondition: the run layout has been computed for a non Vertical
+// direction. Side effects: updates renderer.run.advances,
+// renderer.run.lineLengths and renderer.run.right.
+func (self *Renderer) justifyRunLayout(maxLineLen int) {
+	if len(self.run.wrapIndices) == 0 { return } // no wrapped lines
+
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
+	var wrapTemps drawWrapTempVariables
+	wrapTemps.Init(self)
+
+	points := self.run.justifyPoints[ : 0]
+	var lineIndex, validPoints int
+	var lineHasContent bool
+	pendingLine := -1
+	for index := 0; index < len(self.run.glyphIndices); index++ {
+		// line wrap case
+		if wrapTemps.IsLineWrapIndex(index) {
+			elide := wrapTemps.WrapTypeIsElide()
+			pendingLine, points = lineIndex, points[ : validPoints]
+			lineIndex += 1
+			lineHasContent, validPoints = false, 0
+			wrapTemps.Update(self)
+			if elide { continue }
+		}
+
+		glyphIndex := self.run.glyphIndices[index]
+		if isDrawableGlyph(glyphIndex) {
+			wrapTemps.NotifyNonBreak()
+			if pendingLine != -1 { // previous line confirmed as wrapped within a paragraph
+				self.justifyLine(pendingLine, maxLineLen, points)
+				pendingLine, points = -1, points[ : 0]
+			}
+			_ = self.syncGlyphFallback(index)
+			// leading and trailing spaces are never stretched
+			isSpace := self.Strand().CanWrap(glyphIndex, strand.WrapElide)
+			if !isSpace {
+				validPoints = len(points)
+				lineHasContent = true
+			}
+			if lineHasContent && (isSpace || self.justifyInterspacing) {
+				points = append(points, uint16(index))
+			}
+		} else {
+			switch glyphIndex {
+			case ggfnt.GlyphNewLine:
+				if !wrapTemps.AbsorbLineBreak() {
+					lineIndex += 1
+				}
+				pendingLine, points = -1, points[ : 0]
+				lineHasContent, validPoints = false, 0
+			case internal.TabGlyph: // text before tabs is never stretched
+				points, validPoints = points[ : 0], 0
+			case internal.FallbackGlyph:
+				index += 1 // skip fallback index
+			case internal.TwineEffectMarkerGlyph:
+				index += 1 // skip directive offset
+				_ = self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+			}
+		}
+	}
+	_ = self.clearFallback()
+	if twining { self.twineOperator.End() }
+	self.run.justifyPoints = points
+}
+
+// Spreads the leftover width of the given line across the advances
+// of the glyphs at the given indices.
+func (self *Renderer) justifyLine(lineIndex int, maxLineLen int, points []uint16) {
+	if len(points) == 0 { return }
+	lineLen := int(self.run.lineLengths[lineIndex])
+	extra := maxLineLen - lineLen
+	if extra <= 0 || maxLineLen > 65535 { return }
+
+	spread, remainder := extra/len(points), extra % len(points)
+	for i, index := range points {
+		advance := int(self.run.advances[index]) + spread
+		if i < remainder { advance += 1 }
+		if advance > 65535 { panic("advance > 65535") } // discretional assertion
+		self.run.advances[index] = uint16(advance)
+	}
+	self.run.lineLengths[lineIndex] = uint16(maxLineLen)
+	if self.run.left + maxLineLen > self.run.right {
+		self.run.right = self.run.left + maxLineLen
+	}
+}
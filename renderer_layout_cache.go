@@ -0,0 +1,204 @@
+package ptxt
+
+import "bytes"
+import "slices"
+
+import "github.com/tinne26/ptxt/strand"
+
+// Enables memoizing the glyphs and layout of the last n different
+// texts drawn or measured with [Renderer.Draw](), [Renderer.DrawWithWrap](),
+// [Renderer.Measure]() or [Renderer.MeasureWithWrap](). When the same
+// text is used again with the same configuration, the cached layout
+// is loaded directly, skipping glyph mapping and layout computations.
+// This is useful for labels and other static text drawn every frame.
+// Zero disables the cache, which is the default.
+//
+// Cached layouts are keyed by the text, the active strand, its settings,
+// interspacing shifts and wrap rules, its fallback strands and their
+// settings, interspacing shifts and wrap rules, and the renderer's scale,
+// direction, align, bounding mode, line wrapping length and other layout
+// options. Texts are never cached for strands with glyph pickers
+// (including fallback strands), as glyph selection could change on each
+// draw, nor for strands with more than 4 fallbacks. Some changes are not detected, and require calling
+// [RendererAdvanced.ClearLayoutCache]() manually:
+//  - Changes to the wrap glyphs or rewrite rules of a strand.
+//  - Changes to the contents of the hyphenator, like adding words to a
+//    [HyphenDictionary] after [RendererAdvanced.SetHyphenator]().
+// Pagination through [Renderer.AppendPages]() doesn't use the cache.
+//
+// When the cache is full, the least recently used layout is evicted.
+// Eviction is linear on the cache size, so small caches are preferable.
+func (self *RendererAdvanced) SetLayoutCacheSize(n int) {
+	if n < 0 { panic("negative layout cache size") }
+	self.layoutCache.capacity = n
+	for len(self.layoutCache.entries) > n { self.layoutCache.evict() }
+}
+
+// Returns the maximum number of cached layouts. See
+// [RendererAdvanced.SetLayoutCacheSize]().
+func (self *RendererAdvanced) GetLayoutCacheSize() int {
+	return self.layoutCache.capacity
+}
+
+// Removes all the layouts from the layout cache. See
+// [RendererAdvanced.SetLayoutCacheSize]().
+func (self *RendererAdvanced) ClearLayoutCache() {
+	clear(self.layoutCache.entries)
+}
+
+// Max number of fallback strands for cacheable texts.
+const layoutCacheMaxFallbacks = 4
+
+type layoutCacheKey struct {
+	text string
+	strand *strand.Strand
+	fallbacks [layoutCacheMaxFallbacks]*strand.Strand
+	settingsHash uint64 // see layoutCache.keyBuffer
+	glyphInterspacing int8
+	lineInterspacing int8
+	wrapRules strand.WrapRules
+	scale uint8
+	direction Direction
+	align Align
+	boundingMode BoundingMode
+	maxLineLen int
+	glyphMissPolicy GlyphMissPolicy
+	parBreakEnabled bool
+	justifyInterspacing bool
+	tabSpaces int
+}
+
+type layoutCacheEntry struct {
+	run textRun
+	lastUse uint64
+	settings []byte // keyBuffer contents for the key, to rule out hash collisions
+}
+
+// Least recently used cache for text layouts. Options that can't be
+// keyed cheaply, like tab stops or the hyphenator, clear the cache
+// when changed instead.
+type layoutCache struct {
+	entries map[layoutCacheKey]*layoutCacheEntry
+	capacity int
+	tick uint64
+	keyBuffer []byte // settings, shifts and wrap rules of the fallbacks, then the main strand settings
+}
+
+func (self *layoutCache) evict() {
+	var oldestKey layoutCacheKey
+	var oldest *layoutCacheEntry
+	for key, entry := range self.entries {
+		if oldest == nil || entry.lastUse < oldest.lastUse {
+			oldestKey, oldest = key, entry
+		}
+	}
+	if oldest != nil { delete(self.entries, oldestKey) }
+}
+
+// Returns the cache key for the given text and the current renderer
+// configuration, or false if the text can't be cached. The strand
+// settings are only hashed, with the full data left on keyBuffer to
+// be checked by loadCachedLayout() and stored by storeCachedLayout().
+// Building the key doesn't allocate.
+func (self *Renderer) layoutCacheKey(text string, maxLineLen int) (layoutCacheKey, bool) {
+	if self.layoutCache.capacity == 0 { return layoutCacheKey{}, false }
+	fontStrand := self.strands[self.strandIndex]
+	if fontStrand.GlyphPickers().Count() > 0 { return layoutCacheKey{}, false }
+	fallbacks := fontStrand.Mapping().GetFallbacks()
+	if len(fallbacks) > layoutCacheMaxFallbacks { return layoutCacheKey{}, false }
+
+	var keyFallbacks [layoutCacheMaxFallbacks]*strand.Strand
+	buffer := self.layoutCache.keyBuffer[ : 0]
+	for i, fallback := range fallbacks {
+		if fallback.GlyphPickers().Count() > 0 { return layoutCacheKey{}, false }
+		keyFallbacks[i] = fallback
+		settings := fallback.UnderlyingSettingsCache().UnsafeSlice()
+		buffer = append(buffer, uint8(len(settings)), uint8(len(settings) >> 8))
+		buffer = append(buffer, settings...)
+		buffer = append(buffer, uint8(fallback.GlyphInterspacingShift()), uint8(fallback.LineInterspacingShift()))
+		buffer = append(buffer, uint8(fallback.GetWrapRules()))
+	}
+	buffer = append(buffer, fontStrand.UnderlyingSettingsCache().UnsafeSlice()...)
+	self.layoutCache.keyBuffer = buffer
+
+	return layoutCacheKey{
+		text: text,
+		strand: fontStrand,
+		fallbacks: keyFallbacks,
+		settingsHash: layoutCacheHash(buffer),
+		glyphInterspacing: fontStrand.GlyphInterspacingShift(),
+		lineInterspacing: fontStrand.LineInterspacingShift(),
+		wrapRules: fontStrand.GetWrapRules(),
+		scale: self.scale,
+		direction: self.direction,
+		align: self.align,
+		boundingMode: self.boundingMode,
+		maxLineLen: maxLineLen,
+		glyphMissPolicy: self.glyphMissPolicy,
+		parBreakEnabled: self.parBreakEnabled,
+		justifyInterspacing: self.justifyInterspacing,
+		tabSpaces: self.tabSpaces,
+	}, true
+}
+
+// FNV-1a hash.
+func layoutCacheHash(data []byte) uint64 {
+	hash := uint64(14695981039346656037)
+	for _, b := range data {
+		hash ^= uint64(b)
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// Loads the cached layout for the given key into renderer.run, if
+// present. Returns whether the layout was found. The key must have
+// been just created with layoutCacheKey().
+func (self *Renderer) loadCachedLayout(key layoutCacheKey) bool {
+	entry, found := self.layoutCache.entries[key]
+	if !found || !bytes.Equal(entry.settings, self.layoutCache.keyBuffer) { return false }
+	self.layoutCache.tick += 1
+	entry.lastUse = self.layoutCache.tick
+	self.run.loadLayout(&entry.run)
+	return true
+}
+
+// Stores the layout in renderer.run on the cache. The key must have
+// been created with layoutCacheKey() before computing the layout.
+func (self *Renderer) storeCachedLayout(key layoutCacheKey) {
+	if self.layoutCache.entries == nil {
+		self.layoutCache.entries = make(map[layoutCacheKey]*layoutCacheEntry, self.layoutCache.capacity)
+	}
+	_, replacing := self.layoutCache.entries[key] // (hash collisions)
+	if !replacing && len(self.layoutCache.entries) >= self.layoutCache.capacity { self.layoutCache.evict() }
+	self.layoutCache.tick += 1
+	self.layoutCache.entries[key] = &layoutCacheEntry{
+		run: self.run.cloneLayout(),
+		lastUse: self.layoutCache.tick,
+		settings: slices.Clone(self.layoutCache.keyBuffer),
+	}
+}
+
+// Copies the run data from a cloned layout into the run buffers.
+// See textRun.cloneLayout().
+func (self *textRun) loadLayout(layout *textRun) {
+	self.left, self.right, self.top, self.bottom = layout.left, layout.right, layout.top, layout.bottom
+	self.glyphIndices = append(self.glyphIndices[ : 0], layout.glyphIndices...)
+	self.glyphSources = append(self.glyphSources[ : 0], layout.glyphSources...)
+	self.sourceLen = layout.sourceLen
+	self.lineLengths = append(self.lineLengths[ : 0], layout.lineLengths...)
+	self.lineIndents = append(self.lineIndents[ : 0], layout.lineIndents...)
+	self.lineLefts = append(self.lineLefts[ : 0], layout.lineLefts...)
+	self.advances = append(self.advances[ : 0], layout.advances...)
+	self.horzShifts = append(self.horzShifts[ : 0], layout.horzShifts...)
+	self.kernings = append(self.kernings[ : 0], layout.kernings...)
+	self.wrapIndices = append(self.wrapIndices[ : 0], layout.wrapIndices...)
+	self.lineAdvances = append(self.lineAdvances[ : 0], layout.lineAdvances...)
+	self.twineContents = nil
+	self.firstRowAscent = layout.firstRowAscent
+	self.lastRowDescent = layout.lastRowDescent
+	self.isMultiline = layout.isMultiline
+	self.hyphenWraps = append(self.hyphenWraps[ : 0], layout.hyphenWraps...)
+	self.bidiLevels = append(self.bidiLevels[ : 0], layout.bidiLevels...)
+	self.bidiPositions = append(self.bidiPositions[ : 0], layout.bidiPositions...)
+}
@@ -0,0 +1,147 @@
+package ptxt
+
+import "image"
+import "slices"
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
+func TestLayoutCache(t *testing.T) {
+	// build a small font with 4 pixel wide letters and a 2 pixel wide space
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(1)
+	for _, codePoint := range []rune{ 'a', 'b', ' ' } {
+		width := 4
+		if codePoint == ' ' { width = 2 }
+		mask := image.NewAlpha(image.Rect(0, -4, width, 0))
+		for i := range mask.Pix { mask.Pix[i] = 255 }
+		uid, err := fontBuilder.AddGlyph(mask)
+		if err != nil { t.Fatal(err) }
+		err = fontBuilder.Map(codePoint, uid)
+		if err != nil { t.Fatal(err) }
+	}
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+
+	// create strand and renderer
+	fontStrand, err := NewStrand(font)
+	if err != nil { t.Fatal(err) }
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+	var drawn []GlyphLayout
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawn = append(drawn, GlyphLayout{ GlyphIndex: glyphIndex, X: params.X, Y: params.Y, Scale: params.Scale })
+		},
+	)
+
+	// get uncached results
+	text := "ab ab\nba"
+	drawn = drawn[ : 0]
+	renderer.DrawWithWrap(nil, text, 3, 7, 12)
+	expected := slices.Clone(drawn)
+	width, height := renderer.MeasureWithWrap(text, 12)
+	renderer.SetScale(2)
+	width2, height2 := renderer.MeasureWithWrap(text, 12)
+	renderer.SetScale(1)
+
+	// cached results must match
+	renderer.Advanced().SetLayoutCacheSize(2)
+	for i := 0; i < 3; i++ {
+		drawn = drawn[ : 0]
+		renderer.DrawWithWrap(nil, text, 3, 7, 12)
+		if !slices.Equal(drawn, expected) {
+			t.Fatalf("draw #%d: expected %v, got %v", i, expected, drawn)
+		}
+		if w, h := renderer.MeasureWithWrap(text, 12); w != width || h != height {
+			t.Fatalf("measure #%d: expected %dx%d, got %dx%d", i, width, height, w, h)
+		}
+	}
+	if len(renderer.layoutCache.entries) != 1 {
+		t.Fatalf("expected 1 cached layout, got %d", len(renderer.layoutCache.entries))
+	}
+
+	// cached layouts must be used
+	for _, entry := range renderer.layoutCache.entries { entry.run.right += 100 }
+	if w, _ := renderer.MeasureWithWrap(text, 12); w != width + 100 {
+		t.Fatalf("expected cached layout to be used")
+	}
+	for _, entry := range renderer.layoutCache.entries { entry.run.right -= 100 }
+
+	// configuration changes can't reuse cached layouts
+	renderer.SetScale(2)
+	if w, h := renderer.MeasureWithWrap(text, 12); w != width2 || h != height2 {
+		t.Fatalf("expected %dx%d at scale 2, got %dx%d", width2, height2, w, h)
+	}
+	renderer.SetScale(1)
+	if w, _ := renderer.MeasureWithWrap(text, 100); w == width {
+		t.Fatalf("expected different width without wrapping")
+	}
+	if len(renderer.layoutCache.entries) != 2 {
+		t.Fatalf("expected 2 cached layouts, got %d", len(renderer.layoutCache.entries))
+	}
+
+	// least recently used layouts are evicted
+	_, _ = renderer.MeasureWithWrap(text, 12)
+	_, _ = renderer.Measure("ab")
+	key, _ := renderer.layoutCacheKey(text, 12)
+	if _, found := renderer.layoutCache.entries[key]; !found || len(renderer.layoutCache.entries) != 2 {
+		t.Fatalf("unexpected layout cache eviction")
+	}
+
+	// fallback strand changes can't reuse cached layouts
+	fallback, err := NewStrand(buildTestFont(t, newTestFontBuilder(t, []rune{ 'ñ' }, nil)))
+	if err != nil { t.Fatal(err) }
+	fontStrand.Mapping().SetFallbacks(fallback)
+	key, _ = renderer.layoutCacheKey("añ", 12)
+	fallback.SetGlyphInterspacingShift(1)
+	if shiftedKey, _ := renderer.layoutCacheKey("añ", 12); shiftedKey == key {
+		t.Fatalf("expected fallback interspacing shift to change the cache key")
+	}
+	fallback.SetGlyphInterspacingShift(0)
+	key, _ = renderer.layoutCacheKey("añ", 12)
+	otherFallback, err := NewStrand(buildTestFont(t, newTestFontBuilder(t, []rune{ 'ñ' }, nil)))
+	if err != nil { t.Fatal(err) }
+	fontStrand.Mapping().SetFallbacks(otherFallback)
+	if swappedKey, _ := renderer.layoutCacheKey("añ", 12); swappedKey == key {
+		t.Fatalf("expected fallback strand swaps to change the cache key")
+	}
+
+	// building cache keys doesn't allocate
+	allocs := testing.AllocsPerRun(10, func() { _, _ = renderer.layoutCacheKey("añ", 12) })
+	if allocs != 0 {
+		t.Fatalf("expected no allocations for cache keys, got %v", allocs)
+	}
+	fontStrand.Mapping().SetFallbacks()
+
+	// pagination doesn't use the cache
+	var keys []layoutCacheKey
+	for key := range renderer.layoutCache.entries { keys = append(keys, key) }
+	_ = renderer.AppendPages(nil, "ab ab ab ab ab ab", 12, 5)
+	for _, key := range keys {
+		if _, found := renderer.layoutCache.entries[key]; !found {
+			t.Fatalf("expected pagination to leave the layout cache untouched")
+		}
+	}
+	if len(renderer.layoutCache.entries) != len(keys) || renderer.Advanced().GetLayoutCacheSize() != 2 {
+		t.Fatalf("expected pagination to leave the layout cache untouched")
+	}
+
+	// some options clear the cache
+	renderer.Advanced().SetTabStops()
+	if len(renderer.layoutCache.entries) != 0 {
+		t.Fatalf("expected layout cache to be cleared")
+	}
+	renderer.Advanced().SetLayoutCacheSize(0)
+	_, _ = renderer.Measure("ab")
+	if len(renderer.layoutCache.entries) != 0 {
+		t.Fatalf("expected layout cache to be disabled")
+	}
+}
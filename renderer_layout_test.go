@@ -0,0 +1,388 @@
+package ptxt
+
+import "bytes"
+import "image"
+import "image/color"
+import "slices"
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
+func TestEachGlyphLayout(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+	renderer.SetAlign(Center)
+
+	var drawn []GlyphLayout
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawn = append(drawn, GlyphLayout{ GlyphIndex: glyphIndex, X: params.X, Y: params.Y })
+		},
+	)
+
+	// layout origins must match draw origins in all directions
+	text := "AB\nCD EF"
+	maxLineLen, _ := renderer.Measure("CD E")
+	for _, dir := range []Direction{ Horizontal, Sideways, SidewaysRight } {
+		renderer.SetDirection(dir)
+		drawn = drawn[ : 0]
+		renderer.DrawWithWrap(nil, text, 8, 9, maxLineLen)
+		var layouts []GlyphLayout
+		renderer.Advanced().EachGlyphLayout(8, 9, func(layout GlyphLayout) {
+			layouts = append(layouts, layout)
+		})
+		if len(layouts) != len(drawn) || len(layouts) != 7 {
+			t.Fatalf("%s: expected %d glyph layouts, got %d", dir, len(drawn), len(layouts))
+		}
+		for i, layout := range layouts {
+			if layout.GlyphIndex != drawn[i].GlyphIndex || layout.X != drawn[i].X || layout.Y != drawn[i].Y {
+				t.Fatalf("%s: glyph #%d layout %+v not matching draw %+v", dir, i, layout, drawn[i])
+			}
+		}
+
+		// source offsets and lines
+		expectedOffsets := []int{ 0, 1, 3, 4, 5, 6, 7 }
+		expectedLines   := []int{ 0, 0, 1, 1, 1, 2, 2 }
+		for i, layout := range layouts {
+			if layout.SourceOffset != expectedOffsets[i] || layout.Line != expectedLines[i] {
+				t.Fatalf("%s: glyph #%d expected offset %d at line %d, got %+v", dir, i, expectedOffsets[i], expectedLines[i], layout)
+			}
+		}
+	}
+
+	// twines don't have source offsets
+	renderer.SetDirection(Horizontal)
+	renderer.Twine().Measure(Weave("AB"))
+	renderer.Advanced().EachGlyphLayout(0, 0, func(layout GlyphLayout) {
+		if layout.SourceOffset != -1 { t.Fatalf("expected no source offset for twine, got %d", layout.SourceOffset) }
+	})
+}
+
+func TestCaretAt(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+	renderer.SetScale(2)
+	ascent  := int(testFont.Metrics().Ascent())*2
+	descent := int(testFont.Metrics().Descent())*2
+
+	// basic horizontal positions
+	text := "AB\nCD"
+	widthA, _ := renderer.Measure("A")
+	widthAB, _ := renderer.Measure("AB")
+	renderer.Measure(text)
+	advanceA := widthAB - widthA // including interspacing
+	expected := [][2]int{ {10, 20}, {10 + advanceA, 20}, {10 + widthAB, 20}, {10, -1}, {10 + advanceA, -1} }
+	for offset, exp := range expected {
+		x, y, length := renderer.CaretAt(10, 20, offset)
+		if length != ascent + descent || x != exp[0] {
+			t.Fatalf("offset %d: unexpected caret (%d, %d, %d)", offset, x, y, length)
+		}
+		if exp[1] != -1 && y != exp[1] - ascent {
+			t.Fatalf("offset %d: expected caret y %d, got %d", offset, exp[1] - ascent, y)
+		}
+		if exp[1] == -1 && y <= 20 - ascent {
+			t.Fatalf("offset %d: expected caret on second line, got y = %d", offset, y)
+		}
+	}
+
+	// clamping and hit-testing outside the text
+	x, _, _ := renderer.CaretAt(10, 20, 99)
+	if x != 10 + widthAB || renderer.OffsetAt(10, 20, 999, 999) != len(text) {
+		t.Fatalf("unexpected clamped caret at x = %d", x)
+	}
+	if renderer.OffsetAt(10, 20, -99, -99) != 0 {
+		t.Fatal("expected offset zero for point before text")
+	}
+
+	// round trips with wrapping and aligns in all supported directions
+	text = "AB\n\nCD EF"
+	maxLineLen, _ := renderer.Measure("CD E")
+	renderer.SetAlign(Center)
+	for _, dir := range []Direction{ Horizontal, Sideways, SidewaysRight } {
+		renderer.SetDirection(dir)
+		renderer.MeasureWithWrap(text, maxLineLen)
+		for offset := 0; offset <= len(text); offset++ {
+			x, y, length := renderer.CaretAt(-5, 7, offset)
+			if dir == Horizontal { y += length/2 } else { x += length/2 }
+			hit := renderer.OffsetAt(-5, 7, x, y)
+			if hit != offset {
+				t.Fatalf("%s: offset %d caret at (%d, %d) hit-tested as offset %d", dir, offset, x, y, hit)
+			}
+		}
+	}
+
+	// twine offsets refer to the twine contents
+	renderer.SetDirection(Horizontal)
+	twine := Weave("A", color.RGBA{255, 0, 0, 255}, "B\nC", Pop, "D")
+	renderer.Measure("AB\nCD")
+	var expectedCarets [][3]int
+	for offset := 0; offset <= 5; offset++ {
+		x, y, length := renderer.CaretAt(-5, 7, offset)
+		expectedCarets = append(expectedCarets, [3]int{ x, y, length })
+	}
+	renderer.Twine().Measure(twine)
+	for i, char := range []byte("AB\nCD") {
+		offset := bytes.IndexByte(twine.contents, char)
+		x, y, length := renderer.CaretAt(-5, 7, offset)
+		if [3]int{ x, y, length } != expectedCarets[i] {
+			t.Fatalf("twine offset %d: expected caret %v, got %v", offset, expectedCarets[i], [3]int{ x, y, length })
+		}
+		if hit := renderer.OffsetAt(-5, 7, x, y + length/2); hit != offset {
+			t.Fatalf("twine offset %d hit-tested as offset %d", offset, hit)
+		}
+	}
+
+	// rewrite rules and fallbacks: "bc" is replaced by a single 'X'
+	// glyph, and 'ñ' comes from a taller fallback font
+	fontBuilder := newTestFontBuilder(t, []rune("abcX"), nil)
+	err := fontBuilder.AddSimpleUtf8RewriteRule('X', 'b', 'c')
+	if err != nil { t.Fatal(err) }
+	rewriteStrand, _ := NewStrand(buildTestFont(t, fontBuilder))
+	err = rewriteStrand.Mapping().AutoInitRewriteRules()
+	if err != nil { t.Fatal(err) }
+	rewriteStrand.Mapping().SetRewriteRulesEnabled(true)
+	fontBuilder = newTestFontBuilder(t, []rune{ 'ñ' }, nil)
+	fontBuilder.SetAscent(6)
+	fallbackStrand, _ := NewStrand(buildTestFont(t, fontBuilder))
+	rewriteStrand.Mapping().SetFallbacks(fallbackStrand)
+	renderer.SetStrand(rewriteStrand)
+	renderer.SetDirection(Horizontal)
+	renderer.SetAlign(Left | Baseline)
+	renderer.SetScale(1)
+	renderer.Measure("abcñ")
+	expected = [][2]int{ {0, 5}, {4, 5}, {4, 5}, {8, 7}, {8, 7}, {12, 7} } // x, length
+	for offset, exp := range expected {
+		x, _, length := renderer.CaretAt(0, 0, offset)
+		if x != exp[0] || length != exp[1] {
+			t.Fatalf("rewrite/fallback offset %d: expected caret x %d with length %d, got %d and %d", offset, exp[0], exp[1], x, length)
+		}
+	}
+
+	// vertical text, with 6 pixel wide columns and 4x4 glyphs
+	fontBuilder = newTestFontBuilder(t, []rune("ab "), nil)
+	fontBuilder.SetVertLayoutUsed(true)
+	err = fontBuilder.SetVertLineWidth(6)
+	if err != nil { t.Fatal(err) }
+	vertStrand, _ := NewStrand(buildTestFont(t, fontBuilder))
+	renderer.SetStrand(vertStrand)
+	renderer.SetDirection(Vertical)
+	renderer.SetAlign(Center)
+	text = "ab\n\nab ab"
+	renderer.MeasureWithWrap(text, 20)
+	prevY := -9999
+	for offset := 0; offset <= len(text); offset++ {
+		x, y, length := renderer.CaretAt(-5, 7, offset)
+		if length != 6 { t.Fatalf("Vertical: offset %d: expected caret length 6, got %d", offset, length) }
+		if offset == 1 && y <= prevY { t.Fatalf("Vertical: expected caret to move down, got y = %d after %d", y, prevY) }
+		prevY = y
+		hit := renderer.OffsetAt(-5, 7, x + length/2, y)
+		if hit != offset {
+			t.Fatalf("Vertical: offset %d caret at (%d, %d) hit-tested as offset %d", offset, x, y, hit)
+		}
+	}
+}
+
+func TestAppendSelectionRects(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+	renderer.SetScale(2)
+
+	// logical horizontal rects must match carets
+	renderer.Measure("AB\nCD")
+	rects := renderer.AppendSelectionRects(nil, 10, 20, 1, 4)
+	if len(rects) != 2 {
+		t.Fatalf("expected 2 selection rects, got %v", rects)
+	}
+	for i, offsets := range [][2]int{ {1, 2}, {3, 4} } {
+		x, y, length := renderer.CaretAt(10, 20, offsets[0])
+		endX, _, _ := renderer.CaretAt(10, 20, offsets[1])
+		if rects[i].Min.X != x || rects[i].Min.Y != y || rects[i].Max.Y != y + length || rects[i].Max.X > endX {
+			t.Fatalf("selection rect #%d %v not matching carets", i, rects[i])
+		}
+	}
+	if len(renderer.AppendSelectionRects(nil, 10, 20, 2, 3)) != 0 {
+		t.Fatal("expected no selection rects for line break only")
+	}
+
+	// twine offsets refer to the twine contents
+	twine := Weave("A", color.RGBA{255, 0, 0, 255}, "B\nC", Pop, "D")
+	renderer.Twine().Measure(twine)
+	start, end := bytes.IndexByte(twine.contents, 'B'), bytes.IndexByte(twine.contents, 'D')
+	twineRects := renderer.AppendSelectionRects(nil, 10, 20, start, end)
+	if !slices.Equal(twineRects, rects) {
+		t.Fatalf("expected twine selection rects %v, got %v", rects, twineRects)
+	}
+
+	// mask rects must be contained in logical rects
+	for _, dir := range []Direction{ Horizontal, Sideways, SidewaysRight } {
+		renderer.SetDirection(dir)
+		renderer.Advanced().SetBoundingMode(LogicalBounding)
+		renderer.Measure("AB\nCD")
+		logical := renderer.AppendSelectionRects(nil, 10, 20, 0, 5)
+		renderer.Advanced().SetBoundingMode(MaskBounding)
+		renderer.Measure("AB\nCD")
+		mask := renderer.AppendSelectionRects(nil, 10, 20, 5, 0)
+		if len(logical) != 2 || len(mask) != 2 {
+			t.Fatalf("%s: expected 2 logical and mask rects, got %v and %v", dir, logical, mask)
+		}
+		for i := range mask {
+			if mask[i].Empty() || !mask[i].In(logical[i]) {
+				t.Fatalf("%s: mask rect %v not in logical rect %v", dir, mask[i], logical[i])
+			}
+		}
+	}
+
+	// vertical text, with a 4x4 'a' and a 4x2 'b'
+	fontBuilder := newTestFontBuilder(t, []rune("ab"), map[rune]image.Point{ 'b': {4, 2} })
+	fontBuilder.SetVertLayoutUsed(true)
+	err := fontBuilder.SetVertLineWidth(6)
+	if err != nil { t.Fatal(err) }
+	vertStrand, _ := NewStrand(buildTestFont(t, fontBuilder))
+	renderer.SetStrand(vertStrand)
+	renderer.SetDirection(Vertical)
+	renderer.Advanced().SetBoundingMode(LogicalBounding)
+	renderer.Measure("ab\nab")
+	logical := renderer.AppendSelectionRects(nil, 10, 20, 0, 5)
+	if len(logical) != 2 || logical[0].Dx() != 12 || logical[1].Dx() != 12 || logical[0].Overlaps(logical[1]) {
+		t.Fatalf("Vertical: expected 2 separate 12 pixel wide logical rects, got %v", logical)
+	}
+	renderer.Advanced().SetBoundingMode(MaskBounding)
+	renderer.Measure("ab\nab")
+	mask := renderer.AppendSelectionRects(nil, 10, 20, 0, 5)
+	if len(mask) != 2 || !mask[0].In(logical[0]) || !mask[1].In(logical[1]) {
+		t.Fatalf("Vertical: mask rects %v not in logical rects %v", mask, logical)
+	}
+	mask = renderer.AppendSelectionRects(nil, 10, 20, 1, 2)
+	if len(mask) != 1 || mask[0].Dx() != 8 || mask[0].Dy() != 4 {
+		t.Fatalf("Vertical: expected a single 8x4 mask rect for 'b', got %v", mask)
+	}
+
+	// glyphs from fallback strands use their own masks and metrics
+	fontBuilder = newTestFontBuilder(t, []rune{ 'ñ' }, map[rune]image.Point{ 'ñ': {6, 4} })
+	fontBuilder.SetAscent(6)
+	fallbackStrand, _ := NewStrand(buildTestFont(t, fontBuilder))
+	vertStrand.Mapping().SetFallbacks(fallbackStrand)
+	renderer.SetDirection(Horizontal)
+	renderer.Measure("añ")
+	mask = renderer.AppendSelectionRects(nil, 0, 0, 1, 3)
+	if len(mask) != 1 || mask[0] != image.Rect(8, -8, 20, 0) {
+		t.Fatalf("expected fallback mask rect (8,-8)-(20,0), got %v", mask)
+	}
+	renderer.Advanced().SetBoundingMode(LogicalBounding)
+	renderer.Measure("añ")
+	logical = renderer.AppendSelectionRects(nil, 0, 0, 1, 3)
+	if len(logical) != 1 || logical[0].Min.Y != -12 || logical[0].Max.Y != 2 {
+		t.Fatalf("expected fallback logical rect from y = -12 to 2, got %v", logical)
+	}
+}
+
+func TestJustify(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+	renderer.SetScale(2)
+
+	// measure lines without justification
+	text := "A B CDEFGH\nA B"
+	lineWidth, _ := renderer.Measure("A B CDEFGH")
+	maxLineLen := lineWidth - 1
+	widthAB, _ := renderer.Measure("A B")
+	left, _ := renderer.MeasureWithWrap(text, maxLineLen)
+
+	lineRights := func() []int {
+		var rights []int
+		renderer.Advanced().EachGlyphLayout(0, 0, func(layout GlyphLayout) {
+			right := layout.X + layout.Advance
+			if layout.Line >= len(rights) {
+				rights = append(rights, right)
+			} else {
+				rights[layout.Line] = right
+			}
+		})
+		return rights
+	}
+
+	// only the wrapped line is stretched
+	renderer.SetAlign(Justify)
+	width, _ := renderer.MeasureWithWrap(text, maxLineLen)
+	if width != maxLineLen || width <= left {
+		t.Fatalf("expected justified width %d, got %d (left aligned %d)", maxLineLen, width, left)
+	}
+	rights := lineRights()
+	if len(rights) != 3 || rights[0] != maxLineLen || rights[2] != widthAB {
+		t.Fatalf("unexpected justified line ends %v (max line len %d, 'A B' width %d)", rights, maxLineLen, widthAB)
+	}
+
+	// lines without spaces are only stretched with interspacing enabled
+	text = "ABCDEFGHABCDEFGH"
+	lineWidth, _ = renderer.Measure("ABCDEFGH")
+	maxLineLen = lineWidth + 3
+	renderer.MeasureWithWrap(text, maxLineLen)
+	if rights = lineRights(); rights[0] != lineWidth {
+		t.Fatalf("expected line without spaces to end at %d, got %d", lineWidth, rights[0])
+	}
+	renderer.Advanced().SetJustifyInterspacingEnabled(true)
+	renderer.MeasureWithWrap(text, maxLineLen)
+	if rights = lineRights(); rights[0] != maxLineLen || rights[1] != lineWidth {
+		t.Fatalf("unexpected interspacing justified line ends %v", rights)
+	}
+	if renderer.GetAlign().String() != "(Baseline | Justify)" {
+		t.Fatalf("unexpected align string %s", renderer.GetAlign())
+	}
+}
+
+// --- helpers ---
+
+// Returns a builder for a small test font with ascent 4, descent 1 and
+// no interspacing, with a filled mask resting on the baseline for each
+// code point. Masks are 4x4 unless the code point has a different size
+// in 'sizes'. Tests can adjust the builder before calling buildTestFont().
+func newTestFontBuilder(t *testing.T, codePoints []rune, sizes map[rune]image.Point) *builder.Font {
+	t.Helper()
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(0)
+	for _, codePoint := range codePoints {
+		size, found := sizes[codePoint]
+		if !found { size = image.Pt(4, 4) }
+		mask := image.NewAlpha(image.Rect(0, -size.Y, size.X, 0))
+		for i := range mask.Pix { mask.Pix[i] = 255 }
+		uid, err := fontBuilder.AddGlyph(mask)
+		if err != nil { t.Fatal(err) }
+		err = fontBuilder.Map(codePoint, uid)
+		if err != nil { t.Fatal(err) }
+	}
+	return fontBuilder
+}
+
+func buildTestFont(t *testing.T, fontBuilder *builder.Font) *ggfnt.Font {
+	t.Helper()
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+	return font
+}
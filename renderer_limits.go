@@ -0,0 +1,271 @@
+package ptxt
+
+import "image"
+import "strings"
+import "unicode"
+
+import "github.com/tinne26/ptxt/core"
+import "github.com/tinne26/ptxt/strand"
+
+import "github.com/tinne26/ggfnt"
+
+// Like [Renderer.DrawWithWrap](), but text is truncated when it
+// would exceed 'maxLines' lines or 'maxHeight' pixels in height (as
+// reported by [Renderer.MeasureWithLimits]()). Zero or negative limits
+// are ignored. Truncated text ends with the renderer's ellipsis (see
+// [RendererAdvanced.SetEllipsis]()).
+//
+// The returned value is the byte offset of the source text where the
+// truncation happened, or -1 if the text was drawn in full. Spaces
+// right before the ellipsis are omitted.
+//
+// Text can't exceed 32k glyphs.
+func (self *Renderer) DrawWithLimits(target core.Target, text string, x, y int, maxLineLen, maxLines, maxHeight int) int {
+	cut := self.layoutWithLimits(strand.DrawPass, text, maxLineLen, maxLines, maxHeight)
+	x, y = self.computeTextOrigin(x, y)
+	self.drawText(target, x, y)
+	lnkFinishPass(self.Strand().Mapping(), strand.DrawPass)
+	return cut
+}
+
+// Like [Renderer.MeasureWithWrap](), but considering the truncation
+// applied by [Renderer.DrawWithLimits](). The returned cut is the byte
+// offset of the source text where the truncation happened, or -1 if
+// the text fits within the given limits.
+//
+// Text can't exceed 32k glyphs.
+func (self *Renderer) MeasureWithLimits(text string, maxLineLen, maxLines, maxHeight int) (width, height, cut int) {
+	cut = self.layoutWithLimits(strand.MeasurePass, text, maxLineLen, maxLines, maxHeight)
+	lnkFinishPass(self.Strand().Mapping(), strand.MeasurePass)
+	return self.run.right - self.run.left, self.run.bottom - self.run.top, cut
+}
+
+// A possible truncation point for Renderer.layoutWithLimits(),
+// right after a glyph of the full text layout. Lengths go along the
+// line direction, and "cross" values across lines, with lines going
+// down (see Renderer.limitCrossPos()).
+type limitCut struct {
+	end int // source offset right after the glyph
+	line int
+	lineLen int // length of the line up to the glyph
+	crossPos int // baseline or column position of the glyph's line
+	crossMin, crossMax int // extent of the text up to the glyph (unused for Vertical)
+	prevLinesLen int // max length of the previous lines (only used for Vertical)
+	upIndex int // last cut of the previous line if the glyph is part of a wrapped word, or -1
+}
+
+// Computes the run layout for the longest text prefix that fits the
+// given limits once the ellipsis is appended. The text is laid out in
+// full first, and the cut is then derived from its glyph positions and
+// the ellipsis size. The result is laid out again to confirm that it
+// fits, in which case that's also the final layout. If it doesn't fit
+// (e.g., due to kerning or rewrite rules with the ellipsis), the next
+// shorter cut is tried.
+//
+// The mapping pass is left open, the caller must finish it.
+func (self *Renderer) layoutWithLimits(pass strand.GlyphPickerPass, text string, maxLineLen, maxLines, maxHeight int) int {
+	if self.Strand() == nil {
+		panic("ptxt.Renderer can't operate with a nil strand... maybe someone forgot to Renderer.SetStrand()?")
+	}
+	mapping := self.Strand().Mapping()
+
+	// full text case
+	self.layoutLimitsAttempt(mapping, pass, text, maxLineLen)
+	if self.fitsLimits(maxLines, maxHeight) { return -1 }
+
+	// collect cuts from the full text layout, then measure the ellipsis
+	cuts := self.collectLimitCuts()
+	lnkFinishPass(mapping, pass)
+	self.layoutLimitsAttempt(mapping, pass, self.ellipsis, maxInt32)
+	ellipsisLen, ellipsisCrossMin, ellipsisCrossMax := self.limitsEllipsisExtents()
+
+	// try the longest cuts that should fit. truncated words that had
+	// been wrapped may now fit at the end of the previous line
+	lastPrefixLen := -1
+	for i := len(cuts) - 1; i >= 0; i-- {
+		cut := &cuts[i]
+		fits := self.limitCutFits(cut, cut.lineLen + ellipsisLen, ellipsisCrossMin, ellipsisCrossMax, maxLineLen, maxLines, maxHeight)
+		if !fits && cut.upIndex != -1 {
+			up := &cuts[cut.upIndex]
+			fits = self.limitCutFits(up, up.lineLen + cut.lineLen + ellipsisLen, ellipsisCrossMin, ellipsisCrossMax, maxLineLen, maxLines, maxHeight)
+		}
+		if !fits { continue }
+
+		prefix := strings.TrimRightFunc(text[ : cut.end], unicode.IsSpace)
+		if len(prefix) == lastPrefixLen || len(prefix) == 0 { continue }
+		lastPrefixLen = len(prefix)
+		lnkFinishPass(mapping, pass)
+		self.layoutLimitsAttempt(mapping, pass, prefix + self.ellipsis, maxLineLen)
+		if self.fitsLimits(maxLines, maxHeight) { return len(prefix) }
+	}
+
+	// nothing fits, try the ellipsis on its own
+	lnkFinishPass(mapping, pass)
+	self.layoutLimitsAttempt(mapping, pass, self.ellipsis, maxLineLen)
+	if self.fitsLimits(maxLines, maxHeight) { return 0 }
+	lnkFinishPass(mapping, pass)
+	self.layoutLimitsAttempt(mapping, pass, "", maxLineLen)
+	return 0
+}
+
+// Returns whether the text up to the given cut, with the ellipsis
+// and a line of the given length, is expected to fit the limits.
+func (self *Renderer) limitCutFits(cut *limitCut, lineLen, ellipsisCrossMin, ellipsisCrossMax int, maxLineLen, maxLines, maxHeight int) bool {
+	if maxLines > 0 && cut.line >= maxLines { return false }
+	if lineLen > maxLineLen { return false }
+	if maxHeight <= 0 { return true }
+	if self.direction == Vertical {
+		return max(cut.prevLinesLen, lineLen) <= maxHeight
+	}
+	crossMin := min(cut.crossMin, cut.crossPos + ellipsisCrossMin)
+	crossMax := max(cut.crossMax, cut.crossPos + ellipsisCrossMax)
+	return crossMax - crossMin <= maxHeight
+}
+
+// Collects the possible cuts of the last laid out text into
+// run.limitCuts, which is also returned.
+func (self *Renderer) collectLimitCuts() []limitCut {
+	cuts := self.run.limitCuts[ : 0]
+	line, lineStart, linePen, prevLinesLen := -1, 0, 0, 0
+	textExtent := pageLine{ lengthMin: 0, lengthMax: -1, crossMin: 0, crossMax: -1 }
+	if self.direction != Vertical {
+		// the text top doesn't change with the cut, and it can
+		// come from blank lines without glyph extents
+		ox, oy := self.computeTextOrigin(0, 0)
+		textExtent.crossMin = self.limitCrossPos(GlyphLayout{ X: ox, Y: oy }) + self.run.top
+		textExtent.crossMax = textExtent.crossMin
+	}
+	var afterNewLine, wrappedWord bool
+	self.eachGlyphLayout(0, 0, func(index int, layout GlyphLayout) {
+		if layout.GlyphIndex == ggfnt.GlyphNewLine { afterNewLine = true }
+		if !isDrawableGlyph(layout.GlyphIndex) { return }
+		if layout.Line != line {
+			prevLinesLen = max(prevLinesLen, linePen)
+			wrappedWord = (line != -1 && !afterNewLine && layout.Line == line + 1)
+			line, linePen = layout.Line, 0
+			if self.direction == Vertical { lineStart = self.glyphLogicalRect(self.Strand(), index, layout).Min.Y }
+		}
+		afterNewLine = false
+
+		// (the renderer strand is already the glyph's own strand here)
+		glyphStrand := self.Strand()
+		for mode := strand.WrapBefore; mode <= strand.WrapElide; mode++ {
+			if glyphStrand.CanWrap(layout.GlyphIndex, mode) { wrappedWord = false }
+		}
+		if self.direction == Vertical { // (column positions already include advances and kerning)
+			linePen = self.glyphLogicalRect(glyphStrand, index, layout).Max.Y - lineStart
+		} else {
+			linePen += int(self.run.kernings[index]) + layout.Advance
+		}
+		linePen += self.limitGlyphInterspacing(glyphStrand, layout)
+		glyphExtent := self.limitGlyphCrossExtent(glyphStrand, index, layout)
+		textExtent.include(&glyphExtent)
+		upIndex := -1
+		if wrappedWord {
+			upIndex = len(cuts) - 1
+			for upIndex >= 0 && cuts[upIndex].line == layout.Line { upIndex -= 1 }
+		}
+		cuts = append(cuts, limitCut{
+			end: self.nextGlyphSource(index),
+			line: layout.Line,
+			lineLen: linePen,
+			crossPos: self.limitCrossPos(layout),
+			crossMin: textExtent.crossMin,
+			crossMax: textExtent.crossMax,
+			prevLinesLen: prevLinesLen,
+			upIndex: upIndex,
+		})
+	})
+	self.run.limitCuts = cuts
+	return cuts
+}
+
+// Returns the length of the last laid out text (which must be the
+// ellipsis) for line wrapping purposes, and its extent across lines
+// relative to its baseline. With mask bounding, lines only wrap when
+// glyphs start beyond the line length limit, so the last glyph, its
+// kerning and the interspacing before it aren't included (except for
+// Vertical text, which wraps like with logical bounding).
+func (self *Renderer) limitsEllipsisExtents() (int, int, int) {
+	extent := pageLine{ lengthMin: 0, lengthMax: -1, crossMin: 0, crossMax: -1 }
+	var anchor, start, pen, prevEnd, end int
+	anchored := false
+	self.eachGlyphLayout(0, 0, func(index int, layout GlyphLayout) {
+		if !isDrawableGlyph(layout.GlyphIndex) { return }
+		if self.direction == Vertical {
+			rect := self.glyphLogicalRect(self.Strand(), index, layout)
+			if !anchored { start = rect.Min.Y }
+			end = rect.Max.Y - start
+		} else {
+			prevEnd = end
+			pen += int(self.run.kernings[index]) + layout.Advance
+			end = pen
+			pen += self.limitGlyphInterspacing(self.Strand(), layout)
+		}
+		if !anchored { anchored, anchor = true, self.limitCrossPos(layout) }
+		glyphExtent := self.limitGlyphCrossExtent(self.Strand(), index, layout)
+		extent.include(&glyphExtent)
+	})
+	if self.boundingMode & ^noDescent == MaskBounding && self.direction != Vertical { end = prevEnd }
+	if extent.crossMin > extent.crossMax { return end, 0, 0 }
+	return end, extent.crossMin - anchor, extent.crossMax - anchor
+}
+
+// Returns the scaled interspacing after the given glyph.
+func (self *Renderer) limitGlyphInterspacing(glyphStrand *strand.Strand, layout GlyphLayout) int {
+	if self.direction == Vertical {
+		return strandFullVertGlyphInterspacing(glyphStrand)*layout.Scale
+	}
+	return strandFullGlyphInterspacing(glyphStrand)*layout.Scale
+}
+
+// Returns the glyph extent across lines, based on the current bounding
+// mode. Glyphs without masks on mask bounding have an empty extent.
+func (self *Renderer) limitGlyphCrossExtent(glyphStrand *strand.Strand, index int, layout GlyphLayout) pageLine {
+	var rect image.Rectangle
+	if self.boundingMode & ^noDescent == MaskBounding {
+		rect = self.glyphMaskRect(glyphStrand, layout)
+	} else {
+		rect = self.glyphLogicalRect(glyphStrand, index, layout)
+	}
+	extent := pageLine{ lengthMin: 0, lengthMax: -1, crossMin: 0, crossMax: -1 }
+	if rect.Empty() { return extent }
+	if self.direction == Horizontal || self.direction == RightToLeft {
+		extent.crossMin, extent.crossMax = rect.Min.Y, rect.Max.Y
+	} else {
+		extent.crossMin, extent.crossMax = rect.Min.X, rect.Max.X
+	}
+
+	if self.direction == SidewaysRight { // (lines going down)
+		extent.crossMin, extent.crossMax = -extent.crossMax, -extent.crossMin
+	}
+	if self.boundingMode & noDescent != 0 {
+		extent.crossMax = max(extent.crossMin, min(extent.crossMax, self.limitCrossPos(layout)))
+	}
+	return extent
+}
+
+// Returns the glyph's baseline or column position across lines,
+// with lines going down.
+func (self *Renderer) limitCrossPos(layout GlyphLayout) int {
+	switch self.direction {
+	case Horizontal, RightToLeft : return layout.Y
+	case Sideways, Vertical      : return layout.X
+	case SidewaysRight           : return -layout.X
+	default:
+		panic("unexpected direction '" + self.direction.String() + "'")
+	}
+}
+
+func (self *Renderer) layoutLimitsAttempt(mapping *strand.StrandMapping, pass strand.GlyphPickerPass, text string, maxLineLen int) {
+	err := lnkBeginPass(mapping, pass, uint8(self.glyphMissPolicy))
+	if err != nil { panic(err) }
+	self.textToGlyphs(mapping, text)
+	self.computeRunLayout(maxLineLen)
+}
+
+func (self *Renderer) fitsLimits(maxLines, maxHeight int) bool {
+	if maxLines > 0 && len(self.run.lineLengths) > maxLines { return false }
+	if maxHeight > 0 && self.run.bottom - self.run.top > maxHeight { return false }
+	return true
+}
@@ -0,0 +1,116 @@
+package ptxt
+
+import "image"
+import "strings"
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+import "github.com/tinne26/ptxt/strand"
+
+import "github.com/tinne26/ggfnt"
+
+func TestLimits(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	fontStrand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+	renderer.SetScale(2)
+
+	// text within limits
+	text := "EXCALIBUR"
+	fullWidth, fullHeight := renderer.Measure(text)
+	width, height, cut := renderer.MeasureWithLimits(text, fullWidth, 1, fullHeight)
+	if width != fullWidth || height != fullHeight || cut != -1 {
+		t.Fatalf("expected %dx%d with no cut, got %dx%d with cut %d", fullWidth, fullHeight, width, height, cut)
+	}
+
+	// single line truncation
+	expectedWidth, _ := renderer.Measure("EXCAL...")
+	width, height, cut = renderer.MeasureWithLimits(text, expectedWidth, 1, 0)
+	if width != expectedWidth || height != fullHeight || cut != 5 {
+		t.Fatalf("expected %dx%d with cut 5, got %dx%d with cut %d", expectedWidth, fullHeight, width, height, cut)
+	}
+
+	// line and height limits, omitting spaces before the ellipsis
+	text = "AB CD\nEF GH\nIJ"
+	_, twoLinesHeight := renderer.Measure("AB CD\nEF GH")
+	expectedWidth, _ = renderer.Measure("AB CD\nEF GH...")
+	for _, limits := range [][2]int{ {2, 0}, {0, twoLinesHeight}, {3, twoLinesHeight} } {
+		width, height, cut = renderer.MeasureWithLimits(text, maxInt32, limits[0], limits[1])
+		if width != expectedWidth || height != twoLinesHeight || cut != 11 {
+			t.Fatalf("limits %v: expected %dx%d with cut 11, got %dx%d with cut %d", limits, expectedWidth, twoLinesHeight, width, height, cut)
+		}
+	}
+	_, _, cut = renderer.MeasureWithLimits("AB \nCD", maxInt32, 1, 0)
+	if cut != 2 { t.Fatalf("expected cut 2, got %d", cut) }
+
+	// drawing and custom ellipsis
+	var drawn int
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawn += 1
+		},
+	)
+	renderer.Advanced().SetEllipsis("")
+	cut = renderer.DrawWithLimits(nil, text, 0, 0, maxInt32, 1, 0)
+	if cut != 5 || drawn != 5 {
+		t.Fatalf("expected cut 5 with 5 glyphs drawn, got cut %d with %d glyphs drawn", cut, drawn)
+	}
+
+	// nothing fits
+	width, height, cut = renderer.MeasureWithLimits(text, maxInt32, 0, 1)
+	if width != 0 || height != 0 || cut != 0 {
+		t.Fatalf("expected empty measure with cut 0, got %dx%d with cut %d", width, height, cut)
+	}
+
+	// cuts at rune boundaries within long lines
+	fontBuilder := newTestFontBuilder(t, []rune("ñ."), map[rune]image.Point{ '.': {1, 1} })
+	dotStrand, _ := NewStrand(buildTestFont(t, fontBuilder))
+	renderer.SetStrand(dotStrand)
+	renderer.SetScale(1)
+	renderer.Advanced().SetEllipsis("...")
+	width, _, cut = renderer.MeasureWithLimits("ññññññññ", 20, 1, 0)
+	if width != 19 || cut != 8 {
+		t.Fatalf("expected width 19 with cut 8, got width %d with cut %d", width, cut)
+	}
+
+	// the ellipsis can fit on its own in tight boxes
+	renderer.Advanced().SetBoundingMode(MaskBounding)
+	width, height, cut = renderer.MeasureWithLimits("ññ", maxInt32, 0, 2)
+	if width != 3 || height != 1 || cut != 0 {
+		t.Fatalf("expected 3x1 ellipsis with cut 0, got %dx%d with cut %d", width, height, cut)
+	}
+
+	// long texts are not laid out again for each candidate cut
+	renderer.SetStrand(fontStrand)
+	renderer.SetScale(1)
+	renderer.Advanced().SetBoundingMode(LogicalBounding)
+	var picker testPassCountPicker
+	fontStrand.GlyphPickers().Add(&picker)
+	defer fontStrand.GlyphPickers().Pop()
+	text = strings.Repeat("EXCALIBUR", 100)
+	expectedWidth, _ = renderer.Measure("EXCALIBUREXC...")
+	picker.starts, picker.finishes = 0, 0
+	width, _, cut = renderer.MeasureWithLimits(text, expectedWidth, 1, 0)
+	if width != expectedWidth || cut != 12 {
+		t.Fatalf("expected width %d with cut 12, got width %d with cut %d", expectedWidth, width, cut)
+	}
+	if picker.starts != picker.finishes || picker.starts > 3 {
+		t.Fatalf("expected up to 3 balanced glyph picker passes, got %d starts and %d finishes", picker.starts, picker.finishes)
+	}
+}
+
+// Glyph picker that only counts pass notifications.
+type testPassCountPicker struct {
+	starts int
+	finishes int
+}
+
+func (self *testPassCountPicker) Pick(rune, uint8, ggfnt.AnimationFlags, int) uint8 { return 0 }
+func (self *testPassCountPicker) NotifyAddedGlyph(ggfnt.GlyphIndex, rune, uint8, ggfnt.AnimationFlags) {}
+func (self *testPassCountPicker) NotifyPass(pass strand.GlyphPickerPass, start bool) {
+	if start { self.starts += 1 } else { self.finishes += 1 }
+}
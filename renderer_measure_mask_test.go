@@ -1,8 +1,14 @@
 //go:build cputext
 package ptxt
 
+import "image"
 import "testing"
 
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
 func TestMeasureMask(t *testing.T) {
 	ensureTestAssetsLoaded()
 	if testFont == nil { t.SkipNow() }
@@ -107,3 +113,72 @@ func TestMeasureMask(t *testing.T) {
 		t.Fatalf("expected x4 scaling to result in x4 bounds, but got (%d, %d) vs (%d, %d)", sw1, sh1, sw4, sh4)
 	}
 }
+
+func TestMaskBoundsDirections(t *testing.T) {
+	// build a small font with a mask that doesn't start at the
+	// glyph origin and that goes below the baseline
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(6)
+	fontBuilder.SetDescent(2)
+	fontBuilder.SetUppercaseAscent(5)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(1)
+	mask := image.NewAlpha(image.Rect(1, -4, 4, 1))
+	for i := range mask.Pix { mask.Pix[i] = 255 }
+	uid, err := fontBuilder.AddGlyph(mask)
+	if err != nil { t.Fatal(err) }
+	err = fontBuilder.Map('a', uid)
+	if err != nil { t.Fatal(err) }
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+
+	// create strand and renderer, recording the union of drawn mask rects
+	fontStrand, err := NewStrand(font)
+	if err != nil { t.Fatal(err) }
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+	renderer.Advanced().SetBoundingMode(MaskBounding)
+	var drawn image.Rectangle
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			var rect image.Rectangle
+			bounds := mask.Bounds()
+			switch renderer.GetDirection() {
+			case Horizontal:
+				rect = bounds.Add(image.Pt(params.X, params.Y))
+			case Sideways:
+				rect = image.Rect(params.X + bounds.Min.Y, params.Y - bounds.Max.X, params.X + bounds.Max.Y, params.Y - bounds.Min.X)
+			case SidewaysRight:
+				rect = image.Rect(params.X - bounds.Max.Y, params.Y + bounds.Min.X, params.X - bounds.Min.Y, params.Y + bounds.Max.X)
+			}
+			drawn = drawn.Union(rect)
+		},
+	)
+
+	// drawn masks must match the measured text box exactly
+	const text = "aa\naaa"
+	for _, direction := range []Direction{ Horizontal, Sideways, SidewaysRight } {
+		renderer.SetDirection(direction)
+		w, h := renderer.Measure(text)
+		if w != 11 || h != 14 {
+			t.Fatalf("%s: expected mask bounds 11x14, got %dx%d", direction, w, h)
+		}
+		var expected [2]image.Rectangle // (Top | Left) and (Bottom | Right)
+		switch direction {
+		case Horizontal:
+			expected = [2]image.Rectangle{ image.Rect(0, 0, w, h), image.Rect(-w, -h, 0, 0) }
+		case Sideways:
+			expected = [2]image.Rectangle{ image.Rect(0, -w, h, 0), image.Rect(-h, 0, 0, w) }
+		case SidewaysRight:
+			expected = [2]image.Rectangle{ image.Rect(-h, 0, 0, w), image.Rect(0, -w, h, 0) }
+		}
+		for i, align := range []Align{ Top | Left, Bottom | Right } {
+			renderer.SetAlign(align)
+			drawn = image.Rectangle{}
+			renderer.Draw(nil, text, 0, 0)
+			if drawn != expected[i] {
+				t.Fatalf("%s, %s: expected masks at %v, got %v", direction, align, expected[i], drawn)
+			}
+		}
+	}
+}
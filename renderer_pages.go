@@ -0,0 +1,201 @@
+package ptxt
+
+import "github.com/tinne26/ptxt/strand"
+
+// Page boundaries within a source text or twine, as byte offsets.
+// See [Renderer.AppendPages]() and [RendererTwine.AppendPages]().
+type TextPage struct {
+	Start int // offset of the first glyph on the page
+	End int // offset right after the last glyph on the page
+}
+
+// A line of the last laid out text, for pagination purposes.
+// Positions are relative to the layout origin, with "length" along
+// the line direction and "cross" across lines.
+type pageLine struct {
+	start int // source offset of the first glyph, or -1 if none
+	end int // source offset after the last non-space glyph
+	blank bool // whether the line has no glyphs other than spaces
+	lengthMin, lengthMax int // line extent along the line direction
+	crossMin, crossMax int // glyph metrics extent across lines (empty if crossMin > crossMax)
+}
+
+// Splits the given text into pages that fit a box of the given size
+// with the renderer's current configuration, and appends them to the
+// given slice, which is then returned. Each page can then be drawn
+// on its own:
+//   page := pages[pageIndex]
+//   renderer.DrawWithWrap(target, text[page.Start : page.End], x, y, boxWidth)
+//
+// Pages only break at line wrapping points and line breaks, and they
+// never start nor end with blank lines. A page will still contain one
+// line even if that line doesn't fit the box on its own. For directions
+// other than [Horizontal] and [RightToLeft], lines wrap at 'boxHeight'
+// instead of 'boxWidth' (remember to adjust the wrap length when drawing
+// the pages too).
+//
+// The text is laid out only once, and pages are placed based on the
+// metrics of its wrapped lines. The renderer's buffered layout is left
+// with the full text. With [MaskBounding], pages can occasionally end
+// one line earlier than strictly necessary.
+func (self *Renderer) AppendPages(pages []TextPage, text string, boxWidth, boxHeight int) []TextPage {
+	// skip the layout cache, long scripts would evict useful layouts
+	// (twines don't need this, as their layouts are never cached)
+	cacheCapacity := self.layoutCache.capacity
+	self.layoutCache.capacity = 0
+	lineBoxLen, crossBoxLen := self.pageBoxLens(boxWidth, boxHeight)
+	_, _ = self.MeasureWithWrap(text, lineBoxLen)
+	self.layoutCache.capacity = cacheCapacity
+	return self.appendPages(pages, lineBoxLen, crossBoxLen)
+}
+
+// Like [Renderer.AppendPages](), but accepting a twine instead of a
+// string. Pages can be drawn with the help of [Twine.Excerpt]():
+//   page := pages[pageIndex]
+//   renderer.Twine().DrawWithWrap(target, twine.Excerpt(page.Start, page.End), x, y, boxWidth)
+func (self *RendererTwine) AppendPages(pages []TextPage, twine Twine, boxWidth, boxHeight int) []TextPage {
+	renderer := (*Renderer)(self)
+	lineBoxLen, crossBoxLen := renderer.pageBoxLens(boxWidth, boxHeight)
+	_, _ = self.MeasureWithWrap(twine, lineBoxLen)
+	return renderer.appendPages(pages, lineBoxLen, crossBoxLen)
+}
+
+// Returns the box lengths along and across lines.
+func (self *Renderer) pageBoxLens(boxWidth, boxHeight int) (int, int) {
+	if self.direction == Horizontal || self.direction == RightToLeft {
+		return boxWidth, boxHeight
+	}
+	return boxHeight, boxWidth
+}
+
+// Precondition: the full text has just been laid out with lineBoxLen
+// as the wrap length. Pages are built greedily, adding lines while the
+// page fits the box.
+func (self *Renderer) appendPages(pages []TextPage, lineBoxLen, crossBoxLen int) []TextPage {
+	lines := self.collectPageLines()
+	for k := 0; k < len(lines); {
+		if lines[k].blank { k += 1; continue }
+		page := TextPage{ Start: lines[k].start, End: lines[k].end }
+		extent := lines[k]
+		k += 1
+		for next := k; next < len(lines); next++ {
+			if lines[next].blank { continue }
+			extent.include(&lines[next])
+			if extent.lengthMax - extent.lengthMin > lineBoxLen || extent.crossMax - extent.crossMin > crossBoxLen { break }
+			page.End, k = lines[next].end, next + 1
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// Collects the source boundaries and extents of each line of the
+// last laid out text into run.pageLines, which is also returned.
+func (self *Renderer) collectPageLines() []pageLine {
+	lines := self.run.pageLines[ : 0]
+	vertLineWidth := int(self.Strand().Font().Metrics().VertLineWidth())*int(self.scale)
+	self.eachGlyphLayout(0, 0, func(index int, layout GlyphLayout) {
+		for len(lines) <= layout.Line {
+			lines = append(lines, self.newPageLine(len(lines)))
+		}
+		if !isDrawableGlyph(layout.GlyphIndex) { return }
+
+		// (the renderer strand is already the glyph's own
+		// strand here, even for fallback glyphs)
+		glyphStrand := self.Strand()
+		line := &lines[layout.Line]
+		if line.start == -1 { line.start = int(self.run.glyphSources[index]) }
+		if !glyphStrand.CanWrap(layout.GlyphIndex, strand.WrapElide) {
+			line.blank = false
+			line.end = self.nextGlyphSource(index)
+		}
+		glyphExtent := self.pageGlyphExtent(glyphStrand, index, layout, vertLineWidth)
+		line.include(&glyphExtent)
+	})
+	for len(lines) < len(self.run.lineLengths) { // trailing lines without glyphs
+		lines = append(lines, self.newPageLine(len(lines)))
+	}
+	self.run.pageLines = lines
+	return lines
+}
+
+// Expands the line extents to include the extents of the given line.
+func (self *pageLine) include(other *pageLine) {
+	if other.lengthMin <= other.lengthMax {
+		if self.lengthMin > self.lengthMax {
+			self.lengthMin, self.lengthMax = other.lengthMin, other.lengthMax
+		} else {
+			self.lengthMin, self.lengthMax = min(self.lengthMin, other.lengthMin), max(self.lengthMax, other.lengthMax)
+		}
+	}
+	if other.crossMin <= other.crossMax {
+		if self.crossMin > self.crossMax {
+			self.crossMin, self.crossMax = other.crossMin, other.crossMax
+		} else {
+			self.crossMin, self.crossMax = min(self.crossMin, other.crossMin), max(self.crossMax, other.crossMax)
+		}
+	}
+}
+
+// Line lengths are taken from the run, except for Vertical text with
+// mask bounding, where they are built from the glyph masks instead.
+func (self *Renderer) newPageLine(lineIndex int) pageLine {
+	line := pageLine{ start: -1, blank: true, lengthMin: 0, lengthMax: -1, crossMin: 0, crossMax: -1 }
+	if self.boundingMode & ^noDescent == MaskBounding && self.direction == Vertical { return line }
+	lineLen := int(self.run.lineLengths[lineIndex])
+	if self.direction == Vertical {
+		line.lengthMin, line.lengthMax = 0, lineLen
+	} else {
+		line.lengthMin = self.run.lineLefts[lineIndex]
+		line.lengthMax = line.lengthMin + lineLen
+	}
+	return line
+}
+
+// Returns the extents of the given glyph. Only the cross extent is
+// set, based on the strand's vertical metrics (or the column width for
+// Vertical text), except with mask bounding, where the glyph mask is
+// used instead (including the length extent for Vertical text). Glyphs
+// without masks have empty extents on mask bounding.
+func (self *Renderer) pageGlyphExtent(glyphStrand *strand.Strand, index int, layout GlyphLayout, vertLineWidth int) pageLine {
+	extent := pageLine{ lengthMin: 0, lengthMax: -1, crossMin: 0, crossMax: -1 }
+	font := glyphStrand.Font()
+
+	// glyph position across lines, with lines going down
+	var crossPos int
+	switch self.direction {
+	case Horizontal, RightToLeft : crossPos = layout.Y
+	case Sideways, Vertical      : crossPos = layout.X
+	case SidewaysRight           : crossPos = -layout.X
+	default:
+		panic("unexpected direction '" + self.direction.String() + "'")
+	}
+
+	// logical bounding case
+	if self.boundingMode & ^noDescent != MaskBounding {
+		if self.direction == Vertical { // (column center minus half the column width)
+			extent.crossMin = crossPos + int(self.run.horzShifts[index]) - (vertLineWidth >> 1)
+			extent.crossMax = extent.crossMin + vertLineWidth
+			return extent
+		}
+		extent.crossMin = crossPos - int(font.Metrics().Ascent())*layout.Scale
+		extent.crossMax = crossPos
+		if self.boundingMode & noDescent == 0 {
+			extent.crossMax += int(font.Metrics().Descent())*layout.Scale
+		}
+		return extent
+	}
+
+	// mask bounding case
+	mask := self.loadMask(layout.GlyphIndex, font)
+	if mask == nil || mask.Bounds().Empty() { return extent }
+	bounds := mask.Bounds()
+	if self.direction == Vertical {
+		extent.lengthMin, extent.lengthMax = layout.Y + bounds.Min.Y*layout.Scale, layout.Y + bounds.Max.Y*layout.Scale
+		extent.crossMin, extent.crossMax = crossPos + bounds.Min.X*layout.Scale, crossPos + bounds.Max.X*layout.Scale
+		return extent
+	}
+	extent.crossMin, extent.crossMax = crossPos + bounds.Min.Y*layout.Scale, crossPos + bounds.Max.Y*layout.Scale
+	if self.boundingMode & noDescent != 0 { extent.crossMax = min(extent.crossMax, crossPos) }
+	return extent
+}
@@ -0,0 +1,68 @@
+package ptxt
+
+import "bytes"
+import "testing"
+import "image/color"
+
+import "github.com/tinne26/ggfnt"
+
+func TestAppendPages(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+	renderer.SetScale(2)
+
+	// text pages, skipping blank lines between them
+	text := "AB CD EF\n\n\nGH IJ"
+	boxWidth, _ := renderer.Measure("AB CD")
+	_, boxHeight := renderer.Measure("AB\nEF")
+	pages := renderer.AppendPages(nil, text, boxWidth, boxHeight)
+	expected := []TextPage{ {0, 8}, {11, 16} }
+	if len(pages) != len(expected) || pages[0] != expected[0] || pages[1] != expected[1] {
+		t.Fatalf("expected pages %v, got %v", expected, pages)
+	}
+	for _, page := range pages {
+		_, height := renderer.MeasureWithWrap(text[page.Start : page.End], boxWidth)
+		if height > boxHeight {
+			t.Fatalf("page %q height %d exceeds box height %d", text[page.Start : page.End], height, boxHeight)
+		}
+	}
+
+	// sideways pages wrap at the box height and stack lines along the box width
+	renderer.SetDirection(Sideways)
+	pages = renderer.AppendPages(pages[ : 0], text, boxHeight, boxWidth)
+	renderer.SetDirection(Horizontal)
+	if len(pages) != len(expected) || pages[0] != expected[0] || pages[1] != expected[1] {
+		t.Fatalf("expected sideways pages %v, got %v", expected, pages)
+	}
+
+	// lines that don't fit the box still get their own page
+	pages = renderer.AppendPages(pages[ : 0], text, boxWidth, 1)
+	if len(pages) != 3 || pages[1] != (TextPage{6, 8}) {
+		t.Fatalf("unexpected single line pages %v", pages)
+	}
+
+	// twine pages and excerpts
+	rgba := color.RGBA{255, 0, 0, 255}
+	twine := Weave(rgba, text, Pop)
+	pages = renderer.Twine().AppendPages(pages[ : 0], twine, boxWidth, boxHeight)
+	expected = []TextPage{ {6, 14}, {17, 22} }
+	if len(pages) != len(expected) || pages[0] != expected[0] || pages[1] != expected[1] {
+		t.Fatalf("expected twine pages %v, got %v", expected, pages)
+	}
+	excerpt := twine.Excerpt(pages[1].Start, pages[1].End)
+	if !bytes.Equal(excerpt.contents, Weave(rgba, "GH IJ").contents) {
+		t.Fatalf("unexpected twine excerpt %v", excerpt.contents)
+	}
+
+	// excerpts splitting raw glyphs
+	twine = Weave([]ggfnt.GlyphIndex{ 1, 2, 3 }, "A")
+	excerpt = twine.Excerpt(6, len(twine.contents))
+	if !bytes.Equal(excerpt.contents, Weave([]ggfnt.GlyphIndex{ 2, 3 }, "A").contents) {
+		t.Fatalf("unexpected raw glyphs excerpt %v", excerpt.contents)
+	}
+}
@@ -3,6 +3,7 @@ package ptxt
 import "image"
 
 import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ptxt/strand"
 import "github.com/tinne26/ggfnt"
 
 // Helper methods for drawing and measuring.
@@ -49,11 +50,9 @@ func (self *Renderer) computeTextOrigin(x, y int) (int, int) {
 		shift = -self.run.bottom
 		if self.direction == Vertical { shift = 0 } // done per line on computeVertLineStart
 	case LastBaseline:
-		if self.direction == Vertical { // TODO: maybe I want to define this
-			panic("Vertical rendering doesn't support LastBaseline align")
-		}
-
-		if self.run.isMultiline { // multi-line text
+		if self.direction == Vertical {
+			shift = 0 // done per line on computeVertLineStart
+		} else if self.run.isMultiline { // multi-line text
 			shift = -(self.run.bottom - self.run.lastRowDescent)
 		} else { // single line text, last baseline == first baseline
 			shift = 0
@@ -63,12 +62,13 @@ func (self *Renderer) computeTextOrigin(x, y int) (int, int) {
 	}
 
 	switch self.direction {
-	case Horizontal    : return x, y + shift
+	case Horizontal, RightToLeft : return x, y + shift
 	case Vertical:
 		switch self.align.Horz() {
-		case Left       : x = x - self.run.left
+		case Left, Justify : x = x - self.run.left
 		case HorzCenter : x = x - ((self.run.right + self.run.left) >> 1)
 		case Right      : x = x - self.run.right
+		case HorzNeutral: // x is already the center of the first line
 		default:
 			panic(brokenCode)
 		}
@@ -80,14 +80,10 @@ func (self *Renderer) computeTextOrigin(x, y int) (int, int) {
 	}
 }
 
-// - I can have a uint16 to mark "twine effect", and then a
-//   second uint16 as the offset to it. but then maybe calling
-//   the buffer "run.glyphIndices" is not ideal. otherwise, I
-//   need to port everything to a twine model first, and operate
-//   only with the twine. I don't like that because even in the
-//   twine, when ligature replacements are needed, we can't
-//   modify the twine itself. so, we kinda always need that
-//   first conversion step. ok I guess.
+// Twine directives are left on run.glyphIndices as a pair formed by
+// internal.TwineEffectMarkerGlyph and the directive offset within the
+// twine contents (see Renderer.twineToGlyphs()). Both elements of the
+// pair get zero advance and kerning.
 
 // Spaces at the end of line are counted. They can be elided on wrap modes,
 // but not here.
@@ -97,7 +93,12 @@ func (self *Renderer) computeRunLayout(maxLineLen int) {
 	self.run.advances = setBufferSize(self.run.advances, len(self.run.glyphIndices))
 	self.run.kernings = setBufferSize(self.run.kernings, len(self.run.glyphIndices))
 	self.run.wrapIndices = self.run.wrapIndices[ : 0]
+	self.run.hyphenWraps = self.run.hyphenWraps[ : 0]
 	self.run.lineLengths = self.run.lineLengths[ : 0]
+	self.run.lineIndents = self.run.lineIndents[ : 0]
+	self.run.lineLefts = self.run.lineLefts[ : 0]
+	self.run.lineAdvances = self.run.lineAdvances[ : 0]
+	self.run.bidiPositions = self.run.bidiPositions[ : 0]
 	self.run.top, self.run.bottom, self.run.left, self.run.right = 0, 0, 0, 0
 	self.run.firstRowAscent = 0
 	self.run.lastRowDescent = 0
@@ -110,6 +111,7 @@ func (self *Renderer) computeRunLayout(maxLineLen int) {
 		switch self.boundingMode & ^noDescent {
 		case LogicalBounding:
 			self.computeVerticalRunLogicalLayout(maxLineLen)
+			self.computeVerticalRunColumnMetrics(false)
 		case MaskBounding:
 			self.computeVerticalRunMaskLayout(maxLineLen)
 		default:
@@ -124,8 +126,9 @@ func (self *Renderer) computeRunLayout(maxLineLen int) {
 		default:
 			panic(unexpectedBoundingMode)
 		}
+		if self.align.Horz() == Justify { self.justifyRunLayout(maxLineLen) }
+		self.computeBidiPositions()
 	}
-	
 }
 
 // Precondition: except glyph indices, run data has been cleared 
@@ -134,32 +137,33 @@ func (self *Renderer) computeRunLayout(maxLineLen int) {
 func (self *Renderer) computeRunLogicalLayout(maxLineLen int) {
 	if len(self.run.glyphIndices) > 32000 { panic(preViolation) }
 
-	currentStrand := self.Strand()
-	currentFont   := currentStrand.Font()
-	currentScale  := int(self.scale)
-	currentGlyphInterspacing := strandFullGlyphInterspacing(currentStrand)*currentScale
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
+	currentStrand, currentFont, currentScale, currentGlyphInterspacing := self.activeLayoutValues()
 	var layoutBreak layoutLineBreakTempVariables
-	layoutBreak.Init(strandFullLineHeight(currentStrand)*currentScale)
-	self.run.firstRowAscent = int(currentFont.Metrics().Ascent())*currentScale
-	self.run.top = -self.run.firstRowAscent
-	if self.boundingMode & noDescent == 0 {
-		self.run.lastRowDescent = int(currentFont.Metrics().Descent())*currentScale
-	}
+	layoutBreak.Init(self)
 
 	var prevEffectiveGlyph ggfnt.GlyphIndex = ggfnt.GlyphMissing
 	var prevInterspacing int
 	var x, index int
 	var layoutWrap layoutWrapTempVariables
+	var layoutTab layoutTabTempVariables
+	layoutTab.Init()
 	for index < len(self.run.glyphIndices) {
 		glyphIndex := self.run.glyphIndices[index]
-		if glyphIndex < ggfnt.MaxGlyphs {
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeLayoutValues()
+				layoutBreak.RefreshActiveMetrics(self)
+				prevEffectiveGlyph = ggfnt.GlyphMissing // no kerning across strands
+			}
 			layoutBreak.NotifyNonBreak()
 			layoutWrap.IncreaseLineCharCount()
 
 			memoX := x
-			kerning := int(currentFont.Kerning().Get(prevEffectiveGlyph, glyphIndex))*currentScale
+			kerning := self.horzKerning(currentFont, prevEffectiveGlyph, glyphIndex, index)*currentScale
 			self.run.kernings[index] = int16(kerning)
-			advance := int(currentFont.Glyphs().Advance(glyphIndex))*currentScale
+			advance := glyphAdvance(currentFont, glyphIndex)*currentScale
 			if advance < 0 || advance > 65535 { panic("advance > 65535") } // discretional assertion
 			self.run.advances[index] = uint16(advance)
 			x += prevInterspacing + kerning + advance
@@ -168,23 +172,41 @@ func (self *Renderer) computeRunLogicalLayout(maxLineLen int) {
 
 			// line wrapping pain
 			if x <= maxLineLen {
-				layoutWrap.GlyphNonBreak(currentStrand, glyphIndex, index, memoX, x)
+				if layoutWrap.GlyphNonBreak(self, currentStrand, glyphIndex, index, memoX, x) && twining {
+					if layoutWrap.lastWrapType == strand.WrapAfter { layoutBreak.IncludeActiveMetrics() }
+					layoutBreak.MemorizeLineMetrics()
+					self.twineOperator.MemorizeState()
+				}
+				layoutBreak.IncludeActiveMetrics()
 			} else {
-				index, x = layoutWrap.GlyphBreak(self, currentStrand, glyphIndex, index, memoX, x)
-				self.run.bottom = layoutBreak.NotifyBreak(self, 0, x, self.run.bottom)
-				x, prevInterspacing = 0, 0
+				var rewind bool
+				index, x, rewind = layoutWrap.GlyphBreak(self, currentStrand, glyphIndex, index, memoX, x)
+				if rewind && twining {
+					layoutBreak.RestoreLineMetrics()
+					if self.twineOperator.RestoreState() & (twineStrandChange | twineScaleChange) != 0 {
+						currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeLayoutValues()
+						layoutBreak.RefreshActiveMetrics(self)
+					}
+				}
+				layoutTab.NotifyWrap(index)
+				x += layoutTab.Resolve(self, x)
+				if twining { x += self.twineOperator.LineBreakPad() }
+				_ = layoutBreak.NotifyBreak(self, 0, x)
+				x, prevInterspacing = layoutBreak.StartLine(self, twining), 0
 				prevEffectiveGlyph = ggfnt.GlyphMissing
 				continue
 			}
 		} else { // control glyph
 			switch glyphIndex {
 			case ggfnt.GlyphNewLine:
-				if self.elideLineBreak(index) {
+				if layoutWrap.AbsorbLineBreak() {
 					// line break should be elided, absorbed by immediately previous line wrapping break
 				} else {
 					// apply break
-					self.run.bottom = layoutBreak.NotifyBreak(self, 0, x, self.run.bottom)
-					x, prevInterspacing = 0, 0
+					x += layoutTab.Resolve(self, x)
+					if twining { x += self.twineOperator.LineBreakPad() }
+					_ = layoutBreak.NotifyBreak(self, 0, x)
+					x, prevInterspacing = layoutBreak.StartLine(self, twining), 0
 					prevEffectiveGlyph = ggfnt.GlyphMissing
 					layoutWrap.PostBreakUpdate(index + 1)
 				}
@@ -195,15 +217,46 @@ func (self *Renderer) computeRunLogicalLayout(maxLineLen int) {
 			case ggfnt.GlyphZilch: // we don't change the prevEffectiveGlyph here
 				self.run.advances[index] = 0
 				self.run.kernings[index] = 0 
+			case internal.FallbackGlyph:
+				self.run.advances[index], self.run.kernings[index] = 0, 0
+				index += 1 // skip fallback index
+				self.run.advances[index], self.run.kernings[index] = 0, 0
 			case internal.TwineEffectMarkerGlyph:
-				panic("unimplemented")
-				// lineBreaksOnly = false // yes or no? it depends?
-				// prevEffectiveGlyph = glyphIndex
-				// TODO: whether this breaks or doesn't break prev effective glyph
-				// should probably depend on the effect. color changes shouldn't break
-				// anything. other effects might break. basically, effects with padding
-				// should break kerning, but maybe we want to leave it to the user,
-				// as some cases might be ambiguous
+				self.run.advances[index], self.run.kernings[index] = 0, 0
+				index += 1 // skip directive offset
+				self.run.advances[index], self.run.kernings[index] = 0, 0
+				changes := self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeLayoutValues()
+					layoutBreak.RefreshActiveMetrics(self)
+					prevEffectiveGlyph = ggfnt.GlyphMissing // no kerning across strands or scales
+				}
+				if changes & twineLineMetricsRefresh != 0 {
+					layoutBreak.IncludeActiveMetrics()
+				}
+				if self.layoutTwinePadding(index, changes, x + prevInterspacing) {
+					x += int(self.run.advances[index])
+					prevEffectiveGlyph = ggfnt.GlyphMissing
+				}
+			case internal.TabGlyph:
+				self.run.kernings[index] = 0
+				x += layoutTab.Resolve(self, x) + prevInterspacing
+				x += layoutTab.Tab(self, index, x, self.strands[self.strandIndex], currentScale)
+				prevInterspacing = 0
+				prevEffectiveGlyph = ggfnt.GlyphMissing
+			case internal.SoftHyphenGlyph: // hyphen taken from the strand of the previous glyph
+				self.run.advances[index], self.run.kernings[index] = 0, 0
+				hyphen, found := strandHyphenGlyph(currentStrand)
+				if found && layoutWrap.lineCharCount > 0 {
+					width := x + prevInterspacing + glyphAdvance(currentFont, hyphen)*currentScale
+					if width <= maxLineLen {
+						layoutWrap.HyphenNonBreak(index, width)
+						if twining {
+							layoutBreak.MemorizeLineMetrics()
+							self.twineOperator.MemorizeState()
+						}
+					}
+				}
 			default:
 				// ... some other control glyph, possibly a custom control glyph
 				// for the font or user code. we are not breaking kerning nor
@@ -214,9 +267,12 @@ func (self *Renderer) computeRunLogicalLayout(maxLineLen int) {
 		}
 		index += 1
 	}
+	if self.clearFallback() { layoutBreak.RefreshActiveMetrics(self) }
 
 	// take last x and descent into account
+	x += layoutTab.Resolve(self, x)
 	layoutBreak.NotifyTextEnd(self, x)
+	if twining { self.twineOperator.End() }
 }
 
 // Precondition: except glyph indices, run data has been cleared 
@@ -228,21 +284,27 @@ func (self *Renderer) computeRunMaskLayout(maxLineLen int) {
 	self.run.bottom = -9999
 	self.run.left   = +9999
 
-	currentStrand := self.Strand()
-	currentFont   := currentStrand.Font()
-	currentScale  := int(self.scale)
-	currentGlyphInterspacing := strandFullGlyphInterspacing(currentStrand)*currentScale
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
+	currentStrand, currentFont, currentScale, currentGlyphInterspacing := self.activeLayoutValues()
 	var layoutBreak layoutLineBreakTempVariables
-	layoutBreak.Init(strandFullLineHeight(currentStrand)*currentScale)
+	layoutBreak.Init(self)
+	var layoutMask layoutMaskTempVariables
 
 	var prevEffectiveGlyph ggfnt.GlyphIndex = ggfnt.GlyphMissing
 	var prevInterspacing, prevMaskRight, maskLeft int = 0, -9999, +9999
 	var x, y, index int
-	var firstNonEmptyLine uint8 // 0 for first non empty not reached, 1 for reached, 2 for exceeded
 	var layoutWrap layoutWrapTempVariables
+	var layoutTab layoutTabTempVariables
+	layoutTab.Init()
 	for index < len(self.run.glyphIndices) {
 		glyphIndex := self.run.glyphIndices[index]
-		if glyphIndex < ggfnt.MaxGlyphs {
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeLayoutValues()
+				layoutBreak.RefreshActiveMetrics(self)
+				prevEffectiveGlyph = ggfnt.GlyphMissing // no kerning across strands
+			}
 			layoutBreak.NotifyNonBreak()
 			layoutWrap.IncreaseLineCharCount()
 
@@ -256,57 +318,61 @@ func (self *Renderer) computeRunMaskLayout(maxLineLen int) {
 				}
 			}
 
-			kerning := int(currentFont.Kerning().Get(prevEffectiveGlyph, glyphIndex))*currentScale
+			kerning := self.horzKerning(currentFont, prevEffectiveGlyph, glyphIndex, index)*currentScale
 			self.run.kernings[index] = int16(kerning)
-			advance := int(currentFont.Glyphs().Advance(glyphIndex))*currentScale
+			advance := glyphAdvance(currentFont, glyphIndex)*currentScale
 			if advance < 0 || advance > 65535 { panic("advance > 65535") } // discretional assertion
 			self.run.advances[index] = uint16(advance)
 			maskRight := x + bounds.Max.X*currentScale + prevInterspacing + kerning
 			
 			// line wrapping pain
 			if x <= maxLineLen {
-				layoutWrap.GlyphNonBreak(currentStrand, glyphIndex, index, prevMaskRight, maskRight)
+				if layoutWrap.GlyphNonBreak(self, currentStrand, glyphIndex, index, prevMaskRight, maskRight) && twining {
+					if layoutWrap.lastWrapType == strand.WrapAfter { layoutBreak.IncludeActiveMetrics() }
+					layoutBreak.MemorizeLineMetrics()
+					self.twineOperator.MemorizeState()
+				}
+				layoutBreak.IncludeActiveMetrics()
 				if mask != nil {
-					if firstNonEmptyLine == 0 {
-						firstNonEmptyLine = 1
-						self.run.top = y // this is not correct here yet, but it's corrected with first line ascent later
-					}
-					if firstNonEmptyLine == 1 {
-						self.run.firstRowAscent = max(self.run.firstRowAscent, -bounds.Min.Y*currentScale)
-					}
-					if self.boundingMode & noDescent == 0 { // descent case
-						self.run.lastRowDescent = max(self.run.lastRowDescent, bounds.Max.Y*currentScale)
-					}
-					elevation := min(bounds.Max.Y*currentScale, 0)
-					self.run.bottom = max(self.run.bottom, y + elevation, y + elevation + self.run.lastRowDescent)
-					
+					layoutMask.NotifyMask(self, bounds, currentScale)
 					prevMaskRight = maskRight // this must stay inside this if
 				}
 				x += prevInterspacing + kerning + advance
 				prevInterspacing = currentGlyphInterspacing
 				prevEffectiveGlyph = glyphIndex
 			} else {
-				index, x = layoutWrap.GlyphBreak(self, currentStrand, glyphIndex, index, prevMaskRight, maskRight)
-				y = layoutBreak.NotifyBreak(self, maskLeft, x, y)
-				self.run.lastRowDescent = 0
-				x, prevInterspacing, prevMaskRight, maskLeft = 0, 0, -9999, 9999
+				var rewind bool
+				index, x, rewind = layoutWrap.GlyphBreak(self, currentStrand, glyphIndex, index, prevMaskRight, maskRight)
+				if rewind && twining {
+					layoutBreak.RestoreLineMetrics()
+					if self.twineOperator.RestoreState() & (twineStrandChange | twineScaleChange) != 0 {
+						currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeLayoutValues()
+						layoutBreak.RefreshActiveMetrics(self)
+					}
+				}
+				layoutTab.NotifyWrap(index)
+				x, maskLeft, _ = layoutTab.ResolveMask(self, x, maskLeft, prevMaskRight)
+				if twining { x += self.twineOperator.LineBreakPad() }
+				y = layoutBreak.NotifyBreak(self, maskLeft, x)
+				layoutMask.CloseLine(self, y)
+				x, prevInterspacing, prevMaskRight, maskLeft = layoutBreak.StartLine(self, twining), 0, -9999, 9999
 				prevEffectiveGlyph = ggfnt.GlyphMissing
-				if firstNonEmptyLine == 1 { firstNonEmptyLine = 2 }
 				continue
 			}
 		} else { // control glyph
 			switch glyphIndex {
 			case ggfnt.GlyphNewLine:
-				if self.elideLineBreak(index) {
+				if layoutWrap.AbsorbLineBreak() {
 					// line break should be elided, absorbed by immediately previous line wrapping break
 				} else {
 					// apply break
-					y = layoutBreak.NotifyBreak(self, maskLeft, prevMaskRight, y)
+					x, maskLeft, prevMaskRight = layoutTab.ResolveMask(self, x, maskLeft, prevMaskRight)
+					if twining { prevMaskRight += self.twineOperator.LineBreakPad() }
+					y = layoutBreak.NotifyBreak(self, maskLeft, prevMaskRight)
+					layoutMask.CloseLine(self, y)
 					layoutWrap.PostBreakUpdate(index + 1)
-					self.run.lastRowDescent = 0
-					x, prevInterspacing, prevMaskRight, maskLeft = 0, 0, -9999, 9999
+					x, prevInterspacing, prevMaskRight, maskLeft = layoutBreak.StartLine(self, twining), 0, -9999, 9999
 					prevEffectiveGlyph = ggfnt.GlyphMissing
-					if firstNonEmptyLine == 1 { firstNonEmptyLine = 2 }
 				}
 			case ggfnt.GlyphMissing:
 				// should typically be triggered at an earlier point,
@@ -315,8 +381,51 @@ func (self *Renderer) computeRunMaskLayout(maxLineLen int) {
 			case ggfnt.GlyphZilch: // we don't change the prevEffectiveGlyph here
 				self.run.advances[index] = 0
 				self.run.kernings[index] = 0 
+			case internal.FallbackGlyph:
+				self.run.advances[index], self.run.kernings[index] = 0, 0
+				index += 1 // skip fallback index
+				self.run.advances[index], self.run.kernings[index] = 0, 0
 			case internal.TwineEffectMarkerGlyph:
-				panic("unimplemented")
+				self.run.advances[index], self.run.kernings[index] = 0, 0
+				index += 1 // skip directive offset
+				self.run.advances[index], self.run.kernings[index] = 0, 0
+				changes := self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeLayoutValues()
+					layoutBreak.RefreshActiveMetrics(self)
+					prevEffectiveGlyph = ggfnt.GlyphMissing // no kerning across strands or scales
+				}
+				if changes & twineLineMetricsRefresh != 0 {
+					layoutBreak.IncludeActiveMetrics()
+				}
+				if self.layoutTwinePadding(index, changes, x + prevInterspacing) {
+					x += int(self.run.advances[index])
+					prevEffectiveGlyph = ggfnt.GlyphMissing
+				}
+			case internal.TabGlyph:
+				self.run.kernings[index] = 0
+				x, maskLeft, prevMaskRight = layoutTab.ResolveMask(self, x, maskLeft, prevMaskRight)
+				x += prevInterspacing
+				x += layoutTab.Tab(self, index, x, self.strands[self.strandIndex], currentScale)
+				layoutTab.NotifyMaskValues(maskLeft, prevMaskRight)
+				prevInterspacing = 0
+				prevEffectiveGlyph = ggfnt.GlyphMissing
+			case internal.SoftHyphenGlyph: // hyphen taken from the strand of the previous glyph
+				self.run.advances[index], self.run.kernings[index] = 0, 0
+				hyphen, found := strandHyphenGlyph(currentStrand)
+				if found && layoutWrap.lineCharCount > 0 {
+					var bounds image.Rectangle
+					mask := self.loadMask(hyphen, currentFont)
+					if mask != nil { bounds = mask.Bounds() }
+					maskRight := x + prevInterspacing + bounds.Max.X*currentScale
+					if maskRight <= maxLineLen {
+						layoutWrap.HyphenNonBreak(index, maskRight)
+						if twining {
+							layoutBreak.MemorizeLineMetrics()
+							self.twineOperator.MemorizeState()
+						}
+					}
+				}
 			default:
 				self.run.advances[index] = 0
 				self.run.kernings[index] = 0
@@ -324,33 +433,70 @@ func (self *Renderer) computeRunMaskLayout(maxLineLen int) {
 		}
 		index += 1
 	}
+	if self.clearFallback() { layoutBreak.RefreshActiveMetrics(self) }
 
 	// final adjustments
+	_, maskLeft, prevMaskRight = layoutTab.ResolveMask(self, x, maskLeft, prevMaskRight)
+	y, _ = layoutBreak.CloseLastLine(self)
+	layoutMask.CloseLine(self, y)
+	if twining { self.twineOperator.End() }
 	self.run.top -= self.run.firstRowAscent
 	self.run.left = min(self.run.left, maskLeft)
 	if prevMaskRight > self.run.right { self.run.right = prevMaskRight }
-	lineLen := self.run.right - self.run.left
+	lineLen := prevMaskRight - maskLeft
 	self.run.lineLengths = append(self.run.lineLengths, uint16(max(0, lineLen))) // TODO: big hack max
+	self.run.lineIndents = append(self.run.lineIndents, uint16(layoutBreak.lineIndent))
+	self.run.lineLefts = append(self.run.lineLefts, layoutBreak.LineLeft(maskLeft, prevMaskRight))
 	
 	self.run.bottom = max(self.run.bottom, self.run.top)
 	self.run.left   = min(self.run.right, self.run.left)
 }
 
+// Applies the padding for twine padders and line restart markers after
+// a directive, storing it as the advance of the directive offset at the
+// given index. Returns true if any padding has been applied.
+//
+// The given x must include any pending glyph interspacing, as that's
+// the position where the directive is reached while drawing.
+func (self *Renderer) layoutTwinePadding(index int, changes uint8, x int) bool {
+	if changes & (twinePadderPush | twinePadderPop | twineLineRestartMarker) == 0 { return false }
+	padding := self.twineOperator.ApplyPadding(changes, x)
+	if padding < 0 || padding > 65535 { panic("twine padding > 65535") } // discretional assertion
+	self.run.advances[index] = uint16(padding)
+	return padding > 0
+}
+
+// Returns the active strand, font, scale and scaled glyph interspacing.
+func (self *Renderer) activeLayoutValues() (*strand.Strand, *ggfnt.Font, int, int) {
+	fontStrand := self.Strand()
+	scale := int(self.scale)
+	return fontStrand, fontStrand.Font(), scale, strandFullGlyphInterspacing(fontStrand)*scale
+}
+
+// The line indent is already included. See run.lineIndents. With
+// mask bounding, left aligned lines are placed so the left of the text
+// box lands on the origin, while centered and right aligned lines use
+// their own mask bounds (see run.lineLefts).
 func (self *Renderer) computeLineStart(o int, lineIndex uint16) int {
-	switch self.align.Horz() {
-	case Left       : return o
-	case HorzCenter : return o - int(self.run.lineLengths[lineIndex] >> 1)
-	case Right      : return o - int(self.run.lineLengths[lineIndex])
+	indent, left := int(self.run.lineIndents[lineIndex]), self.run.lineLefts[lineIndex]
+	horzAlign := self.align.Horz()
+	if self.direction == RightToLeft {
+		switch horzAlign {
+		case HorzNeutral: // x is the right side of the text
+			horzAlign = Right
+		case Justify: // lines that are not stretched go to the right of the text box
+			return o + (self.run.right - self.run.left) - int(self.run.lineLengths[lineIndex]) - left + indent
+		}
+	}
+	switch horzAlign {
+	case Left, Justify, HorzNeutral : return o - self.run.left + indent
+	case HorzCenter : return o - int(self.run.lineLengths[lineIndex] >> 1) - left + indent
+	case Right      : return o - int(self.run.lineLengths[lineIndex]) - left + indent
 	default:
 		panic(brokenCode)
 	}
 }
 
-func (self *Renderer) elideLineBreak(index int) bool {
-	wrapsLen := len(self.run.wrapIndices)
-	return wrapsLen > 0 && (self.run.wrapIndices[wrapsLen - 1] & 0x7FFF) + 1 == uint16(index)
-}
-
 // Basically, if we are on the second line break and par break is enabled,
 // we either return half the height or none at all.
 func (self *Renderer) adjustParLineBreakHeightFor(lineBreakHeight, consecutiveLineBreaks int) int {
@@ -1,7 +1,25 @@
 package ptxt
 
-import "github.com/tinne26/ggfnt"
+import "math"
+
 import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ptxt/strand"
+
+import "github.com/tinne26/ggfnt"
+
+// Vertical text is laid out in columns ("lines"), going left to right.
+// While computing the layout, y coordinates are relative to the top of
+// the current column, which is placed firstRowAscent above the origin
+// for all aligns except VertCenter, Bottom and LastBaseline, where each
+// column is aligned independently (see computeVertLineStart()). The x
+// coordinates refer to the horizontal center of each column. Besides
+// lineLengths, run.lineAdvances stores the baseline of the last glyph
+// of each column, relative to its top, for LastBaseline aligns.
+//
+// Twines can change strands and scales mid-column, but column widths
+// always follow the renderer's strand and scale. Padders and line
+// restart markers work along the y axis, with run.lineIndents holding
+// the y where each column's first glyph starts.
 
 // Precondition: except glyph indices, run data has been cleared 
 // and slices resized to len(glyphIndices), and we have at least
@@ -9,41 +27,41 @@ import "github.com/tinne26/ptxt/internal"
 func (self *Renderer) computeVerticalRunLogicalLayout(maxLineLen int) {
 	if len(self.run.glyphIndices) > 32000 { panic(preViolation) }
 
-	currentStrand := self.Strand()
-	currentFont   := currentStrand.Font()
-	currentScale  := int(self.scale)
-	currentGlyphInterspacing := strandFullVertGlyphInterspacing(currentStrand)*currentScale
+	currentStrand, currentFont, currentScale, currentGlyphInterspacing := self.activeVertLayoutValues()
 	var layoutBreak vertLayoutLineBreakTempVariables
-	layoutBreak.Init(strandFullLineWidth(currentStrand)*currentScale)
+	layoutBreak.Init(strandFullLineWidth(currentStrand)*currentScale, int(currentFont.Metrics().VertLineWidth())*currentScale)
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
 	self.run.firstRowAscent = int(currentFont.Metrics().Ascent())*currentScale
-	self.run.top = -self.run.firstRowAscent
+	self.run.top, self.run.bottom = -self.run.firstRowAscent, -self.run.firstRowAscent
 	if self.boundingMode & noDescent == 0 {
 		self.run.lastRowDescent = int(currentFont.Metrics().Descent())*currentScale
 	}
 
 	var prevEffectiveGlyph ggfnt.GlyphIndex = ggfnt.GlyphMissing
 	var prevInterspacing int
-	var prevBottomAdvance, prevTopAdvance int
-	var y, index int = self.run.top, 0
+	var prevBottomAdvance int
+	var x, y, index int
 	var layoutWrap vertLayoutWrapTempVariables
 	for index < len(self.run.glyphIndices) {
 		glyphIndex := self.run.glyphIndices[index]
-		if glyphIndex < ggfnt.MaxGlyphs {
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeVertLayoutValues()
+				prevEffectiveGlyph = ggfnt.GlyphMissing // no kerning across strands
+			}
 			layoutBreak.NotifyNonBreak()
 			layoutWrap.IncreaseLineCharCount()
 			memoY := y + prevBottomAdvance
 			kerning := int(currentFont.Kerning().GetVert(prevEffectiveGlyph, glyphIndex))*currentScale
 			self.run.kernings[index] = int16(kerning)
 			
-			self.run.advances[index] = uint16(prevBottomAdvance + prevTopAdvance)
-			placement := currentFont.Glyphs().Placement(glyphIndex)
-			horzShift := int(placement.HorzCenter)*currentScale
-			self.run.horzShifts[index] = uint16(horzShift)
-			if self.run.right - horzShift < self.run.left {
-				self.run.left = self.run.right - horzShift
-			}
-			prevTopAdvance = int(placement.TopAdvance)*currentScale
-			y += prevBottomAdvance + prevInterspacing + kerning + prevTopAdvance
+			placement := glyphPlacement(currentFont, glyphIndex)
+			advance := prevBottomAdvance + int(placement.TopAdvance)*currentScale
+			if advance < 0 || advance > 65535 { panic("advance > 65535") } // discretional assertion
+			self.run.advances[index] = uint16(advance)
+			self.run.horzShifts[index] = uint16(int(placement.HorzCenter)*currentScale)
+			y += prevInterspacing + kerning + advance
 			prevInterspacing = currentGlyphInterspacing
 			prevBottomAdvance = int(placement.BottomAdvance)*currentScale
 			prevEffectiveGlyph = glyphIndex
@@ -51,25 +69,35 @@ func (self *Renderer) computeVerticalRunLogicalLayout(maxLineLen int) {
 			// line wrapping pain
 			yWrap := y + prevBottomAdvance
 			if yWrap <= maxLineLen {
-				layoutBreak.UpdateMaxRightAdvance(int(placement.Advance)*currentScale - horzShift)
-				layoutWrap.GlyphNonBreak(currentStrand, glyphIndex, index, memoY, yWrap)
+				if layoutWrap.GlyphNonBreak(self, currentStrand, glyphIndex, index, memoY, yWrap) && twining {
+					self.twineOperator.MemorizeState()
+				}
 			} else {
-				var yWithBottom int
-				index, yWithBottom = layoutWrap.GlyphBreak(self, currentStrand, glyphIndex, index, memoY, yWrap)
-				self.run.right = layoutBreak.NotifyBreak(self, self.run.top, yWithBottom, self.run.right)
-				y, prevInterspacing, prevBottomAdvance, prevTopAdvance = 0, 0, 0, 0
+				var lineLen int
+				var rewind bool
+				index, lineLen, rewind = layoutWrap.GlyphBreak(self, currentStrand, glyphIndex, index, memoY, yWrap)
+				if rewind && twining {
+					if self.twineOperator.RestoreState() & (twineStrandChange | twineScaleChange) != 0 {
+						currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeVertLayoutValues()
+					}
+				}
+				if twining { lineLen += self.twineOperator.LineBreakPad() }
+				x = layoutBreak.NotifyBreak(self, lineLen, x)
+				y, prevInterspacing, prevBottomAdvance = layoutBreak.StartLine(self, twining), 0, 0
 				prevEffectiveGlyph = ggfnt.GlyphMissing
 				continue
 			}
 		} else { // control glyph
 			switch glyphIndex {
 			case ggfnt.GlyphNewLine:
-				if self.elideLineBreak(index) {
+				if layoutWrap.AbsorbLineBreak() {
 					// line break should be elided, absorbed by immediately previous line wrapping break
 				} else {
 					// apply break
-					self.run.right = layoutBreak.NotifyBreak(self, self.run.top, y + prevBottomAdvance, self.run.right)
-					y, prevInterspacing, prevBottomAdvance, prevTopAdvance = 0, 0, 0, 0
+					lineLen := y + prevBottomAdvance
+					if twining { lineLen += self.twineOperator.LineBreakPad() }
+					x = layoutBreak.NotifyBreak(self, lineLen, x)
+					y, prevInterspacing, prevBottomAdvance = layoutBreak.StartLine(self, twining), 0, 0
 					prevEffectiveGlyph = ggfnt.GlyphMissing
 					layoutWrap.PostBreakUpdate(index + 1)
 				}
@@ -81,15 +109,23 @@ func (self *Renderer) computeVerticalRunLogicalLayout(maxLineLen int) {
 				self.run.advances[index] = 0
 				self.run.kernings[index] = 0 
 				self.run.horzShifts[index] = 0
+			case internal.FallbackGlyph:
+				self.run.advances[index], self.run.kernings[index], self.run.horzShifts[index] = 0, 0, 0
+				index += 1 // skip fallback index
+				self.run.advances[index], self.run.kernings[index], self.run.horzShifts[index] = 0, 0, 0
 			case internal.TwineEffectMarkerGlyph:
-				panic("unimplemented")
-				// lineBreaksOnly = false // yes or no? it depends?
-				// prevEffectiveGlyph = glyphIndex
-				// TODO: whether this breaks or doesn't break prev effective glyph
-				// should probably depend on the effect. color changes shouldn't break
-				// anything. other effects might break. basically, effects with padding
-				// should break kerning, but maybe we want to leave it to the user,
-				// as some cases might be ambiguous
+				self.run.advances[index], self.run.kernings[index], self.run.horzShifts[index] = 0, 0, 0
+				index += 1 // skip directive offset
+				self.run.advances[index], self.run.kernings[index], self.run.horzShifts[index] = 0, 0, 0
+				changes := self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					currentStrand, currentFont, currentScale, currentGlyphInterspacing = self.activeVertLayoutValues()
+					prevEffectiveGlyph = ggfnt.GlyphMissing // no kerning across strands or scales
+				}
+				if self.layoutTwinePadding(index, changes, y + prevInterspacing) {
+					y += int(self.run.advances[index])
+					prevEffectiveGlyph = ggfnt.GlyphMissing
+				}
 			default:
 				// ... some other control glyph, possibly a custom control glyph
 				// for the font or user code. we are not breaking kerning nor
@@ -101,20 +137,131 @@ func (self *Renderer) computeVerticalRunLogicalLayout(maxLineLen int) {
 		}
 		index += 1
 	}
+	self.fallbackStrand = nil
+	if twining { self.twineOperator.End() }
 
-	// take last x and descent into account
-	layoutBreak.NotifyTextEnd(self, y + prevBottomAdvance)
+	// take last line into account
+	layoutBreak.NotifyTextEnd(self, y + prevBottomAdvance, x)
 }
 
+// Returns the active strand, font, scale and scaled vertical glyph interspacing.
+func (self *Renderer) activeVertLayoutValues() (*strand.Strand, *ggfnt.Font, int, int) {
+	fontStrand := self.Strand()
+	scale := int(self.scale)
+	return fontStrand, fontStrand.Font(), scale, strandFullVertGlyphInterspacing(fontStrand)*scale
+}
+
+// Precondition: same as computeVerticalRunLogicalLayout().
 func (self *Renderer) computeVerticalRunMaskLayout(maxLineLen int) {
-	panic("sorry, Vertical rendering only supports LogicalBounding at the moment, MaskBounding is still unimplemented")
+	// line wrapping works exactly like with logical bounding,
+	// only the bounds and line lengths are refined afterwards
+	self.computeVerticalRunLogicalLayout(maxLineLen)
+	self.computeVerticalRunColumnMetrics(true)
+}
+
+// Side effects: updates renderer.run.lineAdvances with the baseline of
+// the last glyph of each column. With mask bounding, renderer.run.lineLengths
+// are also replaced by the bottom of each column's glyph masks, and run
+// left, right, top and bottom by the bounds of all glyph masks.
+func (self *Renderer) computeVerticalRunColumnMetrics(maskBounding bool) {
+	_, currentFont, currentScale, currentGlyphInterspacing := self.activeVertLayoutValues()
+	var drawWrapTemps drawWrapTempVariables
+	drawWrapTemps.Init(self)
+	var lineBreakTemps lineBreakTempVariables
+	lineBreakTemps.SetBreakHeight(strandFullLineWidth(self.Strand())*currentScale)
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
+
+	self.run.lineAdvances = self.run.lineAdvances[ : 0]
+	maskLeft, maskRight, maskTop, maskBottom := math.MaxInt, math.MinInt, math.MaxInt, math.MinInt
+	var x, lineBaseline, lineBottom int
+	y := int(self.run.lineIndents[0])
+	endLine := func() {
+		self.run.lineAdvances = append(self.run.lineAdvances, lineBaseline)
+		if maskBounding {
+			self.run.lineLengths[lineBreakTemps.lineIndex] = uint16(max(0, lineBottom))
+			maskBottom = max(maskBottom, lineBottom)
+		}
+		lineBaseline, lineBottom = 0, 0
+	}
+	applyBreak := func() { // like lineBreakTemps.ApplyVertBreak(), without line starts
+		endLine()
+		lineBreakTemps.lineIndex += 1
+		y = int(self.run.lineIndents[lineBreakTemps.lineIndex])
+		lineBreakTemps.consecutiveLineBreaks += 1
+		x += lineBreakTemps.getLineBreakHeight(self)
+	}
+	for index := 0; index < len(self.run.glyphIndices); index++ {
+		// line wrap case
+		if drawWrapTemps.IsLineWrapIndex(index) {
+			elide := drawWrapTemps.WrapTypeIsElide()
+			applyBreak()
+			drawWrapTemps.Update(self)
+			if elide { continue }
+		}
+
+		glyphIndex := self.run.glyphIndices[index]
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				_, currentFont, currentScale, currentGlyphInterspacing = self.activeVertLayoutValues()
+			}
+			lineBreakTemps.NotifyNonBreak()
+			drawWrapTemps.NotifyNonBreak()
+			y += int(self.run.kernings[index]) + int(self.run.advances[index])
+			lineBaseline = y
+			if maskBounding {
+				mask := self.loadMask(glyphIndex, currentFont)
+				if mask != nil && !mask.Bounds().Empty() {
+					bounds := mask.Bounds()
+					glyphX := x - int(self.run.horzShifts[index])
+					maskLeft   = min(maskLeft, glyphX + bounds.Min.X*currentScale)
+					maskRight  = max(maskRight, glyphX + bounds.Max.X*currentScale)
+					maskTop    = min(maskTop, y + bounds.Min.Y*currentScale)
+					lineBottom = max(lineBottom, y + bounds.Max.Y*currentScale)
+				}
+			}
+			y += currentGlyphInterspacing
+		} else { // control glyph
+			switch glyphIndex {
+			case ggfnt.GlyphNewLine:
+				if !drawWrapTemps.AbsorbLineBreak() {
+					applyBreak()
+				}
+			case internal.FallbackGlyph:
+				index += 1 // skip fallback index
+			case internal.TwineEffectMarkerGlyph:
+				index += 1 // skip directive offset
+				changes := self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					_, currentFont, currentScale, currentGlyphInterspacing = self.activeVertLayoutValues()
+				}
+				y += int(self.run.advances[index]) // padding
+			}
+		}
+	}
+	self.fallbackStrand = nil
+	if twining { self.twineOperator.End() }
+	endLine()
+
+	if !maskBounding { return }
+	if maskLeft > maskRight { // no visible glyphs
+		self.run.left, self.run.right, self.run.top, self.run.bottom = 0, 0, 0, 0
+	} else {
+		self.run.left, self.run.right = maskLeft, maskRight
+		self.run.top    = maskTop - self.run.firstRowAscent
+		self.run.bottom = maskBottom - self.run.firstRowAscent
+	}
 }
 
+// Returns the y where the given line (column) starts. The line
+// indent is already included. See run.lineIndents.
 func (self *Renderer) computeVertLineStart(oy int, lineIndex uint16) int {
+	indent := int(self.run.lineIndents[lineIndex])
 	switch self.align.Vert() {
-	case VertCenter : return oy - int(self.run.lineLengths[lineIndex] >> 1)
-	case Bottom     : return oy - int(self.run.lineLengths[lineIndex])
+	case VertCenter   : return oy - int(self.run.lineLengths[lineIndex] >> 1) + indent
+	case Bottom       : return oy - int(self.run.lineLengths[lineIndex]) + indent
+	case LastBaseline : return oy - self.run.lineAdvances[lineIndex] + indent
 	default:
-		return oy
+		return oy - self.run.firstRowAscent + indent
 	}
 }
@@ -7,8 +7,9 @@ import "github.com/tinne26/ptxt/strand"
 import "github.com/tinne26/ggfnt"
 
 func (self *Renderer) drawText(target core.Target, x, y int) {
+	if len(self.run.glyphIndices) == 0 { return } // trivial case
 	switch self.direction {
-	case Horizontal:
+	case Horizontal, RightToLeft:
 		self.drawTextHorz(target, x, y)
 	case Vertical:
 		self.drawTextVert(target, x, y)
@@ -27,87 +28,176 @@ func (self *Renderer) drawTextHorz(target core.Target, ox, oy int) {
 	fontStrand := self.Strand()
 	drawParams := self.prepareDrawParams(ox, oy)
 
+	// draw twine back graphics
+	if self.twineGfxPassRequired(twineGfxBackFlag) {
+		self.runHorzIterate(target, gfxBackDrawPass, drawParams, 0, 0, nil)
+	}
+
 	// draw shadow
-	shadowStrand := fontStrand.Shadow().GetStrand()
-	if shadowStrand != nil {
+	if self.shadowPassRequired() {
 		var offsetX, offsetY int
 		drawParams.RGBA, offsetX, offsetY = self.prepareShadowDraw(fontStrand)
-		lnkSetBlendMode(shadowStrand, self.blendMode)
+		self.setDrawBlendModes(ShadowDrawPass)
 		if self.drawFunc != nil {
-			self.runHorzIterate(target, drawParams, offsetX, offsetY, self.drawFunc)
+			self.runHorzIterate(target, ShadowDrawPass, drawParams, offsetX, offsetY, self.drawFunc)
 		} else {
-			self.runHorzIterate(target, drawParams, offsetX, offsetY,  
+			lnkBeginMaskBatch()
+			self.runHorzIterate(target, ShadowDrawPass, drawParams, offsetX, offsetY,  
 				func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+					shadowStrand := self.Strand().Shadow().GetStrand()
+					if shadowStrand == nil { return } // possible with twines
 					mask := self.loadMask(glyphIndex, shadowStrand.Font())
 					if mask != nil {
 						lnkDrawHorzMask(shadowStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 					}
 				},
 			)
+			lnkFlushMaskBatch()
 		}
 	}
 
 	// draw main text
 	drawParams.RGBA = self.prepareMainDraw(fontStrand)
 	if self.drawFunc != nil {
-		self.runHorzIterate(target, drawParams, 0, 0, self.drawFunc)
+		self.runHorzIterate(target, MainDrawPass, drawParams, 0, 0, self.drawFunc)
 	} else {
-		lnkSetBlendMode(fontStrand, self.blendMode)
-		self.runHorzIterate(target, drawParams, 0, 0,
+		self.setDrawBlendModes(MainDrawPass)
+		lnkBeginMaskBatch()
+		self.runHorzIterate(target, MainDrawPass, drawParams, 0, 0,
 			func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+				fontStrand := self.Strand() // can change mid-run with twines
 				mask := self.loadMask(glyphIndex, fontStrand.Font())
 				if mask != nil {
 					lnkDrawHorzMask(fontStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 				}
 			},
 		)
+		lnkFlushMaskBatch()
+	}
+
+	// draw twine front graphics
+	if self.twineGfxPassRequired(twineGfxFrontFlag) {
+		self.runHorzIterate(target, gfxFrontDrawPass, drawParams, 0, 0, nil)
 	}
 }
 
-func (self *Renderer) runHorzIterate(target core.Target, maskDrawParams MaskDrawParameters, offsetX, offsetY int, drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
+func (self *Renderer) runHorzIterate(target core.Target, pass DrawPass, maskDrawParams MaskDrawParameters, offsetX, offsetY int, drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
 	// helper variables
 	ox := maskDrawParams.X
-	currentStrand := self.Strand()
-	currentGlyphInterspacing := strandFullGlyphInterspacing(currentStrand)*maskDrawParams.Scale
+	currentGlyphInterspacing := strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
+	gfxPass := (pass == gfxBackDrawPass || pass == gfxFrontDrawPass)
+	var gfxTemps drawGfxTempVariables
+	if gfxPass { gfxTemps.Init(self, target, pass) }
 
 	// set up wrap info
 	var drawWrapTemps drawWrapTempVariables
 	drawWrapTemps.Init(self)
 	var lineBreakTemps lineBreakTempVariables
-	lineBreakTemps.SetBreakHeight(strandFullLineHeight(currentStrand)*maskDrawParams.Scale)
+	var revealTemps drawRevealTempVariables
+	revealTemps.Init(self)
 
 	// iteration
 	var x, y int = self.computeLineStart(ox, 0), maskDrawParams.Y
+	lineX := x // only needed for bidi reordering (see renderer.run.bidiPositions)
+	reordering := (len(self.run.bidiPositions) > 0)
 	for index := 0; index < len(self.run.glyphIndices); index++ {
+		if revealTemps.LimitReached(self, index) { break }
+
 		// line wrap case
 		if drawWrapTemps.IsLineWrapIndex(index) {
 			elide := drawWrapTemps.WrapTypeIsElide()
 			x, y = lineBreakTemps.ApplyHorzBreak(self, ox, y)
+			lineX = x
 			drawWrapTemps.Update(self)
+			if gfxPass { gfxTemps.NotifyLineBreak(self, x, y) }
 			if elide { continue }
 		}
 
 		// general drawing
 		glyphIndex := self.run.glyphIndices[index]
-		if glyphIndex < ggfnt.MaxGlyphs {
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				currentGlyphInterspacing = strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+				maskDrawParams.RGBA, offsetX, offsetY = self.refreshFallbackDrawParams(pass, maskDrawParams.RGBA, offsetX, offsetY)
+			}
 			lineBreakTemps.NotifyNonBreak()
+			drawWrapTemps.NotifyNonBreak()
 			x += int(self.run.kernings[index])
-			maskDrawParams.X = x + offsetX
-			maskDrawParams.Y = y + offsetY
-			drawFunc(target, glyphIndex, maskDrawParams)
+			glyphX := x
+			if reordering { glyphX = lineX + self.run.bidiPositions[index] }
+			if gfxPass {
+				gfxTemps.NotifyGlyph(self, self.Strand(), glyphIndex, x, x + int(self.run.advances[index]))
+			} else if pass == glyphLayoutPass {
+				self.notifyGlyphLayout(index, lineBreakTemps.lineIndex, glyphX, y, maskDrawParams.Scale)
+			} else {
+				maskDrawParams.X = glyphX + offsetX
+				maskDrawParams.Y = y + offsetY
+				if twining {
+					motionX, motionY := self.twineOperator.MotionOffsets(x, y)
+					maskDrawParams.X += motionX
+					maskDrawParams.Y += motionY
+					drawFunc(target, glyphIndex, self.twineOperator.ChangeColor(pass, x, y, maskDrawParams))
+				} else {
+					drawFunc(target, glyphIndex, maskDrawParams)
+				}
+			}
 			x += int(self.run.advances[index]) + currentGlyphInterspacing
 		} else { // control glyph
 			switch glyphIndex {
 			case ggfnt.GlyphNewLine:
-				if !self.elideLineBreak(index) {
+				if !drawWrapTemps.AbsorbLineBreak() {
 					x, y = lineBreakTemps.ApplyHorzBreak(self, ox, y)
+					lineX = x
+					if gfxPass { gfxTemps.NotifyLineBreak(self, x, y) }
+				}
+				if pass == glyphLayoutPass {
+					self.notifyGlyphLayout(index, lineBreakTemps.lineIndex, x, y, maskDrawParams.Scale)
 				}
+			case internal.FallbackGlyph:
+				index += 1 // skip fallback index
 			case ggfnt.GlyphMissing:
 				// should typically be triggered at an earlier point,
 				// so I'm not even sure you can reach this normally
 				panic("missing glyph")
 			case internal.TwineEffectMarkerGlyph:
-				panic("unimplemented")
+				index += 1 // skip directive offset
+				directiveOffset := int(self.run.glyphIndices[index])
+				changes := self.twineOperator.Apply(directiveOffset)
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					maskDrawParams.Scale = int(self.scale)
+					currentGlyphInterspacing = strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+				}
+				if gfxPass {
+					gfxTemps.NotifyDirective(self, directiveOffset, x, y)
+					if self.run.advances[index] != 0 { // padding
+						gfxTemps.NotifyPadding(self, x, x + int(self.run.advances[index]))
+					}
+				} else {
+					maskDrawParams.RGBA, offsetX, offsetY = self.refreshTwineDrawParams(pass, changes, maskDrawParams.RGBA, offsetX, offsetY)
+				}
+				x += int(self.run.advances[index]) // padding
+			case internal.TabGlyph:
+				x += int(self.run.advances[index])
+			case internal.SoftHyphenGlyph:
+				if !drawWrapTemps.IsHyphenWrap(self, index) { break }
+				hyphen, _ := strandHyphenGlyph(self.Strand())
+				if gfxPass {
+					gfxTemps.NotifyGlyph(self, self.Strand(), hyphen, x, x + glyphAdvance(self.Strand().Font(), hyphen)*maskDrawParams.Scale)
+				} else if pass != glyphLayoutPass {
+					maskDrawParams.X = x + offsetX
+					if reordering { maskDrawParams.X = lineX + self.run.bidiPositions[index] + offsetX }
+					maskDrawParams.Y = y + offsetY
+					if twining {
+						motionX, motionY := self.twineOperator.MotionOffsets(x, y)
+						maskDrawParams.X += motionX
+						maskDrawParams.Y += motionY
+						drawFunc(target, hyphen, self.twineOperator.ChangeColor(pass, x, y, maskDrawParams))
+					} else {
+						drawFunc(target, hyphen, maskDrawParams)
+					}
+				}
 			default:
 				// other control glyphs to be fully ignored
 				// TODO: or do we need to report any of these control glyphs,
@@ -116,66 +206,81 @@ func (self *Renderer) runHorzIterate(target core.Target, maskDrawParams MaskDraw
 			}
 		}
 	}
+	self.fallbackStrand = nil
+	if gfxPass { gfxTemps.Finish(self) }
+	if twining { self.twineOperator.End() }
 }
 
-// --- horz ---
+// --- vert ---
 
 func (self *Renderer) drawTextVert(target core.Target, ox, oy int) {	
 	fontStrand := self.Strand()
 	drawParams := self.prepareDrawParams(ox, oy)
 
 	// draw shadow
-	shadowStrand := fontStrand.Shadow().GetStrand()
-	if shadowStrand != nil {
+	if self.shadowPassRequired() {
 		var offsetX, offsetY int
 		drawParams.RGBA, offsetX, offsetY = self.prepareShadowDraw(fontStrand)
-		lnkSetBlendMode(shadowStrand, self.blendMode)
+		self.setDrawBlendModes(ShadowDrawPass)
 		if self.drawFunc != nil {
-			self.runVertIterate(target, drawParams, offsetX, offsetY, self.drawFunc)
+			self.runVertIterate(target, ShadowDrawPass, drawParams, offsetX, offsetY, self.drawFunc)
 		} else {
-			self.runVertIterate(target, drawParams, offsetX, offsetY,  
+			lnkBeginMaskBatch()
+			self.runVertIterate(target, ShadowDrawPass, drawParams, offsetX, offsetY,  
 				func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+					shadowStrand := self.Strand().Shadow().GetStrand()
+					if shadowStrand == nil { return } // possible with fallbacks
 					mask := self.loadMask(glyphIndex, shadowStrand.Font())
 					if mask != nil {
 						lnkDrawHorzMask(shadowStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 					}
 				},
 			)
+			lnkFlushMaskBatch()
 		}
 	}
 
 	// draw main text
 	drawParams.RGBA = self.prepareMainDraw(fontStrand)
 	if self.drawFunc != nil {
-		self.runVertIterate(target, drawParams, 0, 0, self.drawFunc)
+		self.runVertIterate(target, MainDrawPass, drawParams, 0, 0, self.drawFunc)
 	} else {
-		lnkSetBlendMode(fontStrand, self.blendMode)
-		self.runVertIterate(target, drawParams, 0, 0,
+		self.setDrawBlendModes(MainDrawPass)
+		lnkBeginMaskBatch()
+		self.runVertIterate(target, MainDrawPass, drawParams, 0, 0,
 			func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+				fontStrand := self.Strand() // can change mid-run with fallbacks
 				mask := self.loadMask(glyphIndex, fontStrand.Font())
 				if mask != nil {
 					lnkDrawHorzMask(fontStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 				}
 			},
 		)
+		lnkFlushMaskBatch()
 	}
 }
 
-func (self *Renderer) runVertIterate(target core.Target, maskDrawParams MaskDrawParameters, offsetX, offsetY int, drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
+func (self *Renderer) runVertIterate(target core.Target, pass DrawPass, maskDrawParams MaskDrawParameters, offsetX, offsetY int, drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
 	// helper variables
 	currentStrand := self.Strand()
 	currentGlyphInterspacing := strandFullVertGlyphInterspacing(currentStrand)*maskDrawParams.Scale
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
 	
 	// set up wrap info
 	var drawWrapTemps drawWrapTempVariables
 	drawWrapTemps.Init(self)
 	var lineBreakTemps lineBreakTempVariables
 	lineBreakTemps.SetBreakHeight(strandFullLineWidth(currentStrand)*maskDrawParams.Scale)
+	var revealTemps drawRevealTempVariables
+	revealTemps.Init(self)
 	
 	// iteration
 	oy := maskDrawParams.Y
 	var x, y int = maskDrawParams.X, self.computeVertLineStart(oy, 0)
 	for index := 0; index < len(self.run.glyphIndices); index++ {
+		if revealTemps.LimitReached(self, index) { break }
+
 		// line wrap case
 		if drawWrapTemps.IsLineWrapIndex(index) {
 			elide := drawWrapTemps.WrapTypeIsElide()
@@ -186,26 +291,54 @@ func (self *Renderer) runVertIterate(target core.Target, maskDrawParams MaskDraw
 
 		// general drawing
 		glyphIndex := self.run.glyphIndices[index]
-		if glyphIndex < ggfnt.MaxGlyphs {
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				currentGlyphInterspacing = strandFullVertGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+				maskDrawParams.RGBA, offsetX, offsetY = self.refreshFallbackDrawParams(pass, maskDrawParams.RGBA, offsetX, offsetY)
+			}
 			lineBreakTemps.NotifyNonBreak()
+			drawWrapTemps.NotifyNonBreak()
 			y += int(self.run.kernings[index])
 			y += int(self.run.advances[index])
 			maskDrawParams.X = x + offsetX - int(self.run.horzShifts[index])
 			maskDrawParams.Y = y + offsetY
-			drawFunc(target, glyphIndex, maskDrawParams)
+			if pass == glyphLayoutPass {
+				self.notifyGlyphLayout(index, lineBreakTemps.lineIndex, maskDrawParams.X, maskDrawParams.Y, maskDrawParams.Scale)
+			} else {
+				if twining {
+					motionX, motionY := self.twineOperator.MotionOffsets(x, y)
+					maskDrawParams.X += motionX
+					maskDrawParams.Y += motionY
+					drawFunc(target, glyphIndex, self.twineOperator.ChangeColor(pass, x, y, maskDrawParams))
+				} else {
+					drawFunc(target, glyphIndex, maskDrawParams)
+				}
+			}
 			y += currentGlyphInterspacing
 		} else { // control glyph
 			switch glyphIndex {
 			case ggfnt.GlyphNewLine:
-				if !self.elideLineBreak(index) {
+				if !drawWrapTemps.AbsorbLineBreak() {
 					x, y = lineBreakTemps.ApplyVertBreak(self, x, oy)
 				}
+				if pass == glyphLayoutPass {
+					self.notifyGlyphLayout(index, lineBreakTemps.lineIndex, x, y, maskDrawParams.Scale)
+				}
+			case internal.FallbackGlyph:
+				index += 1 // skip fallback index
 			case ggfnt.GlyphMissing:
 				// should typically be triggered at an earlier point,
 				// so I'm not even sure you can reach this normally
 				panic("missing glyph")
 			case internal.TwineEffectMarkerGlyph:
-				panic("unimplemented")
+				index += 1 // skip directive offset
+				changes := self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					maskDrawParams.Scale = int(self.scale)
+					currentGlyphInterspacing = strandFullVertGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+				}
+				maskDrawParams.RGBA, offsetX, offsetY = self.refreshTwineDrawParams(pass, changes, maskDrawParams.RGBA, offsetX, offsetY)
+				y += int(self.run.advances[index]) // padding
 			default:
 				// other control glyphs to be fully ignored
 				// TODO: or do we need to report any of these control glyphs,
@@ -214,6 +347,8 @@ func (self *Renderer) runVertIterate(target core.Target, maskDrawParams MaskDraw
 			}
 		}
 	}
+	self.fallbackStrand = nil
+	if twining { self.twineOperator.End() }
 }
 
 // --- sideways ---
@@ -223,58 +358,68 @@ func (self *Renderer) drawTextSideways(target core.Target, ox, oy int) {
 	drawParams := self.prepareDrawParams(ox, oy)
 
 	// draw shadow
-	shadowStrand := fontStrand.Shadow().GetStrand()
-	if shadowStrand != nil {
+	if self.shadowPassRequired() {
 		var offsetX, offsetY int
 		drawParams.RGBA, offsetX, offsetY = self.prepareShadowDraw(fontStrand)
-		lnkSetBlendMode(shadowStrand, self.blendMode)
+		self.setDrawBlendModes(ShadowDrawPass)
 		if self.drawFunc != nil {
-			self.runSidewaysIterate(target, drawParams, offsetX, offsetY, self.drawFunc)
+			self.runSidewaysIterate(target, ShadowDrawPass, drawParams, offsetX, offsetY, self.drawFunc)
 		} else {
-			self.runSidewaysIterate(target, drawParams, offsetX, offsetY,  
+			lnkBeginMaskBatch()
+			self.runSidewaysIterate(target, ShadowDrawPass, drawParams, offsetX, offsetY,  
 				func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+					shadowStrand := self.Strand().Shadow().GetStrand()
+					if shadowStrand == nil { return } // possible with twines
 					mask := self.loadMask(glyphIndex, shadowStrand.Font())
 					if mask != nil {
 						lnkDrawSidewaysMask(shadowStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 					}
 				},
 			)
+			lnkFlushMaskBatch()
 		}
 	}
 
 	// draw main text
 	drawParams.RGBA = self.prepareMainDraw(fontStrand)
 	if self.drawFunc != nil {
-		self.runSidewaysIterate(target, drawParams, 0, 0, self.drawFunc)
+		self.runSidewaysIterate(target, MainDrawPass, drawParams, 0, 0, self.drawFunc)
 	} else {
-		lnkSetBlendMode(fontStrand, self.blendMode)
-		self.runSidewaysIterate(target, drawParams, 0, 0,
+		self.setDrawBlendModes(MainDrawPass)
+		lnkBeginMaskBatch()
+		self.runSidewaysIterate(target, MainDrawPass, drawParams, 0, 0,
 			func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+				fontStrand := self.Strand() // can change mid-run with twines
 				mask := self.loadMask(glyphIndex, fontStrand.Font())
 				if mask != nil {
 					lnkDrawSidewaysMask(fontStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 				}
 			},
 		)
+		lnkFlushMaskBatch()
 	}
 }
 
-func (self *Renderer) runSidewaysIterate(target core.Target, maskDrawParams MaskDrawParameters, offsetX, offsetY int, drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
+func (self *Renderer) runSidewaysIterate(target core.Target, pass DrawPass, maskDrawParams MaskDrawParameters, offsetX, offsetY int, drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
 	// helper variables
 	oy := maskDrawParams.Y
-	currentStrand := self.Strand()
-	currentGlyphInterspacing := strandFullGlyphInterspacing(currentStrand)*maskDrawParams.Scale
+	currentGlyphInterspacing := strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
 
 	// set up wrap info
 	var drawWrapTemps drawWrapTempVariables
 	drawWrapTemps.Init(self)
 	var lineBreakTemps lineBreakTempVariables
-	lineBreakTemps.SetBreakHeight(strandFullLineHeight(currentStrand)*maskDrawParams.Scale)
+	var revealTemps drawRevealTempVariables
+	revealTemps.Init(self)
 
 	// iteration
 	lsDiff := self.computeLineStart(oy, 0) - oy
 	var x, y int = maskDrawParams.X, oy - lsDiff
 	for index := 0; index < len(self.run.glyphIndices); index++ {
+		if revealTemps.LimitReached(self, index) { break }
+
 		// line wrap case
 		if drawWrapTemps.IsLineWrapIndex(index) {
 			elide := drawWrapTemps.WrapTypeIsElide()
@@ -285,25 +430,68 @@ func (self *Renderer) runSidewaysIterate(target core.Target, maskDrawParams Mask
 
 		// general drawing
 		glyphIndex := self.run.glyphIndices[index]
-		if glyphIndex < ggfnt.MaxGlyphs {
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				currentGlyphInterspacing = strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+				maskDrawParams.RGBA, offsetX, offsetY = self.refreshFallbackDrawParams(pass, maskDrawParams.RGBA, offsetX, offsetY)
+			}
 			lineBreakTemps.NotifyNonBreak()
+			drawWrapTemps.NotifyNonBreak()
 			y -= int(self.run.kernings[index])
-			maskDrawParams.X = x + offsetY
-			maskDrawParams.Y = y - offsetX
-			drawFunc(target, glyphIndex, maskDrawParams)
+			if pass == glyphLayoutPass {
+				self.notifyGlyphLayout(index, lineBreakTemps.lineIndex, x, y, maskDrawParams.Scale)
+			} else {
+				maskDrawParams.X = x + offsetY
+				maskDrawParams.Y = y - offsetX
+				if twining {
+					motionX, motionY := self.twineOperator.MotionOffsets(x, y)
+					maskDrawParams.X += motionY
+					maskDrawParams.Y -= motionX
+					drawFunc(target, glyphIndex, self.twineOperator.ChangeColor(pass, x, y, maskDrawParams))
+				} else {
+					drawFunc(target, glyphIndex, maskDrawParams)
+				}
+			}
 			y -= int(self.run.advances[index]) + currentGlyphInterspacing
 		} else { // control glyph
 			switch glyphIndex {
 			case ggfnt.GlyphNewLine:
-				if !self.elideLineBreak(index) {
+				if !drawWrapTemps.AbsorbLineBreak() {
 					x, y = lineBreakTemps.ApplySidewaysBreak(self, x, oy)
 				}
+				if pass == glyphLayoutPass {
+					self.notifyGlyphLayout(index, lineBreakTemps.lineIndex, x, y, maskDrawParams.Scale)
+				}
+			case internal.FallbackGlyph:
+				index += 1 // skip fallback index
 			case ggfnt.GlyphMissing:
 				// should typically be triggered at an earlier point,
 				// so I'm not even sure you can reach this normally
 				panic("missing glyph")
 			case internal.TwineEffectMarkerGlyph:
-				panic("unimplemented")
+				index += 1 // skip directive offset
+				changes := self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					maskDrawParams.Scale = int(self.scale)
+					currentGlyphInterspacing = strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+				}
+				maskDrawParams.RGBA, offsetX, offsetY = self.refreshTwineDrawParams(pass, changes, maskDrawParams.RGBA, offsetX, offsetY)
+				y -= int(self.run.advances[index]) // padding
+			case internal.TabGlyph:
+				y -= int(self.run.advances[index])
+			case internal.SoftHyphenGlyph:
+				if !drawWrapTemps.IsHyphenWrap(self, index) || pass == glyphLayoutPass { break }
+				hyphen, _ := strandHyphenGlyph(self.Strand())
+				maskDrawParams.X = x + offsetY
+				maskDrawParams.Y = y - offsetX
+				if twining {
+					motionX, motionY := self.twineOperator.MotionOffsets(x, y)
+					maskDrawParams.X += motionY
+					maskDrawParams.Y -= motionX
+					drawFunc(target, hyphen, self.twineOperator.ChangeColor(pass, x, y, maskDrawParams))
+				} else {
+					drawFunc(target, hyphen, maskDrawParams)
+				}
 			default:
 				// other control glyphs to be fully ignored
 				// TODO: or do we need to report any of these control glyphs,
@@ -312,6 +500,8 @@ func (self *Renderer) runSidewaysIterate(target core.Target, maskDrawParams Mask
 			}
 		}
 	}
+	self.fallbackStrand = nil
+	if twining { self.twineOperator.End() }
 }
 
 // --- sideways right ---
@@ -321,57 +511,67 @@ func (self *Renderer) drawTextSidewaysRight(target core.Target, ox, oy int) {
 	drawParams := self.prepareDrawParams(ox, oy)
 
 	// draw shadow
-	shadowStrand := fontStrand.Shadow().GetStrand()
-	if shadowStrand != nil {
+	if self.shadowPassRequired() {
 		var offsetX, offsetY int
 		drawParams.RGBA, offsetX, offsetY = self.prepareShadowDraw(fontStrand)
-		lnkSetBlendMode(shadowStrand, self.blendMode)
+		self.setDrawBlendModes(ShadowDrawPass)
 		if self.drawFunc != nil {
-			self.runSidewaysRightIterate(target, drawParams, offsetX, offsetY, self.drawFunc)
+			self.runSidewaysRightIterate(target, ShadowDrawPass, drawParams, offsetX, offsetY, self.drawFunc)
 		} else {
-			self.runSidewaysRightIterate(target, drawParams, offsetX, offsetY,  
+			lnkBeginMaskBatch()
+			self.runSidewaysRightIterate(target, ShadowDrawPass, drawParams, offsetX, offsetY,  
 				func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+					shadowStrand := self.Strand().Shadow().GetStrand()
+					if shadowStrand == nil { return } // possible with twines
 					mask := self.loadMask(glyphIndex, shadowStrand.Font())
 					if mask != nil {
 						lnkDrawSidewaysRightMask(shadowStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 					}
 				},
 			)
+			lnkFlushMaskBatch()
 		}
 	}
 
 	// draw main text
 	drawParams.RGBA = self.prepareMainDraw(fontStrand)
 	if self.drawFunc != nil {
-		self.runSidewaysRightIterate(target, drawParams, 0, 0, self.drawFunc)
+		self.runSidewaysRightIterate(target, MainDrawPass, drawParams, 0, 0, self.drawFunc)
 	} else {
-		lnkSetBlendMode(fontStrand, self.blendMode)
-		self.runSidewaysRightIterate(target, drawParams, 0, 0,
+		self.setDrawBlendModes(MainDrawPass)
+		lnkBeginMaskBatch()
+		self.runSidewaysRightIterate(target, MainDrawPass, drawParams, 0, 0,
 			func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+				fontStrand := self.Strand() // can change mid-run with twines
 				mask := self.loadMask(glyphIndex, fontStrand.Font())
 				if mask != nil {
 					lnkDrawSidewaysRightMask(fontStrand, target, mask, params.X, params.Y, params.Scale, params.RGBA)
 				}
 			},
 		)
+		lnkFlushMaskBatch()
 	}
 }
 
-func (self *Renderer) runSidewaysRightIterate(target core.Target, maskDrawParams MaskDrawParameters, offsetX, offsetY int, drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
+func (self *Renderer) runSidewaysRightIterate(target core.Target, pass DrawPass, maskDrawParams MaskDrawParameters, offsetX, offsetY int, drawFunc func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters)) {
 	// helper variables
 	oy := maskDrawParams.Y
-	currentStrand := self.Strand()
-	currentGlyphInterspacing := strandFullGlyphInterspacing(currentStrand)*maskDrawParams.Scale
+	currentGlyphInterspacing := strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+	twining := (self.run.twineContents != nil)
+	if twining { self.twineOperator.Begin(self, self.run.twineContents) }
 	
 	// set up wrap info
 	var drawWrapTemps drawWrapTempVariables
 	drawWrapTemps.Init(self)
 	var lineBreakTemps lineBreakTempVariables
-	lineBreakTemps.SetBreakHeight(strandFullLineHeight(currentStrand)*maskDrawParams.Scale)
+	var revealTemps drawRevealTempVariables
+	revealTemps.Init(self)
 
 	// iteration
 	var x, y int = maskDrawParams.X, self.computeLineStart(oy, 0)
 	for index := 0; index < len(self.run.glyphIndices); index++ {
+		if revealTemps.LimitReached(self, index) { break }
+
 		// line wrap case
 		if drawWrapTemps.IsLineWrapIndex(index) {
 			elide := drawWrapTemps.WrapTypeIsElide()
@@ -382,25 +582,68 @@ func (self *Renderer) runSidewaysRightIterate(target core.Target, maskDrawParams
 
 		// general drawing
 		glyphIndex := self.run.glyphIndices[index]
-		if glyphIndex < ggfnt.MaxGlyphs {
+		if isDrawableGlyph(glyphIndex) {
+			if self.syncGlyphFallback(index) {
+				currentGlyphInterspacing = strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+				maskDrawParams.RGBA, offsetX, offsetY = self.refreshFallbackDrawParams(pass, maskDrawParams.RGBA, offsetX, offsetY)
+			}
 			lineBreakTemps.NotifyNonBreak()
+			drawWrapTemps.NotifyNonBreak()
 			y += int(self.run.kernings[index])
-			maskDrawParams.X = x - offsetY
-			maskDrawParams.Y = y + offsetX
-			drawFunc(target, glyphIndex, maskDrawParams)
+			if pass == glyphLayoutPass {
+				self.notifyGlyphLayout(index, lineBreakTemps.lineIndex, x, y, maskDrawParams.Scale)
+			} else {
+				maskDrawParams.X = x - offsetY
+				maskDrawParams.Y = y + offsetX
+				if twining {
+					motionX, motionY := self.twineOperator.MotionOffsets(x, y)
+					maskDrawParams.X -= motionY
+					maskDrawParams.Y += motionX
+					drawFunc(target, glyphIndex, self.twineOperator.ChangeColor(pass, x, y, maskDrawParams))
+				} else {
+					drawFunc(target, glyphIndex, maskDrawParams)
+				}
+			}
 			y += int(self.run.advances[index]) + currentGlyphInterspacing
 		} else { // control glyph
 			switch glyphIndex {
 			case ggfnt.GlyphNewLine:
-				if !self.elideLineBreak(index) {
+				if !drawWrapTemps.AbsorbLineBreak() {
 					x, y = lineBreakTemps.ApplySidewaysRightBreak(self, x, oy)
 				}
+				if pass == glyphLayoutPass {
+					self.notifyGlyphLayout(index, lineBreakTemps.lineIndex, x, y, maskDrawParams.Scale)
+				}
+			case internal.FallbackGlyph:
+				index += 1 // skip fallback index
 			case ggfnt.GlyphMissing:
 				// should typically be triggered at an earlier point,
 				// so I'm not even sure you can reach this normally
 				panic("missing glyph")
 			case internal.TwineEffectMarkerGlyph:
-				panic("unimplemented")
+				index += 1 // skip directive offset
+				changes := self.twineOperator.Apply(int(self.run.glyphIndices[index]))
+				if changes & (twineStrandChange | twineScaleChange) != 0 {
+					maskDrawParams.Scale = int(self.scale)
+					currentGlyphInterspacing = strandFullGlyphInterspacing(self.Strand())*maskDrawParams.Scale
+				}
+				maskDrawParams.RGBA, offsetX, offsetY = self.refreshTwineDrawParams(pass, changes, maskDrawParams.RGBA, offsetX, offsetY)
+				y += int(self.run.advances[index]) // padding
+			case internal.TabGlyph:
+				y += int(self.run.advances[index])
+			case internal.SoftHyphenGlyph:
+				if !drawWrapTemps.IsHyphenWrap(self, index) || pass == glyphLayoutPass { break }
+				hyphen, _ := strandHyphenGlyph(self.Strand())
+				maskDrawParams.X = x - offsetY
+				maskDrawParams.Y = y + offsetX
+				if twining {
+					motionX, motionY := self.twineOperator.MotionOffsets(x, y)
+					maskDrawParams.X -= motionY
+					maskDrawParams.Y += motionX
+					drawFunc(target, hyphen, self.twineOperator.ChangeColor(pass, x, y, maskDrawParams))
+				} else {
+					drawFunc(target, hyphen, maskDrawParams)
+				}
 			default:
 				// other control glyphs to be fully ignored
 				// TODO: or do we need to report any of these control glyphs,
@@ -409,6 +652,8 @@ func (self *Renderer) runSidewaysRightIterate(target core.Target, maskDrawParams
 			}
 		}
 	}
+	self.fallbackStrand = nil
+	if twining { self.twineOperator.End() }
 }
 
 // ---- common helpers ----
@@ -426,6 +671,11 @@ func (self *Renderer) prepareShadowDraw(fontStrand *strand.Strand) ([4]float32,
 	if self.drawPassListener != nil {
 		self.drawPassListener(self, ShadowDrawPass)
 	}
+	return self.strandShadowParams(fontStrand)
+}
+
+// Returns the shadow color and offsets for the given strand.
+func (self *Renderer) strandShadowParams(fontStrand *strand.Strand) ([4]float32, int, int) {
 	rgba := internal.RGBAToFloat32(fontStrand.Shadow().GetColor())
 	var offsetX8, offsetY8 int8 = fontStrand.Shadow().GetOffsets()
 	var offsetX, offsetY int = int(offsetX8), int(offsetY8)
@@ -440,9 +690,87 @@ func (self *Renderer) prepareMainDraw(strand *strand.Strand) [4]float32 {
 	if self.drawPassListener != nil {
 		self.drawPassListener(self, MainDrawPass)
 	}
+	return self.strandMainColor(strand)
+}
+
+// Returns the main color for the given strand, without twine overrides.
+func (self *Renderer) strandMainColor(strand *strand.Strand) [4]float32 {
 	if strand.IsMainDyeActive() {
 		return strand.GetDye(strand.MainDyeKey())
 	} else {
 		return internal.RGBAToFloat32(self.fallbackMainDye)
 	}
 }
+
+// Returns whether any of the strands that might be used while drawing
+// has a shadow.
+func (self *Renderer) shadowPassRequired() bool {
+	if self.run.twineContents == nil {
+		return strandHasShadow(self.Strand(), self.mainFallbacks())
+	}
+	for _, fontStrand := range self.strands {
+		if fontStrand != nil && strandHasShadow(fontStrand, fontStrand.Mapping().GetFallbacks()) { return true }
+	}
+	return false
+}
+
+// Returns whether the strand or any of the given fallbacks has a shadow.
+func strandHasShadow(fontStrand *strand.Strand, fallbacks []*strand.Strand) bool {
+	if fontStrand.Shadow().GetStrand() != nil { return true }
+	for _, fallback := range fallbacks {
+		if fallback.Shadow().GetStrand() != nil { return true }
+	}
+	return false
+}
+
+// Returns whether the current run is a twine with gfx effects
+// of the given kind (twineGfxBackFlag or twineGfxFrontFlag).
+func (self *Renderer) twineGfxPassRequired(flag uint8) bool {
+	return self.run.twineContents != nil && self.run.twineGfxFlags & flag != 0
+}
+
+// Sets the renderer's blend mode on the strands that might be used
+// for drawing on the given pass.
+func (self *Renderer) setDrawBlendModes(pass DrawPass) {
+	if self.run.twineContents == nil {
+		self.setStrandDrawBlendMode(self.Strand(), self.mainFallbacks(), pass)
+	} else {
+		for _, fontStrand := range self.strands {
+			if fontStrand != nil { self.setStrandDrawBlendMode(fontStrand, fontStrand.Mapping().GetFallbacks(), pass) }
+		}
+	}
+}
+
+func (self *Renderer) setStrandDrawBlendMode(fontStrand *strand.Strand, fallbacks []*strand.Strand, pass DrawPass) {
+	for _, fallback := range fallbacks {
+		self.setSingleStrandDrawBlendMode(fallback, pass)
+	}
+	self.setSingleStrandDrawBlendMode(fontStrand, pass)
+}
+
+func (self *Renderer) setSingleStrandDrawBlendMode(fontStrand *strand.Strand, pass DrawPass) {
+	if pass == ShadowDrawPass {
+		fontStrand = fontStrand.Shadow().GetStrand()
+		if fontStrand == nil { return }
+	}
+	lnkSetBlendMode(fontStrand, self.blendMode)
+}
+
+// Returns the updated color and offsets after applying a twine directive.
+func (self *Renderer) refreshTwineDrawParams(pass DrawPass, changes uint8, rgba [4]float32, offsetX, offsetY int) ([4]float32, int, int) {
+	switch pass {
+	case MainDrawPass:
+		if changes & (twineStrandChange | twineColorChange) != 0 {
+			rgba = self.twineOperator.MainColor()
+		}
+	case ShadowDrawPass:
+		if changes & (twineStrandChange | twineScaleChange) != 0 {
+			rgba, offsetX, offsetY = self.strandShadowParams(self.Strand())
+		}
+	case glyphLayoutPass:
+		// nothing to refresh
+	default:
+		panic(brokenCode)
+	}
+	return rgba, offsetX, offsetY
+}
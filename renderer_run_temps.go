@@ -1,6 +1,9 @@
 package ptxt
 
+import "image"
+
 import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ptxt/core"
 import "github.com/tinne26/ptxt/strand"
 
 // --- layout line wrap ---
@@ -10,33 +13,63 @@ type layoutWrapTempVariables struct {
 	lastWrapSafeWidth int
 	lastWrapSafeIndex int
 	lastWrapType strand.WrapMode
+	lastWrapHyphen bool // whether the last wrap point is a soft hyphen
+	elidedWrapPending bool // set after an elided wrap, until the next glyph
 }
 
 func (self *layoutWrapTempVariables) IncreaseLineCharCount() {
 	self.lineCharCount += 1
+	self.elidedWrapPending = false
+}
+
+// Line breaks immediately after an elided wrap are absorbed by it.
+func (self *layoutWrapTempVariables) AbsorbLineBreak() bool {
+	absorb := self.elidedWrapPending
+	self.elidedWrapPending = false
+	return absorb
 }
 
-func (self *layoutWrapTempVariables) GlyphNonBreak(str *strand.Strand, glyphIndex ggfnt.GlyphIndex, index, preX, postX int) {
+// Returns whether the glyph has been registered as the last wrap point.
+func (self *layoutWrapTempVariables) GlyphNonBreak(renderer *Renderer, str *strand.Strand, glyphIndex ggfnt.GlyphIndex, index, preX, postX int) bool {
 	if str.CanWrap(glyphIndex, strand.WrapAfter) {
 		self.lastWrapSafeIndex = index + 1
 		self.lastWrapType = strand.WrapAfter
+		self.lastWrapHyphen = false
 		self.wrapPointFoundInCurrentLine = true
 		self.lastWrapSafeWidth = postX
+		return true
 	} else if str.CanWrap(glyphIndex, strand.WrapElide) {
 		self.lastWrapSafeIndex = index
 		self.lastWrapType = strand.WrapElide
+		self.lastWrapHyphen = false
 		self.wrapPointFoundInCurrentLine = true
 		self.lastWrapSafeWidth = preX
-	} else if str.CanWrap(glyphIndex, strand.WrapBefore) {
+		return true
+	} else if str.CanWrap(glyphIndex, strand.WrapBefore) || renderer.ruleBreakBefore(str, index) {
 		self.lastWrapSafeIndex = index
 		self.lastWrapType = strand.WrapBefore
+		self.lastWrapHyphen = false
 		self.wrapPointFoundInCurrentLine = true
 		self.lastWrapSafeWidth = preX
+		return true
 	}
+	return false
 }
 
-// Returns the new index and x to continue on.
-func (self *layoutWrapTempVariables) GlyphBreak(renderer *Renderer, str *strand.Strand, glyphIndex ggfnt.GlyphIndex, index, preX, postX int) (newIndex, newX int) {
+// Registers the soft hyphen at the given index as the last wrap point.
+// The given width must already include the hyphen glyph.
+func (self *layoutWrapTempVariables) HyphenNonBreak(index, width int) {
+	self.lastWrapSafeIndex = index + 1
+	self.lastWrapType = strand.WrapAfter
+	self.lastWrapHyphen = true
+	self.wrapPointFoundInCurrentLine = true
+	self.lastWrapSafeWidth = width
+}
+
+// Returns the new index and x to continue on, and whether we had to
+// rewind to a wrap point previously registered with GlyphNonBreak().
+func (self *layoutWrapTempVariables) GlyphBreak(renderer *Renderer, str *strand.Strand, glyphIndex ggfnt.GlyphIndex, index, preX, postX int) (newIndex, newX int, rewind bool) {
+	var elided bool
 	if self.lineCharCount > 1 && str.CanWrap(glyphIndex, strand.WrapElide) { // easy case
 		// NOTE: we could check lineCharCount == 1 here and if previous line
 		//       had only one char or didn't have a safe wrap point, force
@@ -44,19 +77,25 @@ func (self *layoutWrapTempVariables) GlyphBreak(renderer *Renderer, str *strand.
 		//       little gain on cases where everything went to **** already
 		renderer.run.wrapIndices = append(renderer.run.wrapIndices, uint16(index) | 0x8000)
 		index += 1
+		elided = true
 		postX = preX
-	} else if self.lineCharCount > 1 && str.CanWrap(glyphIndex, strand.WrapBefore) {
+	} else if self.lineCharCount > 1 && (str.CanWrap(glyphIndex, strand.WrapBefore) || renderer.ruleBreakBefore(str, index)) {
 		renderer.run.wrapIndices = append(renderer.run.wrapIndices, uint16(index))
-		// index already correct
+		postX = preX // the glyph goes to the next line (index already correct)
 	} else if self.wrapPointFoundInCurrentLine {
 		wrapIndex := uint16(self.lastWrapSafeIndex)
 		if self.lastWrapType == strand.WrapElide {
 			wrapIndex |= 0x8000
 			self.lastWrapSafeIndex += 1
+			elided = true
+		}
+		if self.lastWrapHyphen {
+			renderer.run.hyphenWraps = append(renderer.run.hyphenWraps, uint16(self.lastWrapSafeIndex - 1))
 		}
 		postX = self.lastWrapSafeWidth
 		renderer.run.wrapIndices = append(renderer.run.wrapIndices, wrapIndex)
 		index = self.lastWrapSafeIndex
+		rewind = true
 	} else { // take as much of the first word as we can (or at least one char)
 		// we have to discount the x increase unless we are on the first char anyways
 		if self.lineCharCount == 1 {
@@ -70,7 +109,8 @@ func (self *layoutWrapTempVariables) GlyphBreak(renderer *Renderer, str *strand.
 
 	// update wrap variables
 	self.PostBreakUpdate(index)
-	return index, postX
+	self.elidedWrapPending = elided
+	return index, postX, rewind
 }
 
 func (self *layoutWrapTempVariables) PostBreakUpdate(index int) {
@@ -78,20 +118,86 @@ func (self *layoutWrapTempVariables) PostBreakUpdate(index int) {
 	self.lastWrapSafeIndex = index
 	self.lastWrapSafeWidth = 0
 	self.lastWrapType = strand.WrapBefore
+	self.lastWrapHyphen = false
 	self.lineCharCount = 0
+	self.elidedWrapPending = false
 }
 
 // --- layout line break ---
 
+// Line metrics are computed per line, as twines can mix strands and
+// scales. The advance between two lines depends on the descent and
+// line gap of the first line and the ascent of the second, so each
+// advance is only known when the next line is closed.
 type layoutLineBreakTempVariables struct {
-	currentLineBreakHeight int
 	consecutiveLineBreaks int
+	prevConsecutiveLineBreaks int
+	numLineBreaks int
 	lineBreaksOnly bool
+
+	// metrics for the active strand and scale
+	activeAscent int
+	activeDescent int
+	activeLineGap int
+
+	// metrics for the current line
+	lineAscent int
+	lineDescent int
+	lineGap int
+	lineHasMetrics bool
+
+	memoLineAscent int
+	memoLineDescent int
+	memoLineGap int
+	memoLineHasMetrics bool
+
+	firstLineAscent int
+	prevLineDescentAndGap int
+	y int // baseline of the last closed line
+	lineIndent int // x where the current line starts
 }
 
-func (self *layoutLineBreakTempVariables) Init(height int) {
-	self.currentLineBreakHeight = height
+func (self *layoutLineBreakTempVariables) Init(renderer *Renderer) {
 	self.lineBreaksOnly = true
+	self.RefreshActiveMetrics(renderer)
+}
+
+// Must be called whenever the renderer's strand or scale change.
+func (self *layoutLineBreakTempVariables) RefreshActiveMetrics(renderer *Renderer) {
+	fontStrand := renderer.Strand()
+	scale := int(renderer.scale)
+	metrics := fontStrand.Font().Metrics()
+	self.activeAscent  = int(metrics.Ascent())*scale
+	self.activeDescent = int(metrics.Descent())*scale
+	self.activeLineGap = (int(metrics.LineGap()) + int(fontStrand.LineInterspacingShift()))*scale
+}
+
+// Makes the active metrics count towards the current line metrics.
+func (self *layoutLineBreakTempVariables) IncludeActiveMetrics() {
+	if !self.lineHasMetrics {
+		self.lineAscent  = self.activeAscent
+		self.lineDescent = self.activeDescent
+		self.lineGap     = self.activeLineGap
+		self.lineHasMetrics = true
+	} else {
+		self.lineAscent  = max(self.lineAscent , self.activeAscent )
+		self.lineDescent = max(self.lineDescent, self.activeDescent)
+		self.lineGap     = max(self.lineGap    , self.activeLineGap)
+	}
+}
+
+func (self *layoutLineBreakTempVariables) MemorizeLineMetrics() {
+	self.memoLineAscent  = self.lineAscent
+	self.memoLineDescent = self.lineDescent
+	self.memoLineGap     = self.lineGap
+	self.memoLineHasMetrics = self.lineHasMetrics
+}
+
+func (self *layoutLineBreakTempVariables) RestoreLineMetrics() {
+	self.lineAscent  = self.memoLineAscent
+	self.lineDescent = self.memoLineDescent
+	self.lineGap     = self.memoLineGap
+	self.lineHasMetrics = self.memoLineHasMetrics
 }
 
 func (self *layoutLineBreakTempVariables) NotifyNonBreak() {
@@ -99,34 +205,132 @@ func (self *layoutLineBreakTempVariables) NotifyNonBreak() {
 	self.consecutiveLineBreaks = 0
 }
 
-// Side effects: updates renderer.run.isMultiline, renderer.run.lineLengths,
-//               renderer.run.right. You have to update renderer.run.bottom
-//               with the returned value manually if necessary.
-func (self *layoutLineBreakTempVariables) NotifyBreak(renderer *Renderer, left, right, y int) int {
-	// line break update
-	if !renderer.run.isMultiline && (!self.lineBreaksOnly || len(renderer.run.glyphIndices) > 1) {
-		renderer.run.isMultiline = true // NOTE: control glyphs might make ^ incorrect for twines
-	}
+// Side effects: updates renderer.run.lineLengths, renderer.run.lineLefts,
+//               renderer.run.lineAdvances, renderer.run.left and renderer.run.right.
+// Returns the baseline y of the line being closed.
+func (self *layoutLineBreakTempVariables) NotifyBreak(renderer *Renderer, left, right int) int {
 	self.consecutiveLineBreaks += 1
 	lineLen := right - left
 	renderer.run.lineLengths = append(renderer.run.lineLengths, uint16(max(0, lineLen))) // the min is a big hack
+	renderer.run.lineIndents = append(renderer.run.lineIndents, uint16(self.lineIndent))
+	renderer.run.lineLefts = append(renderer.run.lineLefts, self.LineLeft(left, right))
 	if right > renderer.run.right { renderer.run.right = right }
 	if left  < renderer.run.left  { renderer.run.left  = left  }
-	return y + renderer.adjustParLineBreakHeightFor(self.currentLineBreakHeight, self.consecutiveLineBreaks)
+	y := self.closeLine(renderer)
+	self.prevConsecutiveLineBreaks = self.consecutiveLineBreaks
+	self.numLineBreaks += 1
+	return y
+}
+
+// Returns the left of the current line given its bounds. With mask
+// bounding, lines without glyph masks have empty bounds (right < left),
+// and the line indent is returned instead.
+func (self *layoutLineBreakTempVariables) LineLeft(left, right int) int {
+	if right < left { return self.lineIndent }
+	return left
+}
+
+// Must be called after each break to start the new line. Returns the
+// x position where the line starts, which can only be non-zero for
+// twines with padders or line restart markers.
+func (self *layoutLineBreakTempVariables) StartLine(renderer *Renderer, twining bool) int {
+	self.lineIndent = 0
+	if twining { self.lineIndent = renderer.twineOperator.LineStart() }
+	return self.lineIndent
 }
 
-// Preconditions: renderer.run.firstLineAscent and renderer.run.LastLineDescent are set
-// Side effects: updates renderer.run.lineLengths, renderer.run.right and renderer.run.bottom
+// Side effects: updates renderer.run.lineAdvances. 
+// Returns the baseline y of the line being closed.
+func (self *layoutLineBreakTempVariables) closeLine(renderer *Renderer) int {
+	if !self.lineHasMetrics { self.IncludeActiveMetrics() }
+	if self.numLineBreaks == 0 {
+		self.firstLineAscent = self.lineAscent
+	} else {
+		advance := self.prevLineDescentAndGap + self.lineAscent
+		advance = renderer.adjustParLineBreakHeightFor(advance, self.prevConsecutiveLineBreaks)
+		renderer.run.lineAdvances = append(renderer.run.lineAdvances, advance)
+		self.y += advance
+	}
+	self.prevLineDescentAndGap = self.lineDescent + self.lineGap
+	self.lineHasMetrics = false
+	return self.y
+}
+
+// Closes the last line. Returns the baseline y of the last line
+// and its descent.
+// Side effects: updates renderer.run.isMultiline and renderer.run.lineAdvances.
+func (self *layoutLineBreakTempVariables) CloseLastLine(renderer *Renderer) (int, int) {
+	y := self.closeLine(renderer)
+	renderer.run.isMultiline = (self.numLineBreaks > 1 || (self.numLineBreaks == 1 && !self.lineBreaksOnly))
+	return y, self.lineDescent
+}
+
+// Side effects: updates renderer.run.lineLengths, renderer.run.right, renderer.run.top,
+//               renderer.run.bottom, renderer.run.firstRowAscent, renderer.run.lastRowDescent,
+//               renderer.run.lineAdvances and renderer.run.isMultiline.
 func (self *layoutLineBreakTempVariables) NotifyTextEnd(renderer *Renderer, x int) {
 	if x > renderer.run.right { renderer.run.right = x }
 	renderer.run.lineLengths = append(renderer.run.lineLengths, uint16(x))
+	renderer.run.lineIndents = append(renderer.run.lineIndents, uint16(self.lineIndent))
+	renderer.run.lineLefts = append(renderer.run.lineLefts, self.LineLeft(0, x))
+	y, descent := self.CloseLastLine(renderer)
+	renderer.run.firstRowAscent = self.firstLineAscent
+	renderer.run.top = -self.firstLineAscent
+	if renderer.boundingMode & noDescent == 0 {
+		renderer.run.lastRowDescent = descent
+	}
 	if self.lineBreaksOnly {
-		renderer.run.bottom -= renderer.run.firstRowAscent
+		renderer.run.bottom = y - renderer.run.firstRowAscent
 	} else {
-		renderer.run.bottom += renderer.run.lastRowDescent
+		renderer.run.bottom = y + renderer.run.lastRowDescent
 	}
 }
 
+// --- layout mask bounds ---
+
+// Mask bounds are tracked relative to the baseline of the current
+// line, and folded into the run bounds once the line is closed and
+// its baseline position is known.
+type layoutMaskTempVariables struct {
+	firstNonEmptyLineFound bool
+	lineHasMasks bool
+	lineAscent int
+	lineDescent int
+	lineBottom int
+}
+
+func (self *layoutMaskTempVariables) NotifyMask(renderer *Renderer, bounds image.Rectangle, scale int) {
+	self.lineAscent = max(self.lineAscent, -bounds.Min.Y*scale)
+	if renderer.boundingMode & noDescent == 0 { // descent case
+		self.lineDescent = max(self.lineDescent, bounds.Max.Y*scale)
+	}
+	elevation := min(bounds.Max.Y*scale, 0)
+	bottom := max(elevation, elevation + self.lineDescent)
+	if !self.lineHasMasks {
+		self.lineBottom = bottom
+		self.lineHasMasks = true
+	} else {
+		self.lineBottom = max(self.lineBottom, bottom)
+	}
+}
+
+// Side effects: updates renderer.run.top, renderer.run.bottom,
+//               renderer.run.firstRowAscent and renderer.run.lastRowDescent.
+//               The run top still has to be adjusted with the first
+//               row ascent at the end of the process.
+func (self *layoutMaskTempVariables) CloseLine(renderer *Renderer, y int) {
+	renderer.run.lastRowDescent = self.lineDescent
+	if !self.lineHasMasks { return }
+	if !self.firstNonEmptyLineFound {
+		self.firstNonEmptyLineFound = true
+		renderer.run.top = y
+		renderer.run.firstRowAscent = self.lineAscent
+	}
+	renderer.run.bottom = max(renderer.run.bottom, y + self.lineBottom)
+	self.lineHasMasks = false
+	self.lineAscent, self.lineDescent, self.lineBottom = 0, 0, 0
+}
+
 // --- draw line break ---
 
 type lineBreakTempVariables struct {
@@ -147,7 +351,7 @@ func (self *lineBreakTempVariables) ApplyHorzBreak(renderer *Renderer, ox, y int
 	self.lineIndex += 1
 	self.consecutiveLineBreaks += 1
 	x := renderer.computeLineStart(ox, self.lineIndex)
-	y += self.getLineBreakHeight(renderer)
+	y += renderer.run.lineAdvances[self.lineIndex - 1]
 	return x, y
 }
 
@@ -162,7 +366,7 @@ func (self *lineBreakTempVariables) ApplySidewaysBreak(renderer *Renderer, x, oy
 	self.lineIndex += 1
 	self.consecutiveLineBreaks += 1
 	y := oy - (renderer.computeLineStart(oy, self.lineIndex) - oy)
-	x += self.getLineBreakHeight(renderer)
+	x += renderer.run.lineAdvances[self.lineIndex - 1]
 	return x, y
 }
 
@@ -170,7 +374,7 @@ func (self *lineBreakTempVariables) ApplySidewaysRightBreak(renderer *Renderer,
 	self.lineIndex += 1
 	self.consecutiveLineBreaks += 1
 	y := renderer.computeLineStart(oy, self.lineIndex)
-	x -= self.getLineBreakHeight(renderer)
+	x -= renderer.run.lineAdvances[self.lineIndex - 1]
 	return x, y
 }
 
@@ -188,7 +392,9 @@ func (self *lineBreakTempVariables) getLineBreakHeight(renderer *Renderer) int {
 type drawWrapTempVariables struct {
 	nextWrapIndex uint16
 	nextSliceIndex uint16
+	nextHyphenSliceIndex uint16
 	nextWrapType strand.WrapMode
+	elidedWrapPending bool // set after an elided wrap, until the next glyph
 }
 
 func (self *drawWrapTempVariables) Init(renderer *Renderer) {
@@ -206,6 +412,7 @@ func (self *drawWrapTempVariables) Init(renderer *Renderer) {
 }
 
 func (self *drawWrapTempVariables) Update(renderer *Renderer) {
+	self.elidedWrapPending = (self.nextWrapType == strand.WrapElide)
 	if uint16(len(renderer.run.wrapIndices)) <= self.nextSliceIndex {
 		self.nextWrapIndex = 65535
 	} else {
@@ -218,9 +425,223 @@ func (self *drawWrapTempVariables) Update(renderer *Renderer) {
 		self.nextSliceIndex += 1
 	}
 }
+func (self *drawWrapTempVariables) NotifyNonBreak() {
+	self.elidedWrapPending = false
+}
+
+// Line breaks immediately after an elided wrap are absorbed by it.
+func (self *drawWrapTempVariables) AbsorbLineBreak() bool {
+	absorb := self.elidedWrapPending
+	self.elidedWrapPending = false
+	return absorb
+}
+
 func (self *drawWrapTempVariables) IsLineWrapIndex(index int) bool {
 	return uint16(index) == self.nextWrapIndex
 }
 func (self *drawWrapTempVariables) WrapTypeIsElide() bool {
 	return self.nextWrapType == strand.WrapElide
 }
+
+// Returns whether a line has been wrapped at the soft hyphen with
+// the given index. Must be called only once per soft hyphen.
+func (self *drawWrapTempVariables) IsHyphenWrap(renderer *Renderer, index int) bool {
+	hyphenWraps := renderer.run.hyphenWraps
+	if int(self.nextHyphenSliceIndex) >= len(hyphenWraps) { return false }
+	if int(hyphenWraps[self.nextHyphenSliceIndex]) != index { return false }
+	self.nextHyphenSliceIndex += 1
+	return true
+}
+
+// --- draw reveal limit ---
+
+// Counts glyphs while drawing in order to stop at the renderer's
+// reveal limit. See RendererAdvanced.SetRevealLimit().
+type drawRevealTempVariables struct {
+	remaining int // negative if unlimited
+}
+
+func (self *drawRevealTempVariables) Init(renderer *Renderer) {
+	self.remaining = renderer.revealLimit
+}
+
+// Returns whether the reveal limit has been reached and drawing must
+// stop before the glyph at the given index. Must be called only once
+// per index.
+func (self *drawRevealTempVariables) LimitReached(renderer *Renderer, index int) bool {
+	if self.remaining < 0 || !isDrawableGlyph(renderer.run.glyphIndices[index]) { return false }
+	if self.remaining == 0 { return true }
+	self.remaining -= 1
+	return false
+}
+
+// --- draw twine gfx ---
+
+// Tracks the spans of twine gfx effects while iterating a run, and
+// invokes the gfx functions for each line segment. Segments are
+// delayed until we know whether the span continues with glyphs on
+// the next line, as that's necessary to set EndWrap correctly.
+type drawGfxTempVariables struct {
+	controlCode byte // twineCcPushGfxBack or twineCcPushGfxFront
+	target core.Target
+}
+
+type drawGfxSpan struct {
+	offset uint16 // directive offset within the twine contents
+	state twineOperatorState // state when the effect was pushed
+	ascent, descent int
+	numGlyphs int // glyphs in the span so far, including the current segment
+	emitted bool // whether any segment has been already emitted
+	
+	// current segment
+	y int
+	startX, endX, trimEndX int
+	startIndex int
+	hasContent bool // whether the segment has any glyphs or padding
+	
+	// pending segment (already closed by a line break)
+	pending bool
+	pendingRect image.Rectangle
+	pendingStartIndex int
+	pendingEndIndex int
+}
+
+func (self *drawGfxTempVariables) Init(renderer *Renderer, target core.Target, pass DrawPass) {
+	switch pass {
+	case gfxBackDrawPass  : self.controlCode = twineCcPushGfxBack
+	case gfxFrontDrawPass : self.controlCode = twineCcPushGfxFront
+	default:
+		panic(brokenCode)
+	}
+	self.target = target
+	renderer.run.twineGfxSpans = renderer.run.twineGfxSpans[ : 0]
+}
+
+// Must be called after applying each twine directive.
+func (self *drawGfxTempVariables) NotifyDirective(renderer *Renderer, offset int, x, y int) {
+	// close spans whose directives have been popped
+	stack := renderer.twineOperator.stack
+	spans := renderer.run.twineGfxSpans
+	for i := 0; i < len(spans); i++ {
+		if twineStackHasOffset(stack, spans[i].offset) { continue }
+		self.closeSpan(renderer, &spans[i])
+		spans = append(spans[ : i], spans[i + 1 : ]...)
+		i -= 1
+	}
+	
+	// open new span if relevant
+	if renderer.twineOperator.contents[offset + 1] == self.controlCode {
+		state := renderer.twineOperator.state
+		metrics := renderer.strands[state.strandIndex].Font().Metrics()
+		spans = append(spans, drawGfxSpan{
+			offset: uint16(offset),
+			state: state,
+			ascent: int(metrics.Ascent())*int(state.scale),
+			descent: int(metrics.Descent())*int(state.scale),
+			y: y,
+			startX: x,
+		})
+	}
+	renderer.run.twineGfxSpans = spans
+}
+
+// Must be called for each glyph, with the strand the glyph belongs to
+// (which can be a fallback strand), the x position after kerning and
+// the x position after the glyph advance.
+func (self *drawGfxTempVariables) NotifyGlyph(renderer *Renderer, glyphStrand *strand.Strand, glyphIndex ggfnt.GlyphIndex, preX, postX int) {
+	elidable := glyphStrand.CanWrap(glyphIndex, strand.WrapElide)
+	spans := renderer.run.twineGfxSpans
+	for i, _ := range spans {
+		self.notifyContent(renderer, &spans[i])
+		spans[i].endX = postX
+		if !elidable { spans[i].trimEndX = postX }
+		spans[i].numGlyphs += 1
+	}
+}
+
+// Must be called for twine padding, with the x positions before and
+// after the padding.
+func (self *drawGfxTempVariables) NotifyPadding(renderer *Renderer, preX, postX int) {
+	spans := renderer.run.twineGfxSpans
+	for i, _ := range spans {
+		self.notifyContent(renderer, &spans[i])
+		spans[i].endX, spans[i].trimEndX = postX, postX
+	}
+}
+
+func (self *drawGfxTempVariables) notifyContent(renderer *Renderer, span *drawGfxSpan) {
+	if span.hasContent { return }
+	if span.pending {
+		self.emit(renderer, span, span.pendingRect, span.pendingStartIndex, span.pendingEndIndex, true)
+		span.pending = false
+	}
+	span.trimEndX = span.startX
+	span.hasContent = true
+}
+
+// Must be called after each line break or wrap, with the new line position.
+func (self *drawGfxTempVariables) NotifyLineBreak(renderer *Renderer, x, y int) {
+	spans := renderer.run.twineGfxSpans
+	for i, _ := range spans {
+		if spans[i].hasContent {
+			spans[i].pending = true
+			spans[i].pendingRect = spans[i].segmentRect(true)
+			spans[i].pendingStartIndex = spans[i].startIndex
+			spans[i].pendingEndIndex = spans[i].numGlyphs
+		}
+		spans[i].startIndex = spans[i].numGlyphs
+		spans[i].startX, spans[i].y = x, y
+		spans[i].hasContent = false
+	}
+}
+
+// Must be called at the end of the iteration to close any spans still open.
+func (self *drawGfxTempVariables) Finish(renderer *Renderer) {
+	for i, _ := range renderer.run.twineGfxSpans {
+		self.closeSpan(renderer, &renderer.run.twineGfxSpans[i])
+	}
+	renderer.run.twineGfxSpans = renderer.run.twineGfxSpans[ : 0]
+	self.target = nil
+}
+
+func (self *drawGfxTempVariables) closeSpan(renderer *Renderer, span *drawGfxSpan) {
+	if span.pending {
+		self.emit(renderer, span, span.pendingRect, span.pendingStartIndex, span.pendingEndIndex, span.hasContent)
+		span.pending = false
+	}
+	if span.hasContent {
+		self.emit(renderer, span, span.segmentRect(false), span.startIndex, span.numGlyphs, false)
+	}
+}
+
+func (self *drawGfxTempVariables) emit(renderer *Renderer, span *drawGfxSpan, rect image.Rectangle, startIndex, endIndex int, endWrap bool) {
+	offset := int(span.offset)
+	gfxFn, isGfx := renderer.getTwineFunc(renderer.twineOperator.contents[offset + 2]).(TwineGfxFunc)
+	if !isGfx { panic("twine gfx effect using an unregistered or non-gfx function ID") }
+
+	args := renderer.twineOperator.effectArgs(offset)
+	args.OX, args.OY = rect.Min.X, rect.Min.Y + span.ascent
+	args.StartIndex, args.EndIndex = startIndex, endIndex
+	args.StartWrap = span.emitted
+	args.EndWrap = endWrap
+	span.emitted = true
+
+	strandIndex, scale, fallback := renderer.strandIndex, renderer.scale, renderer.fallbackStrand
+	renderer.strandIndex, renderer.scale, renderer.fallbackStrand = span.state.strandIndex, span.state.scale, nil
+	gfxFn(self.target, args, rect)
+	renderer.strandIndex, renderer.scale, renderer.fallbackStrand = strandIndex, scale, fallback
+}
+
+// Trailing elidable glyphs (e.g. spaces) are excluded on wrapped segments.
+func (self *drawGfxSpan) segmentRect(wrapped bool) image.Rectangle {
+	endX := self.endX
+	if wrapped && self.trimEndX > self.startX { endX = self.trimEndX }
+	return image.Rect(self.startX, self.y - self.ascent, endX, self.y + self.descent)
+}
+
+func twineStackHasOffset(stack []twineStackEntry, offset uint16) bool {
+	for i, _ := range stack {
+		if stack[i].offset == offset { return true }
+	}
+	return false
+}
@@ -11,34 +11,50 @@ type vertLayoutWrapTempVariables struct {
 	lastWrapSafeHeight int
 	lastWrapSafeIndex int
 	lastWrapType strand.WrapMode
+	elidedWrapPending bool // set after an elided wrap, until the next glyph
 }
 
 func (self *vertLayoutWrapTempVariables) IncreaseLineCharCount() {
 	self.lineCharCount += 1
+	self.elidedWrapPending = false
 }
 
-// Note: pre and post Y's must have the bottom advance included already
-func (self *vertLayoutWrapTempVariables) GlyphNonBreak(str *strand.Strand, glyphIndex ggfnt.GlyphIndex, index, preY, postY int) {
+// Line breaks immediately after an elided wrap are absorbed by it.
+func (self *vertLayoutWrapTempVariables) AbsorbLineBreak() bool {
+	absorb := self.elidedWrapPending
+	self.elidedWrapPending = false
+	return absorb
+}
+
+// Note: pre and post Y's must have the bottom advance included already.
+// Returns whether the glyph has been registered as the last wrap point.
+func (self *vertLayoutWrapTempVariables) GlyphNonBreak(renderer *Renderer, str *strand.Strand, glyphIndex ggfnt.GlyphIndex, index, preY, postY int) bool {
 	if str.CanWrap(glyphIndex, strand.WrapAfter) {
 		self.lastWrapSafeIndex = index + 1
 		self.lastWrapType = strand.WrapAfter
 		self.wrapPointFoundInCurrentLine = true
 		self.lastWrapSafeHeight = postY
+		return true
 	} else if str.CanWrap(glyphIndex, strand.WrapElide) {
 		self.lastWrapSafeIndex = index
 		self.lastWrapType = strand.WrapElide
 		self.wrapPointFoundInCurrentLine = true
 		self.lastWrapSafeHeight = preY
-	} else if str.CanWrap(glyphIndex, strand.WrapBefore) {
+		return true
+	} else if str.CanWrap(glyphIndex, strand.WrapBefore) || renderer.ruleBreakBefore(str, index) {
 		self.lastWrapSafeIndex = index
 		self.lastWrapType = strand.WrapBefore
 		self.wrapPointFoundInCurrentLine = true
 		self.lastWrapSafeHeight = preY
+		return true
 	}
+	return false
 }
 
-// Returns the new index and y to continue on.
-func (self *vertLayoutWrapTempVariables) GlyphBreak(renderer *Renderer, str *strand.Strand, glyphIndex ggfnt.GlyphIndex, index, preY, postY int) (newIndex, newY int) {
+// Returns the new index and y to continue on, and whether we had to
+// rewind to a wrap point previously registered with GlyphNonBreak().
+func (self *vertLayoutWrapTempVariables) GlyphBreak(renderer *Renderer, str *strand.Strand, glyphIndex ggfnt.GlyphIndex, index, preY, postY int) (newIndex, newY int, rewind bool) {
+	var elided bool
 	if self.lineCharCount > 1 && str.CanWrap(glyphIndex, strand.WrapElide) { // easy case
 		// NOTE: we could check lineCharCount == 1 here and if previous line
 		//       had only one char or didn't have a safe wrap point, force
@@ -46,19 +62,22 @@ func (self *vertLayoutWrapTempVariables) GlyphBreak(renderer *Renderer, str *str
 		//       little gain on cases where everything went to **** already
 		renderer.run.wrapIndices = append(renderer.run.wrapIndices, uint16(index) | 0x8000)
 		index += 1
+		elided = true
 		postY = preY
-	} else if self.lineCharCount > 1 && str.CanWrap(glyphIndex, strand.WrapBefore) {
+	} else if self.lineCharCount > 1 && (str.CanWrap(glyphIndex, strand.WrapBefore) || renderer.ruleBreakBefore(str, index)) {
 		renderer.run.wrapIndices = append(renderer.run.wrapIndices, uint16(index))
-		// index already correct
+		postY = preY // the glyph goes to the next line (index already correct)
 	} else if self.wrapPointFoundInCurrentLine {
 		wrapIndex := uint16(self.lastWrapSafeIndex)
 		if self.lastWrapType == strand.WrapElide {
 			wrapIndex |= 0x8000
 			self.lastWrapSafeIndex += 1
+			elided = true
 		}
 		postY = self.lastWrapSafeHeight
 		renderer.run.wrapIndices = append(renderer.run.wrapIndices, wrapIndex)
 		index = self.lastWrapSafeIndex
+		rewind = true
 	} else { // take as much of the first word as we can (or at least one char)
 		// we have to discount the x increase unless we are on the first char anyways
 		if self.lineCharCount == 1 {
@@ -72,7 +91,8 @@ func (self *vertLayoutWrapTempVariables) GlyphBreak(renderer *Renderer, str *str
 
 	// update wrap variables
 	self.PostBreakUpdate(index)
-	return index, postY
+	self.elidedWrapPending = elided
+	return index, postY, rewind
 }
 
 func (self *vertLayoutWrapTempVariables) PostBreakUpdate(index int) {
@@ -81,19 +101,22 @@ func (self *vertLayoutWrapTempVariables) PostBreakUpdate(index int) {
 	self.lastWrapSafeHeight = 0
 	self.lastWrapType = strand.WrapBefore
 	self.lineCharCount = 0
+	self.elidedWrapPending = false
 }
 
 // --- layout line break ---
 
 type vertLayoutLineBreakTempVariables struct {
 	currentLineBreakWidth int
+	lineWidth int // logical width of a single line (column)
 	consecutiveLineBreaks int
-	maxLineAdvance int
 	lineBreaksOnly bool
+	lineIndent int // y where the current line starts
 }
 
-func (self *vertLayoutLineBreakTempVariables) Init(width int) {
-	self.currentLineBreakWidth = width
+func (self *vertLayoutLineBreakTempVariables) Init(lineBreakWidth, lineWidth int) {
+	self.currentLineBreakWidth = lineBreakWidth
+	self.lineWidth = lineWidth
 	self.lineBreaksOnly = true
 }
 
@@ -102,41 +125,39 @@ func (self *vertLayoutLineBreakTempVariables) NotifyNonBreak() {
 	self.consecutiveLineBreaks = 0
 }
 
-func (self *vertLayoutLineBreakTempVariables) UpdateMaxRightAdvance(advance int) {
-	self.maxLineAdvance = max(self.maxLineAdvance, advance)
-}
-
-// Side effects: updates renderer.run.isMultiline, renderer.run.lineLengths,
-//               renderer.run.bottom. You have to update renderer.run.right
-//               with the returned value manually if necessary.
-func (self *vertLayoutLineBreakTempVariables) NotifyBreak(renderer *Renderer, top, bottom, x int) int {
+// Side effects: updates renderer.run.isMultiline, renderer.run.lineLengths
+//               and renderer.run.bottom. Returns the x of the next line.
+func (self *vertLayoutLineBreakTempVariables) NotifyBreak(renderer *Renderer, lineLen, x int) int {
 	// line break update
 	if !renderer.run.isMultiline && (!self.lineBreaksOnly || len(renderer.run.glyphIndices) > 1) {
 		renderer.run.isMultiline = true // NOTE: control glyphs might make ^ incorrect for twines
 	}
 	self.consecutiveLineBreaks += 1
-	lineLen := bottom - top
-	renderer.run.lineLengths = append(renderer.run.lineLengths, uint16(max(0, lineLen))) // the min is a big hack
-	if bottom > renderer.run.bottom { renderer.run.bottom = bottom }
-	if top    < renderer.run.top    { renderer.run.top    = top    }
-	self.maxLineAdvance = 0
+	self.appendLine(renderer, lineLen)
 	return x + renderer.adjustParLineBreakHeightFor(self.currentLineBreakWidth, self.consecutiveLineBreaks)
 }
 
-// Side effects: updates renderer.run.lineLengths, renderer.run.bottom and renderer.run.right
-func (self *vertLayoutLineBreakTempVariables) NotifyTextEnd(renderer *Renderer, y int) {
-	if y > renderer.run.bottom { renderer.run.bottom = y }
-	renderer.run.lineLengths = append(renderer.run.lineLengths, uint16(y))
-	renderer.run.right += self.maxLineAdvance
-	if self.lineBreaksOnly {
-		//renderer.run.right -= renderer.run.firstRowAscent
-	} else {
-		//renderer.run.right += renderer.run.lastRowDescent
-		// TODO: I don't know how do we translate this to vertical text.
-		//       we might need to memorize and pass extra info during the process.
-		// I feel it should be only the advance in multi-line case, but
-		// I'm not sure about cases where line breaks happen at the end...
-		// and the advance is variable for the whole line. so, basically, if
-		// we end at this line, include the max advance, I guess..?
-	}
+// Side effects: updates renderer.run.lineLengths, renderer.run.bottom,
+//               renderer.run.left and renderer.run.right. The given x
+//               must be the x of the last line.
+func (self *vertLayoutLineBreakTempVariables) NotifyTextEnd(renderer *Renderer, lineLen, x int) {
+	self.appendLine(renderer, lineLen)
+	renderer.run.left  = -(self.lineWidth >> 1)
+	renderer.run.right = x + self.lineWidth - (self.lineWidth >> 1)
+}
+
+// Must be called after each break to start the new line. Returns the
+// y position where the line starts, which can only be non-zero for
+// twines with padders or line restart markers.
+func (self *vertLayoutLineBreakTempVariables) StartLine(renderer *Renderer, twining bool) int {
+	self.lineIndent = 0
+	if twining { self.lineIndent = renderer.twineOperator.LineStart() }
+	return self.lineIndent
+}
+
+func (self *vertLayoutLineBreakTempVariables) appendLine(renderer *Renderer, lineLen int) {
+	lineLen = max(0, lineLen)
+	renderer.run.lineLengths = append(renderer.run.lineLengths, uint16(lineLen))
+	renderer.run.lineIndents = append(renderer.run.lineIndents, uint16(self.lineIndent))
+	renderer.run.bottom = max(renderer.run.bottom, lineLen - renderer.run.firstRowAscent)
 }
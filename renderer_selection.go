@@ -0,0 +1,153 @@
+package ptxt
+
+import "image"
+import "slices"
+
+import "github.com/tinne26/ptxt/strand"
+
+// Appends the rectangles covering the glyphs in the [start, end) byte
+// range of the last measured or drawn text to the given slice, as if
+// the text was drawn at (x, y), and returns the resulting slice. There's
+// one rectangle for each line with selected glyphs. This is mainly
+// intended for drawing text selection highlights.
+//
+// With bidirectional text, a logical range can be split in multiple
+// visual pieces. In that case, lines get one rectangle for each group
+// of selected glyphs that are visually contiguous, from left to right.
+//
+// Rectangles depend on the current [BoundingMode]:
+//  - With [LogicalBounding], rectangles cover the advances of the
+//    selected glyphs and go from the font's ascent to its descent
+//    (or cover the whole line width for [Vertical] text).
+//  - With [MaskBounding], rectangles tightly wrap the selected glyph
+//    masks instead. Lines with only blank glyphs are skipped.
+//
+// Glyphs resulting from rewrite rules are selected if the offset of the
+// first rune they replace is within the range. For twines, offsets refer
+// to the raw twine contents, like in [Renderer.CaretAt]().
+func (self *Renderer) AppendSelectionRects(rects []image.Rectangle, x, y int, start, end int) []image.Rectangle {
+	if start > end { start, end = end, start }
+	if len(self.run.bidiLevels) > 0 { return self.appendBidiSelectionRects(rects, x, y, start, end) }
+	maskBounding := (self.boundingMode & ^noDescent == MaskBounding)
+
+	line := -1
+	var lineRect image.Rectangle
+	self.eachGlyphLayout(x, y, func(index int, layout GlyphLayout) {
+		if !isDrawableGlyph(layout.GlyphIndex) { return }
+		offset := int(self.run.glyphSources[index])
+		if offset < start || offset >= end { return }
+
+		var rect image.Rectangle
+		glyphStrand := self.Strand() // fallback strand, if any
+		if maskBounding {
+			rect = self.glyphMaskRect(glyphStrand, layout)
+		} else {
+			rect = self.glyphLogicalRect(glyphStrand, index, layout)
+		}
+		if rect.Empty() { return }
+		if layout.Line == line {
+			lineRect = lineRect.Union(rect)
+		} else {
+			if line != -1 { rects = append(rects, lineRect) }
+			line, lineRect = layout.Line, rect
+		}
+	})
+	if line != -1 { rects = append(rects, lineRect) }
+	return rects
+}
+
+// A glyph on the line being processed by appendBidiSelectionRects().
+type selectionGlyph struct {
+	x int // visual position, for sorting
+	rect image.Rectangle
+	selected bool
+}
+
+// Like AppendSelectionRects(), but splitting each line's rectangle
+// wherever unselected glyphs appear between selected ones once the
+// line has been visually reordered.
+func (self *Renderer) appendBidiSelectionRects(rects []image.Rectangle, x, y int, start, end int) []image.Rectangle {
+	maskBounding := (self.boundingMode & ^noDescent == MaskBounding)
+
+	line := -1
+	var glyphs []selectionGlyph
+	flushLine := func() {
+		slices.SortStableFunc(glyphs, func(a, b selectionGlyph) int { return a.x - b.x })
+		var pieceRect image.Rectangle
+		for _, glyph := range glyphs {
+			if !glyph.selected {
+				if !pieceRect.Empty() { rects = append(rects, pieceRect) }
+				pieceRect = image.Rectangle{}
+			} else if !glyph.rect.Empty() {
+				if pieceRect.Empty() { pieceRect = glyph.rect } else { pieceRect = pieceRect.Union(glyph.rect) }
+			}
+		}
+		if !pieceRect.Empty() { rects = append(rects, pieceRect) }
+		glyphs = glyphs[ : 0]
+	}
+	self.eachGlyphLayout(x, y, func(index int, layout GlyphLayout) {
+		if !isDrawableGlyph(layout.GlyphIndex) { return }
+		if layout.Line != line {
+			flushLine()
+			line = layout.Line
+		}
+
+		glyph := selectionGlyph{ x: layout.X }
+		offset := int(self.run.glyphSources[index])
+		glyph.selected = (offset >= start && offset < end)
+		if glyph.selected {
+			glyphStrand := self.Strand() // fallback strand, if any
+			if maskBounding {
+				glyph.rect = self.glyphMaskRect(glyphStrand, layout)
+			} else {
+				glyph.rect = self.glyphLogicalRect(glyphStrand, index, layout)
+			}
+		}
+		glyphs = append(glyphs, glyph)
+	})
+	flushLine()
+	return rects
+}
+
+func (self *Renderer) glyphLogicalRect(glyphStrand *strand.Strand, index int, layout GlyphLayout) image.Rectangle {
+	x, y, advance := layout.X, layout.Y, layout.Advance
+	switch self.direction {
+	case Horizontal, RightToLeft:
+		ascent, descent := self.caretMetrics(glyphStrand, layout.Scale)
+		return image.Rect(x, y - ascent, x + advance, y + descent)
+	case Vertical:
+		font := glyphStrand.Font()
+		placement := glyphPlacement(font, layout.GlyphIndex)
+		width := int(font.Metrics().VertLineWidth())*layout.Scale
+		centerX := x + int(self.run.horzShifts[index])
+		left := centerX - (width >> 1)
+		return image.Rect(left, y - int(placement.TopAdvance)*layout.Scale, left + width, y + int(placement.BottomAdvance)*layout.Scale)
+	case Sideways:
+		ascent, descent := self.caretMetrics(glyphStrand, layout.Scale)
+		return image.Rect(x - ascent, y - advance, x + descent, y)
+	case SidewaysRight:
+		ascent, descent := self.caretMetrics(glyphStrand, layout.Scale)
+		return image.Rect(x - descent, y, x + ascent, y + advance)
+	default:
+		panic("unexpected direction '" + self.direction.String() + "'")
+	}
+}
+
+func (self *Renderer) glyphMaskRect(glyphStrand *strand.Strand, layout GlyphLayout) image.Rectangle {
+	mask := self.loadMask(layout.GlyphIndex, glyphStrand.Font())
+	if mask == nil { return image.Rectangle{} }
+	bounds := mask.Bounds()
+	x, y, scale := layout.X, layout.Y, layout.Scale
+	minX, minY := bounds.Min.X*scale, bounds.Min.Y*scale
+	maxX, maxY := bounds.Max.X*scale, bounds.Max.Y*scale
+	switch self.direction {
+	case Horizontal, Vertical, RightToLeft:
+		return image.Rect(x + minX, y + minY, x + maxX, y + maxY)
+	case Sideways:
+		return image.Rect(x + minY, y - maxX, x + maxY, y - minX)
+	case SidewaysRight:
+		return image.Rect(x - maxY, y + minX, x - minY, y + maxX)
+	default:
+		panic("unexpected direction '" + self.direction.String() + "'")
+	}
+}
@@ -0,0 +1,168 @@
+package ptxt
+
+import "github.com/tinne26/ptxt/strand"
+
+// Explicit tab stop for [RendererAdvanced.SetTabStops]().
+type TabStop struct {
+	Position int // distance from the start of the line, in pixels (already scaled)
+	Align Align // [Left], [HorzCenter] or [Right]
+}
+
+// Sets the width of default tab stops as a number of spaces, using
+// the space glyph of the strand active at each tab (fonts without a
+// space glyph use the width of the standard notdef glyph instead).
+// Default tab stops are placed at multiples of this width, after any
+// explicit tab stops (see [RendererAdvanced.SetTabStops]()). Zero
+// makes tabs advance only to explicit tab stops. The default is 4.
+//
+// Tabs are only supported for fonts that don't map '\t' to a glyph,
+// and they don't have any effect with the [Vertical] direction.
+func (self *RendererAdvanced) SetTabSpaces(n int) {
+	if n < 0 { panic("negative tab spaces") }
+	self.tabSpaces = n
+}
+
+// Returns the width of default tab stops in spaces. See
+// [RendererAdvanced.SetTabSpaces]().
+func (self *RendererAdvanced) GetTabSpaces() int {
+	return self.tabSpaces
+}
+
+// Sets explicit tab stops, which must be sorted by position. Each
+// tab advances to the first tab stop past the current position, and
+// the text up to the next tab or line break is aligned to it:
+//  - [Left]: the text starts at the tab stop.
+//  - [Right]: the text ends at the tab stop.
+//  - [HorzCenter]: the text is centered at the tab stop.
+// If the text doesn't fit before the tab stop, it starts right after
+// the tab instead. Past the last explicit tab stop, default tab stops
+// are used (see [RendererAdvanced.SetTabSpaces]()).
+//
+// For example, to draw a stats table with a left aligned name column
+// and two right aligned columns:
+//   renderer.Advanced().SetTabStops(
+//       ptxt.TabStop{ Position: 96, Align: ptxt.Right },
+//       ptxt.TabStop{ Position: 144, Align: ptxt.Right },
+//   )
+//   renderer.Draw(target, "Name\tATK\tDEF\nSlime\t3\t12", x, y)
+//
+// Calling the method without arguments clears the tab stops.
+func (self *RendererAdvanced) SetTabStops(stops ...TabStop) {
+	for i, stop := range stops {
+		switch stop.Align {
+		case Left, HorzCenter, Right: // ok
+		default:
+			panic("invalid tab stop align '" + stop.Align.String() + "'")
+		}
+		if i > 0 && stop.Position <= stops[i - 1].Position {
+			panic("tab stops must be sorted by position")
+		}
+	}
+	self.tabStops = append(self.tabStops[ : 0], stops...)
+	self.ClearLayoutCache()
+}
+
+// Returns the explicit tab stops. The returned slice must not be
+// modified. See [RendererAdvanced.SetTabStops]().
+func (self *RendererAdvanced) GetTabStops() []TabStop {
+	return self.tabStops
+}
+
+// Returns the position and align of the first tab stop past the
+// given x.
+func (self *Renderer) nextTabStop(x int, fontStrand *strand.Strand, scale int) (int, Align) {
+	for _, stop := range self.tabStops {
+		if stop.Position > x { return stop.Position, stop.Align }
+	}
+
+	tabWidth := self.tabSpaces*strandSpaceWidth(fontStrand)*scale
+	if tabWidth <= 0 { return x, Left }
+	return (x/tabWidth + 1)*tabWidth, Left
+}
+
+// Unscaled advance of the space glyph, including interspacing.
+func strandSpaceWidth(fontStrand *strand.Strand) int {
+	font := fontStrand.Font()
+	settings := fontStrand.UnderlyingSettingsCache().UnsafeSlice()
+	group, found := font.Mapping().Utf8(' ', settings)
+	var width int
+	if found && group.Size() > 0 {
+		width = glyphAdvance(font, group.Select(0))
+	} else {
+		width, _ = notdefSize(font)
+	}
+	return width + strandFullGlyphInterspacing(fontStrand)
+}
+
+// Tabs are left on renderer.run.glyphIndices as internal.TabGlyph
+// control glyphs. Their advance is the distance to the tab stop, but
+// for right and center aligned tab stops the advance can only be
+// computed once we know the width of the text that follows, so it's
+// resolved when reaching the next tab, line break or text end.
+type layoutTabTempVariables struct {
+	pendingIndex int // index of the tab glyph pending resolution, or -1
+	start int // x where the pending tab starts
+	stop int
+	align Align
+	maskLeft int // mask layout values at the pending tab, to see if they
+	maskRight int // change before the tab is resolved
+}
+
+func (self *layoutTabTempVariables) Init() {
+	self.pendingIndex = -1
+}
+
+// Returns the advance of the tab at the given index, which must be
+// applied to x. Pending tabs must be resolved before calling this
+// method.
+func (self *layoutTabTempVariables) Tab(renderer *Renderer, index int, x int, fontStrand *strand.Strand, scale int) int {
+	if self.pendingIndex != -1 { panic(brokenCode) }
+	stop, align := renderer.nextTabStop(x, fontStrand, scale)
+	if align == Left {
+		renderer.run.advances[index] = uint16(stop - x)
+		return stop - x
+	}
+	renderer.run.advances[index] = 0
+	self.pendingIndex, self.start, self.stop, self.align = index, x, stop, align
+	return 0
+}
+
+// Memorizes the mask layout values at the last pending tab.
+func (self *layoutTabTempVariables) NotifyMaskValues(maskLeft, maskRight int) {
+	self.maskLeft, self.maskRight = maskLeft, maskRight
+}
+
+// Resolves the pending tab, if any, given the x where the text that
+// follows it ends. Returns the shift that must be applied to x.
+func (self *layoutTabTempVariables) Resolve(renderer *Renderer, x int) int {
+	if self.pendingIndex == -1 { return 0 }
+	var shift int
+	switch self.align {
+	case Right      : shift = self.stop - x
+	case HorzCenter : shift = self.stop - ((self.start + x) >> 1)
+	default:
+		panic(brokenCode)
+	}
+	shift = min(max(shift, 0), 65535)
+	renderer.run.advances[self.pendingIndex] = uint16(shift)
+	self.pendingIndex = -1
+	return shift
+}
+
+// Like Resolve(), but also shifting the given mask bounds if they
+// have changed since the pending tab. Returns the shifted x, mask
+// left and mask right.
+func (self *layoutTabTempVariables) ResolveMask(renderer *Renderer, x, maskLeft, maskRight int) (int, int, int) {
+	if self.pendingIndex == -1 { return x, maskLeft, maskRight }
+	leftChanged, rightChanged := (maskLeft != self.maskLeft), (maskRight != self.maskRight)
+	shift := self.Resolve(renderer, x)
+	if leftChanged  { maskLeft  += shift }
+	if rightChanged { maskRight += shift }
+	return x + shift, maskLeft, maskRight
+}
+
+// Must be called after line wraps, with the index where layout will
+// continue. Pending tabs that will be processed again are discarded.
+func (self *layoutTabTempVariables) NotifyWrap(index int) {
+	if self.pendingIndex >= index { self.pendingIndex = -1 }
+}
@@ -0,0 +1,108 @@
+package ptxt
+
+import "image"
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
+func TestTabs(t *testing.T) {
+	// build a small font with 4 pixel wide letters and a 2 pixel wide space
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(0)
+	for _, codePoint := range []rune{ 'a', 'b', ' ' } {
+		width := 4
+		if codePoint == ' ' { width = 2 }
+		mask := image.NewAlpha(image.Rect(0, -4, width, 0))
+		for i := range mask.Pix { mask.Pix[i] = 255 }
+		uid, err := fontBuilder.AddGlyph(mask)
+		if err != nil { t.Fatal(err) }
+		err = fontBuilder.Map(codePoint, uid)
+		if err != nil { t.Fatal(err) }
+	}
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+
+	// create strand and renderer
+	fontStrand, err := NewStrand(font)
+	if err != nil { t.Fatal(err) }
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+
+	// default tab stops (4 spaces, 8 pixels)
+	tests := []struct {
+		text string
+		width int
+	}{
+		{ "a\tb", 12 },
+		{ "ab\tb", 20 },
+		{ "\tab", 16 },
+		{ "a\t\tb", 20 },
+		{ "a\tb\nab\tb", 20 },
+	}
+	for _, test := range tests {
+		width, _ := renderer.Measure(test.text)
+		if width != test.width {
+			t.Fatalf("%q: expected width %d, got %d", test.text, test.width, width)
+		}
+	}
+	renderer.Advanced().SetTabSpaces(0)
+	width, _ := renderer.Measure("a\tb")
+	if width != 8 {
+		t.Fatalf("expected width 8 without tab spaces, got %d", width)
+	}
+	renderer.Advanced().SetTabSpaces(4)
+
+	// explicit tab stops
+	stopTests := []struct {
+		stop TabStop
+		text string
+		width int
+	}{
+		{ TabStop{ Position: 20, Align: Left }, "a\tbb", 28 },
+		{ TabStop{ Position: 20, Align: Right }, "a\tbb", 20 },
+		{ TabStop{ Position: 20, Align: HorzCenter }, "a\tbb", 24 },
+		{ TabStop{ Position: 20, Align: Right }, "a\tbbbbbb", 28 }, // too wide for the stop
+		{ TabStop{ Position: 20, Align: Right }, "a\tb\nab\tb", 20 },
+		{ TabStop{ Position: 20, Align: Right }, "a\tb\tb", 28 }, // default stop afterwards
+	}
+	for _, boundingMode := range []BoundingMode{ LogicalBounding, MaskBounding } {
+		renderer.Advanced().SetBoundingMode(boundingMode)
+		for _, test := range stopTests {
+			renderer.Advanced().SetTabStops(test.stop)
+			width, _ := renderer.Measure(test.text)
+			if width != test.width {
+				t.Fatalf("%s, %q with %s tab stop: expected width %d, got %d", boundingMode, test.text, test.stop.Align, test.width, width)
+			}
+		}
+	}
+	renderer.Advanced().SetBoundingMode(LogicalBounding)
+
+	// drawing
+	renderer.Advanced().SetTabStops(TabStop{ Position: 20, Align: Right })
+	var drawnX []int
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawnX = append(drawnX, params.X)
+		},
+	)
+	renderer.Draw(nil, "a\tbb", 0, 0)
+	if len(drawnX) != 3 || drawnX[0] != 0 || drawnX[1] != 12 || drawnX[2] != 16 {
+		t.Fatalf("unexpected drawn glyph positions %v", drawnX)
+	}
+	renderer.Advanced().SetDrawFunc(nil)
+
+	// invalid tab stops
+	func() {
+		defer func() {
+			if recover() == nil { t.Fatal("expected panic on unsorted tab stops") }
+		}()
+		renderer.Advanced().SetTabStops(TabStop{ Position: 20, Align: Left }, TabStop{ Position: 10, Align: Left })
+	}()
+}
@@ -1,82 +1,318 @@
 package ptxt
 
+import "fmt"
+import "unicode/utf8"
+
 import "github.com/tinne26/ptxt/core"
+import "github.com/tinne26/ptxt/strand"
+import "github.com/tinne26/ptxt/internal"
+
+import "github.com/tinne26/ggfnt"
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Related to [RendererTwine.RegisterFunc](). Only up to 255
 // functions can be registered.
 type TwineFuncID uint8
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // This type exists only for documentation and structuring purposes,
 // acting as a [gateway] to [Twine] operations and related configurations.
 //
 // In general, this type is used through method chaining:
 //   renderer.Twine().Draw(canvas, twine, x, y)
 //
+// Twines can switch strands, scales and colors mid-text. Each line
+// takes the metrics of the tallest strand and scale used on it, and
+// kerning is not applied across strand or scale changes.
+//
+// With [Vertical] text, column widths always follow the renderer's
+// strand and scale, and gfx effects ([Twine.PushGfxFront]() and
+// [Twine.PushGfxBack]()) are not drawn. With [RightToLeft] and other
+// bidirectional text, gfx effect rectangles follow the logical order
+// of the glyphs, so they are only exact for lines that don't mix
+// directions.
+//
 // [gateway]: https://pkg.go.dev/github.com/tinne26/ptxt#Renderer
 type RendererTwine Renderer
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Like [Renderer.Draw](), but accepting a twine instead of a string.
 func (self *RendererTwine) Draw(target core.Target, twine Twine, x, y int) {
-	panic("unimplemented")
+	self.DrawWithWrap(target, twine, x, y, maxInt32)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Like [Renderer.DrawWithWrap](), but accepting a twine instead of a string.
 func (self *RendererTwine) DrawWithWrap(target core.Target, twine Twine, x, y int, maxLineLen int) {
-	panic("unimplemented")
+	renderer := (*Renderer)(self)
+	renderer.twineToGlyphs(twine, strand.DrawPass)
+	renderer.computeRunLayout(maxLineLen)
+	x, y = renderer.computeTextOrigin(x, y)
+	renderer.drawText(target, x, y)
+	renderer.finishTwinePasses(strand.DrawPass)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Like [Renderer.Measure](), but accepting a twine instead of a string.
-func (self *RendererTwine) Measure(twine Twine) {
-	panic("unimplemented")
+func (self *RendererTwine) Measure(twine Twine) (width, height int) {
+	return self.MeasureWithWrap(twine, maxInt32)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Like [Renderer.MeasureWithWrap](), but accepting a twine instead of a string.
-func (self *RendererTwine) MeasureWithWrap(twine Twine, maxLineLen int) {
-	panic("unimplemented")
+func (self *RendererTwine) MeasureWithWrap(twine Twine, maxLineLen int) (width, height int) {
+	renderer := (*Renderer)(self)
+	renderer.twineToGlyphs(twine, strand.MeasurePass)
+	renderer.computeRunLayout(maxLineLen)
+	renderer.finishTwinePasses(strand.MeasurePass)
+	return self.run.right - self.run.left, self.run.bottom - self.run.top
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Like [RendererAdvanced.Cache](), but accepting a twine instead of a string.
 func (self *RendererTwine) Cache(twine Twine) {
-	panic("unimplemented")
+	renderer := (*Renderer)(self)
+	renderer.twineEach(twine,
+		func(fontStrand *strand.Strand, codePoint rune) bool {
+			settings := fontStrand.UnderlyingSettingsCache().UnsafeSlice()
+			group, found := fontStrand.Font().Mapping().Utf8(codePoint, settings)
+			if !found { return true }
+			for i := uint8(0); i < group.Size(); i++ {
+				_ = renderer.loadMask(group.Select(i), fontStrand.Font())
+			}
+			return true
+		},
+		func(fontStrand *strand.Strand, glyphIndex ggfnt.GlyphIndex) bool {
+			if uint16(glyphIndex) < fontStrand.Font().Glyphs().Count() {
+				_ = renderer.loadMask(glyphIndex, fontStrand.Font())
+			}
+			return true
+		},
+	)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Like [RendererAdvanced.AllGlyphsAvailable](), but accepting a twine instead of a string.
-func (self *RendererTwine) AllGlyphsAvailable(text string) bool {
-	panic("unimplemented")
+// Glyph indices added directly to the twine are also checked.
+func (self *RendererTwine) AllGlyphsAvailable(twine Twine) bool {
+	return (*Renderer)(self).twineEach(twine,
+		func(fontStrand *strand.Strand, codePoint rune) bool {
+			settings := fontStrand.UnderlyingSettingsCache().UnsafeSlice()
+			_, found := fontStrand.Font().Mapping().Utf8(codePoint, settings)
+			return found
+		},
+		func(fontStrand *strand.Strand, glyphIndex ggfnt.GlyphIndex) bool {
+			return glyphIndex >= ggfnt.MaxGlyphs || uint16(glyphIndex) < fontStrand.Font().Glyphs().Count()
+		},
+	)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Registers a function for use with twine effects. Only a strict
 // set of signatures are valid:
-//  - func(args ptxt.TwineEffectArgs)
-//  - func(args ptxt.TwineEffectArgs, target *ebiten.Image, targetArea image.Rectangle)
-//  - ... (TODO)
-// Nil functions are not allowed.
+//  - [TwineMotionFunc], for [Twine.PushMotion]().
+//  - [TwineColorChangerFunc], for [Twine.PushColorChanger]().
+//  - [TwineGfxFunc], for [Twine.PushGfxFront]() and [Twine.PushGfxBack]().
+// Nil functions are not allowed. Only up to 255 functions can be
+// registered at the same time on a single renderer.
+//
+// Function IDs are only valid for the renderer where the functions
+// were registered.
 func (self *RendererTwine) RegisterFunc(fn any) TwineFuncID {
-	panic("unimplemented")
+	switch typedFn := fn.(type) {
+	case TwineMotionFunc:
+		if typedFn == nil { panic("can't register a nil function") }
+	case TwineColorChangerFunc:
+		if typedFn == nil { panic("can't register a nil function") }
+	case TwineGfxFunc:
+		if typedFn == nil { panic("can't register a nil function") }
+	default:
+		panic(fmt.Sprintf("[ptxt.RendererTwine.RegisterFunc] unsupported function type %T", fn))
+	}
+
+	for i, registeredFn := range self.twineFuncs {
+		if registeredFn != nil { continue }
+		self.twineFuncs[i] = fn
+		return TwineFuncID(i)
+	}
+	if len(self.twineFuncs) >= 255 { panic("can't register more than 255 twine functions") }
+	self.twineFuncs = append(self.twineFuncs, fn)
+	return TwineFuncID(len(self.twineFuncs) - 1)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // Releases a previously registered function. The given ID might be
-// reused next time you register a new function.
+// reused next time you register a new function. Returns false if
+// no function was registered with the given ID.
 func (self *RendererTwine) ReleaseFunc(id TwineFuncID) bool {
-	panic("unimplemented")
+	if int(id) >= len(self.twineFuncs) || self.twineFuncs[id] == nil { return false }
+	self.twineFuncs[id] = nil
+	for len(self.twineFuncs) > 0 && self.twineFuncs[len(self.twineFuncs) - 1] == nil {
+		self.twineFuncs = self.twineFuncs[ : len(self.twineFuncs) - 1]
+	}
+	return true
+}
+
+// Sets the tick passed to twine functions through [TwineEffectArgs].Tick.
+// Motions and other animated effects use it as their time reference,
+// so you typically want to increase it once per game update:
+//   renderer.Twine().SetTick(renderer.Twine().GetTick() + 1)
+func (self *RendererTwine) SetTick(tick uint64) {
+	self.twineTick = tick
+}
+
+// Returns the tick passed to twine functions. See [RendererTwine.SetTick]().
+func (self *RendererTwine) GetTick() uint64 {
+	return self.twineTick
+}
+
+// ---- internal helpers ----
+
+// Returns the registered twine function for the given ID, or nil
+// if no function is registered with it.
+func (self *Renderer) getTwineFunc(id uint8) any {
+	if int(id) >= len(self.twineFuncs) { return nil }
+	return self.twineFuncs[id]
+}
+
+// Converts the twine contents to glyph indices. Directives are left
+// in the glyph indices as internal.TwineEffectMarkerGlyph followed by
+// the directive offset within the twine contents. Source offsets are
+// recorded on renderer.run.glyphSources like on textToGlyphs(), with
+// raw glyphs and directives using their own offsets.
+//
+// Glyph picker passes are started lazily for each strand as it's
+// reached, and must be closed with finishTwinePasses() afterwards.
+func (self *Renderer) twineToGlyphs(twine Twine, pass strand.GlyphPickerPass) {
+	if self.Strand() == nil {
+		panic("ptxt.Renderer can't operate with a nil strand... maybe someone forgot to Renderer.SetStrand()?")
+	}
+	if len(twine.contents) > 65535 { panic("twine contents exceeding 64KiB") }
+
+	contents := twine.contents
+	self.run.twineContents = contents
+	self.run.twineStrands = self.run.twineStrands[ : 0]
+	self.run.twineGfxFlags = 0
+	self.run.glyphIndices = self.run.glyphIndices[ : 0]
+	self.run.glyphSources = self.run.glyphSources[ : 0]
+	self.run.runeOffsets  = self.run.runeOffsets[ : 0]
+	self.run.sourceLen = len(contents)
+	self.twineOperator.BeginMapping(self, contents)
+	mapping := self.beginTwineStrandPass(pass)
+	var consumed int
+	for offset := 0; offset < len(contents); {
+		if contents[offset] != twineCcBegin {
+			codePoint, size := utf8.DecodeRune(contents[offset : ])
+			self.run.runeOffsets = append(self.run.runeOffsets, uint32(offset))
+			self.run.glyphIndices = lnkAppendCodePoint(mapping, codePoint, self.run.glyphIndices)
+			consumed = self.appendGlyphSources(consumed, len(self.run.runeOffsets) - lnkNumPendingInputs(mapping))
+			offset += size
+		} else if contents[offset + 1] == twineCcGlyphs {
+			numGlyphs := int(contents[offset + 2]) | int(contents[offset + 3]) << 8
+			numGlyphsInFont := self.Strand().Font().Glyphs().Count()
+			for i := 0; i < numGlyphs; i++ {
+				glyphOffset := offset + 4 + (i << 1)
+				glyphIndex := ggfnt.GlyphIndex(contents[glyphOffset]) | ggfnt.GlyphIndex(contents[glyphOffset + 1]) << 8
+				if glyphIndex < ggfnt.MaxGlyphs {
+					if uint16(glyphIndex) >= numGlyphsInFont {
+						panic("twine glyph index not present on the active strand's font")
+					}
+					self.run.runeOffsets = append(self.run.runeOffsets, uint32(glyphOffset))
+					self.run.glyphIndices = lnkAppendGlyphIndex(mapping, glyphIndex, self.run.glyphIndices)
+					consumed = self.appendGlyphSources(consumed, len(self.run.runeOffsets) - lnkNumPendingInputs(mapping))
+				} else {
+					if glyphIndex == internal.TwineEffectMarkerGlyph || glyphIndex == internal.MissingSpaceGlyph || glyphIndex == internal.NotdefGlyph {
+						panic("twine using a reserved control glyph index")
+					}
+					self.run.glyphIndices = lnkBreakMapping(mapping, self.run.glyphIndices)
+					consumed = self.appendGlyphSources(consumed, len(self.run.runeOffsets))
+					self.run.glyphIndices = append(self.run.glyphIndices, glyphIndex)
+					self.run.glyphSources = append(self.run.glyphSources, uint32(glyphOffset))
+				}
+			}
+			offset += twineCcLen(contents, offset)
+		} else { // directive
+			switch contents[offset + 1] {
+			case twineCcPushGfxBack  : self.run.twineGfxFlags |= twineGfxBackFlag
+			case twineCcPushGfxFront : self.run.twineGfxFlags |= twineGfxFrontFlag
+			}
+			self.run.glyphIndices = lnkBreakMapping(mapping, self.run.glyphIndices)
+			consumed = self.appendGlyphSources(consumed, len(self.run.runeOffsets))
+			self.run.glyphIndices = append(self.run.glyphIndices, internal.TwineEffectMarkerGlyph, ggfnt.GlyphIndex(offset))
+			self.run.glyphSources = append(self.run.glyphSources, uint32(offset), uint32(offset))
+			if self.twineOperator.Apply(offset) & twineStrandChange != 0 {
+				mapping = self.beginTwineStrandPass(pass)
+			}
+			offset += twineCcLen(contents, offset)
+		}
+
+		if len(self.run.glyphIndices) > 32000 {
+			panic("text run exceeding 32k glyph indices")
+		}
+	}
+	self.twineOperator.End()
+
+	// flush any pending glyphs (only the last strand can have them)
+	for _, fontStrand := range self.run.twineStrands {
+		self.run.glyphIndices = lnkFinishMapping(fontStrand.Mapping(), self.run.glyphIndices)
+	}
+	_ = self.appendGlyphSources(consumed, len(self.run.runeOffsets))
+	self.insertSoftHyphens(twineRuneAt(contents))
+	self.computeRuleBreaks(twineRuneAt(contents))
+	self.computeBidiLevels(twineRuneAt(contents))
+}
+
+const (
+	twineGfxBackFlag  uint8 = 0b01
+	twineGfxFrontFlag uint8 = 0b10
+)
+
+// Begins the glyph picker pass for the active strand if it hadn't
+// been started yet, and returns the strand's mapping.
+func (self *Renderer) beginTwineStrandPass(pass strand.GlyphPickerPass) *strand.StrandMapping {
+	fontStrand := self.Strand()
+	for _, passStrand := range self.run.twineStrands {
+		if passStrand == fontStrand { return fontStrand.Mapping() }
+	}
+	
+	err := lnkBeginPass(fontStrand.Mapping(), pass, uint8(self.glyphMissPolicy))
+	if err != nil { panic(err) }
+	self.run.twineStrands = append(self.run.twineStrands, fontStrand)
+	return fontStrand.Mapping()
+}
+
+func (self *Renderer) finishTwinePasses(pass strand.GlyphPickerPass) {
+	for _, fontStrand := range self.run.twineStrands {
+		lnkFinishPass(fontStrand.Mapping(), pass)
+	}
+}
+
+// Iterates the twine code points and glyph indices, passing the strand
+// active at each point to the given functions. If any function returns
+// false, the iteration stops and the method returns false.
+func (self *Renderer) twineEach(twine Twine, codePointFn func(*strand.Strand, rune) bool, glyphFn func(*strand.Strand, ggfnt.GlyphIndex) bool) bool {
+	if self.Strand() == nil {
+		panic("ptxt.Renderer can't operate with a nil strand... maybe someone forgot to Renderer.SetStrand()?")
+	}
+
+	contents := twine.contents
+	self.twineOperator.BeginMapping(self, contents)
+	for offset := 0; offset < len(contents); {
+		if contents[offset] != twineCcBegin {
+			codePoint, size := utf8.DecodeRune(contents[offset : ])
+			if !codePointFn(self.Strand(), codePoint) {
+				self.twineOperator.End()
+				return false
+			}
+			offset += size
+			continue
+		}
+		
+		if contents[offset + 1] == twineCcGlyphs {
+			numGlyphs := int(contents[offset + 2]) | int(contents[offset + 3]) << 8
+			for i := 0; i < numGlyphs; i++ {
+				glyphOffset := offset + 4 + (i << 1)
+				glyphIndex := ggfnt.GlyphIndex(contents[glyphOffset]) | ggfnt.GlyphIndex(contents[glyphOffset + 1]) << 8
+				if !glyphFn(self.Strand(), glyphIndex) {
+					self.twineOperator.End()
+					return false
+				}
+			}
+		} else {
+			_ = self.twineOperator.Apply(offset)
+		}
+		offset += twineCcLen(contents, offset)
+	}
+	self.twineOperator.End()
+	return true
 }
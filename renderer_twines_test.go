@@ -0,0 +1,529 @@
+package ptxt
+
+import "testing"
+import "slices"
+import "image"
+import "image/color"
+
+import "github.com/tinne26/ptxt/core"
+import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ptxt/strand"
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
+func TestTwineMeasure(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	// plain twines must measure like strings
+	for _, text := range []string{ "", "HEY HO", "HEY\nHO", "\n", "HEY HO HEY HO\n\nHEY" } {
+		for _, maxLineLen := range []int{ 12, 30, maxInt32 } {
+			sw, sh := renderer.MeasureWithWrap(text, maxLineLen)
+			tw, th := renderer.Twine().MeasureWithWrap(Weave(text), maxLineLen)
+			if sw != tw || sh != th {
+				t.Fatalf("%q (max line len %d): string measure (%d, %d) != twine measure (%d, %d)", text, maxLineLen, sw, sh, tw, th)
+			}
+		}
+	}
+
+	// scale changes
+	ascent  := int(testFont.Metrics().Ascent())
+	descent := int(testFont.Metrics().Descent())
+	lineGap := int(testFont.Metrics().LineGap())
+	interspacing := int(testFont.Metrics().HorzInterspacing())
+	wA, _ := renderer.Measure("A")
+	renderer.SetScale(2)
+	wB2, _ := renderer.Measure("B")
+	renderer.SetScale(1)
+
+	var twine Twine
+	twine.Add("A").PushScale(2).Add("B").Pop()
+	w, h := renderer.Twine().Measure(twine)
+	if w != wA + interspacing + wB2 {
+		t.Fatalf("expected width %d, got %d", wA + interspacing + wB2, w)
+	}
+	if h != (ascent + descent)*2 {
+		t.Fatalf("expected height %d, got %d", (ascent + descent)*2, h)
+	}
+	if renderer.GetScale() != 1 {
+		t.Fatalf("expected renderer scale to be restored to 1, got %d", renderer.GetScale())
+	}
+
+	// each line must follow its tallest scale
+	twine.Reset()
+	twine.Add("A\n").PushScale(2).Add("B").Pop().Add("\nC")
+	_, h = renderer.Twine().Measure(twine)
+	expected := ascent + (descent + lineGap + ascent*2) + (descent*2 + lineGap*2 + ascent) + descent
+	if h != expected {
+		t.Fatalf("expected multiline height %d, got %d", expected, h)
+	}
+
+	// strand changes
+	renderer.Strands().Add(strand)
+	w1, h1 := renderer.Measure("HEY HO")
+	w2, h2 := renderer.Twine().Measure(Weave("HEY ", StrandIndex(1), "HO"))
+	if w1 != w2 || h1 != h2 {
+		t.Fatalf("expected strand switch to same font to preserve measure (%d, %d), got (%d, %d)", w1, h1, w2, h2)
+	}
+	if renderer.Strands().Index() != 0 {
+		t.Fatal("expected renderer strand index to be restored")
+	}
+}
+
+func TestTwineDraw(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	type drawnGlyph struct { glyphIndex ggfnt.GlyphIndex ; params MaskDrawParameters }
+	var glyphs []drawnGlyph
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			glyphs = append(glyphs, drawnGlyph{ glyphIndex, params })
+		},
+	)
+
+	// colors and scales
+	red := color.RGBA{255, 0, 0, 255}
+	renderer.Twine().Draw(nil, Weave("A", red, "B", Pop, "C"), 0, 0)
+	if len(glyphs) != 3 {
+		t.Fatalf("expected 3 glyphs drawn, got %d", len(glyphs))
+	}
+	white := [4]float32{1, 1, 1, 1}
+	if glyphs[0].params.RGBA != white || glyphs[2].params.RGBA != white {
+		t.Fatal("expected glyphs outside the color push to be white")
+	}
+	if glyphs[1].params.RGBA != [4]float32{1, 0, 0, 1} {
+		t.Fatalf("expected red glyph, got %v", glyphs[1].params.RGBA)
+	}
+
+	// wrapped twines must draw like manually broken twines
+	var wrapped, manual Twine
+	wrapped.Add("AA BB ").PushScale(2).Add("CC").Pop().Add(" D")
+	manual.Add("AA BB\n").PushScale(2).Add("CC").Pop().Add(" \nD") // last space fits
+	w, _ := renderer.Twine().Measure(Weave("AA BB"))
+	for _, align := range []Align{ Top | Left, Center, LastBaseline | Right } {
+		renderer.SetAlign(align)
+		glyphs = glyphs[ : 0]
+		renderer.Twine().DrawWithWrap(nil, wrapped, 0, 0, w)
+		wrappedGlyphs := append([]drawnGlyph(nil), glyphs...)
+		glyphs = glyphs[ : 0]
+		renderer.Twine().Draw(nil, manual, 0, 0)
+		if !slices.Equal(wrappedGlyphs, glyphs) {
+			t.Fatalf("align %s: wrapped twine draw not matching manual break draw\n%v\n%v", align, wrappedGlyphs, glyphs)
+		}
+	}
+}
+
+func TestTwineDirections(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	var positions [][2]int
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			positions = append(positions, [2]int{ params.X, params.Y })
+		},
+	)
+
+	for _, direction := range []Direction{ Vertical, RightToLeft } {
+		renderer.SetDirection(direction)
+
+		// plain twines must draw and measure like strings
+		for _, text := range []string{ "HEY HO", "HEY\nHO" } {
+			positions = positions[ : 0]
+			renderer.DrawWithWrap(nil, text, 0, 0, 24)
+			expected := append([][2]int(nil), positions...)
+			positions = positions[ : 0]
+			renderer.Twine().DrawWithWrap(nil, Weave(text), 0, 0, 24)
+			if !slices.Equal(expected, positions) {
+				t.Fatalf("%s, %q: twine draw not matching string draw\n%v\n%v", direction, text, expected, positions)
+			}
+			sw, sh := renderer.MeasureWithWrap(text, 24)
+			tw, th := renderer.Twine().MeasureWithWrap(Weave(text), 24)
+			if sw != tw || sh != th {
+				t.Fatalf("%s, %q: string measure (%d, %d) != twine measure (%d, %d)", direction, text, sw, sh, tw, th)
+			}
+		}
+
+		// padding along the main axis
+		axis := 0
+		if direction == Vertical { axis = 1 }
+		positions = positions[ : 0]
+		renderer.Draw(nil, "AB", 0, 0)
+		advance := positions[1][axis] - positions[0][axis]
+		positions = positions[ : 0]
+		renderer.Twine().Draw(nil, Weave("A", TwinePadder{ PrePad: 3 }, Pop, "B"), 0, 0)
+		if len(positions) != 2 || positions[1][axis] - positions[0][axis] != advance + 3 {
+			t.Fatalf("%s: expected padded advance %d, got positions %v", direction, advance + 3, positions)
+		}
+	}
+}
+
+func TestTwineMotions(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	var positions [][2]int
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			positions = append(positions, [2]int{ params.X, params.Y })
+		},
+	)
+	
+	// function registry
+	motion := renderer.Twine().RegisterFunc(
+		func(args TwineEffectArgs, glyphNum int) (int, int) {
+			args.AssertPayloadLen(1)
+			return glyphNum, int(args.Payload[0])
+		},
+	)
+	other := renderer.Twine().RegisterFunc(TwineMotionFunc(func(TwineEffectArgs, int) (int, int) { return 0, 0 }))
+	if motion == other { t.Fatal("expected different function IDs") }
+	if !renderer.Twine().ReleaseFunc(other) { t.Fatal("expected function release to succeed") }
+	if renderer.Twine().ReleaseFunc(other) { t.Fatal("expected second function release to fail") }
+
+	// draw and compare with regular positions
+	renderer.Twine().Draw(nil, Weave("ABC"), 0, 0)
+	expected := append([][2]int(nil), positions...)
+	var twine Twine
+	twine.Add("A").PushMotion(motion, 3).Add("B").PushColor(color.RGBA{255, 0, 0, 255}).Add("C").Stop()
+	positions = positions[ : 0]
+	renderer.Twine().Draw(nil, twine, 0, 0)
+	if len(positions) != 3 { t.Fatalf("expected 3 glyphs drawn, got %d", len(positions)) }
+	if positions[0] != expected[0] { t.Fatal("expected first glyph to be unaffected by the motion") }
+	if positions[1] != [2]int{ expected[1][0], expected[1][1] + 3 } {
+		t.Fatalf("expected second glyph motion offsets (0, 3), got %v => %v", expected[1], positions[1])
+	}
+	if positions[2] != [2]int{ expected[2][0] + 1, expected[2][1] + 3 } {
+		t.Fatalf("expected third glyph motion offsets (1, 3), got %v => %v", expected[2], positions[2])
+	}
+
+	// offsets must be scaled
+	renderer.SetScale(2)
+	positions = positions[ : 0]
+	renderer.Twine().Draw(nil, Weave("ABC"), 0, 0)
+	expected = append(expected[ : 0], positions...)
+	positions = positions[ : 0]
+	renderer.Twine().Draw(nil, twine, 0, 0)
+	if positions[2] != [2]int{ expected[2][0] + 2, expected[2][1] + 6 } {
+		t.Fatalf("expected third glyph scaled motion offsets (2, 6), got %v => %v", expected[2], positions[2])
+	}
+}
+
+func TestTwineColorChangers(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	var colors [][4]float32
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			colors = append(colors, params.RGBA)
+		},
+	)
+
+	// red channel from glyph num, blue channel from payload
+	changer := renderer.Twine().RegisterFunc(
+		func(args TwineEffectArgs, glyphNum int, textColor color.RGBA) color.RGBA {
+			args.AssertPayloadLen(1)
+			textColor.R = uint8(glyphNum*51)
+			textColor.B = args.Payload[0]
+			return textColor
+		},
+	)
+	halver := renderer.Twine().RegisterFunc(
+		TwineColorChangerFunc(func(args TwineEffectArgs, glyphNum int, textColor color.RGBA) color.RGBA {
+			textColor.B /= 2
+			return textColor
+		}),
+	)
+
+	var twine Twine
+	twine.Add("A").PushColorChanger(changer, 0).Add("BC").PushColorChanger(halver).Add("D").Pop().Pop().Add("E")
+	renderer.Twine().Draw(nil, twine, 0, 0)
+	if len(colors) != 5 { t.Fatalf("expected 5 glyphs drawn, got %d", len(colors)) }
+	white := [4]float32{1, 1, 1, 1}
+	if colors[0] != white || colors[4] != white {
+		t.Fatalf("expected glyphs outside the color changer to be white, got %v", colors)
+	}
+	expected := [][4]float32{
+		internal.RGBAToFloat32(color.RGBA{0, 255, 0, 255}),
+		internal.RGBAToFloat32(color.RGBA{51, 255, 0, 255}),
+		internal.RGBAToFloat32(color.RGBA{102, 255, 0, 255}),
+	}
+	if !slices.Equal(colors[1 : 4], expected) {
+		t.Fatalf("expected color changer colors %v, got %v", expected, colors[1 : 4])
+	}
+
+	// chaining
+	twine.Reset()
+	twine.PushColor(color.RGBA{0, 0, 200, 255}).PushColorChanger(halver).Add("A").PushColorChanger(halver).Add("B")
+	colors = colors[ : 0]
+	renderer.Twine().Draw(nil, twine, 0, 0)
+	if colors[0] != internal.RGBAToFloat32(color.RGBA{0, 0, 100, 255}) || colors[1] != internal.RGBAToFloat32(color.RGBA{0, 0, 50, 255}) {
+		t.Fatalf("expected chained color changers to apply over the pushed color, got %v", colors)
+	}
+}
+
+func TestTwineGfx(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	var events []string
+	var glyphXs []int
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			events = append(events, "glyph")
+			glyphXs = append(glyphXs, params.X)
+		},
+	)
+	type gfxCall struct { args TwineEffectArgs ; rect image.Rectangle }
+	var calls []gfxCall
+	gfxFn := renderer.Twine().RegisterFunc(
+		func(target core.Target, args TwineEffectArgs, rect image.Rectangle) {
+			events = append(events, "gfx")
+			calls = append(calls, gfxCall{ args, rect })
+		},
+	)
+
+	// single line, back effect must come before glyphs
+	ascent  := int(testFont.Metrics().Ascent())
+	descent := int(testFont.Metrics().Descent())
+	var twine Twine
+	twine.Add("A").PushGfxBack(gfxFn, 7).Add("BC").Pop().Add("D")
+	renderer.Twine().Draw(nil, twine, 0, 0)
+	if len(calls) != 1 { t.Fatalf("expected 1 gfx call, got %d", len(calls)) }
+	if events[0] != "gfx" { t.Fatalf("expected back gfx to be drawn first, got %v", events) }
+	bcWidth, _ := renderer.Measure("BC")
+	expectedRect := image.Rect(glyphXs[1], -ascent, glyphXs[1] + bcWidth, descent)
+	if calls[0].rect != expectedRect {
+		t.Fatalf("expected gfx rect %v, got %v", expectedRect, calls[0].rect)
+	}
+	args := calls[0].args
+	if args.StartWrap || args.EndWrap || args.StartIndex != 0 || args.EndIndex != 2 || len(args.Payload) != 1 || args.Payload[0] != 7 {
+		t.Fatalf("unexpected gfx args %+v", args)
+	}
+
+	// wrapped front effect
+	events, calls, glyphXs = events[ : 0], calls[ : 0], glyphXs[ : 0]
+	twine.Reset()
+	twine.Add("AA ").PushGfxFront(gfxFn).Add("BB CC").Pop()
+	w, _ := renderer.Measure("AA BB")
+	renderer.Twine().DrawWithWrap(nil, twine, 0, 0, w)
+	if events[len(events) - 1] != "gfx" { t.Fatalf("expected front gfx to be drawn last, got %v", events) }
+	if len(calls) != 2 { t.Fatalf("expected 2 gfx calls, got %d", len(calls)) }
+	if calls[0].args.StartWrap || !calls[0].args.EndWrap || !calls[1].args.StartWrap || calls[1].args.EndWrap {
+		t.Fatalf("unexpected wrap flags %+v, %+v", calls[0].args, calls[1].args)
+	}
+	if calls[0].args.EndIndex != 2 || calls[1].args.StartIndex != 2 || calls[1].args.EndIndex != 4 {
+		t.Fatalf("unexpected segment indices %+v, %+v", calls[0].args, calls[1].args)
+	}
+	if calls[0].rect.Max.X != w || calls[1].rect.Min.X != 0 || calls[1].rect.Min.Y <= calls[0].rect.Min.Y {
+		t.Fatalf("unexpected segment rects %v, %v", calls[0].rect, calls[1].rect)
+	}
+
+}
+
+func TestTwineGfxFallbacks(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strands and renderer, with an elidable ideographic space
+	// that only exists on the fallback strand
+	fontStrand, _ := NewStrand(testFont)
+	fallback, _ := NewStrand(buildTestFont(t, newTestFontBuilder(t, []rune{ 'ñ', '\u3000' }, nil)))
+	fallback.SetWrapGlyphs(strand.WrapElide, []ggfnt.GlyphIndex{ 1 })
+	fontStrand.Mapping().SetFallbacks(fallback)
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+	renderer.Advanced().SetDrawFunc(func(core.Target, ggfnt.GlyphIndex, MaskDrawParameters) {})
+
+	type gfxCall struct { strand *strand.Strand ; rect image.Rectangle }
+	var calls []gfxCall
+	gfxFn := renderer.Twine().RegisterFunc(
+		func(target core.Target, args TwineEffectArgs, rect image.Rectangle) {
+			calls = append(calls, gfxCall{ args.Renderer.Strand(), rect })
+		},
+	)
+
+	// effects ending on fallback glyphs must see the strand where they were pushed
+	var twine Twine
+	twine.Add("A").PushGfxFront(gfxFn).Add("Bñ").Pop().Add("C")
+	renderer.Twine().Draw(nil, twine, 0, 0)
+	if len(calls) != 1 || calls[0].strand != fontStrand {
+		t.Fatalf("expected gfx effect to be called with the main strand, got %v", calls)
+	}
+
+	// trailing elidable fallback glyphs must be trimmed on wrapped segments
+	calls = calls[ : 0]
+	twine.Reset()
+	twine.PushGfxFront(gfxFn).Add("Bñ\u3000ñ").Pop()
+	w, _ := renderer.Measure("Bñ")
+	renderer.Twine().DrawWithWrap(nil, twine, 0, 0, w)
+	if len(calls) != 2 || calls[0].rect.Max.X != w {
+		t.Fatalf("expected first wrapped segment to end at %d, got %v", w, calls)
+	}
+}
+
+func TestTwinePadders(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	var glyphXs []int
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			glyphXs = append(glyphXs, params.X)
+		},
+	)
+
+	// pre and post padding, min width
+	wAA, _ := renderer.Measure("AA")
+	w, _ := renderer.Twine().Measure(Weave("A", TwinePadder{ PrePad: 3, PostPad: 2 }, Pop, "A"))
+	if w != wAA + 5 { t.Fatalf("expected width %d, got %d", wAA + 5, w) }
+	w, _ = renderer.Twine().Measure(Weave("A", TwinePadder{ PrePad: 3, MinWidth: 20 }, "A", Pop, "A"))
+	if w != wAA + 20 { t.Fatalf("expected width %d, got %d", wAA + 20, w) }
+	renderer.SetScale(2)
+	wAA2, _ := renderer.Measure("AA")
+	w, _ = renderer.Twine().Measure(Weave("A", TwinePadder{ PrePad: 3, PostPad: 2 }, Pop, "A"))
+	if w != wAA2 + 10 { t.Fatalf("expected scaled width %d, got %d", wAA2 + 10, w) }
+	w, _ = renderer.Twine().Measure(Weave("A", TwinePadder{ PrePad: 3, UnitsScaled: true }, Pop, "A"))
+	if w != wAA2 + 3 { t.Fatalf("expected unscaled width %d, got %d", wAA2 + 3, w) }
+	renderer.SetScale(1)
+
+	// draw must match layout
+	glyphXs = glyphXs[ : 0]
+	renderer.Twine().Draw(nil, Weave("A", TwinePadder{ PrePad: 3, MinWidth: 20 }, "A", Pop, "A"), 0, 0)
+	wA, _ := renderer.Measure("A")
+	if glyphXs[2] - glyphXs[0] != wAA - wA + 20 {
+		t.Fatalf("expected third glyph at %d, got %d", wAA - wA + 20, glyphXs[2] - glyphXs[0])
+	}
+
+	// line restart markers
+	var twine Twine
+	twine.Add("- ").PushLineRestartMarker().Add("AA BB").Pop()
+	maxLineLen, _ := renderer.Measure("- AA")
+	glyphXs = glyphXs[ : 0]
+	renderer.Twine().DrawWithWrap(nil, twine, 0, 0, maxLineLen)
+	if len(glyphXs) != 6 || glyphXs[4] != glyphXs[2] {
+		t.Fatalf("expected wrapped line to restart at marker (x = %d), got %v", glyphXs[2], glyphXs)
+	}
+	_, h1 := renderer.MeasureWithWrap("- AA BB", maxLineLen)
+	w, h2 := renderer.Twine().MeasureWithWrap(twine, maxLineLen)
+	if w != maxLineLen || h1 != h2 {
+		t.Fatalf("unexpected restart marker measure (%d, %d)", w, h2)
+	}
+
+	// line start and line break pads
+	twine.Reset()
+	twine.PushPadder(TwinePadder{ LineStartPad: 4, LineBreakPad: 7 }).Add("AA BB").Pop()
+	glyphXs = glyphXs[ : 0]
+	renderer.Twine().DrawWithWrap(nil, twine, 0, 0, wAA)
+	if len(glyphXs) != 4 || glyphXs[2] != glyphXs[0] + 4 {
+		t.Fatalf("expected wrapped line to start at line start pad, got %v", glyphXs)
+	}
+	w, _ = renderer.Twine().MeasureWithWrap(twine, wAA)
+	if w != wAA + 7 { t.Fatalf("expected width %d, got %d", wAA + 7, w) }
+
+	// inline icons
+	var iconRects []image.Rectangle
+	iconFn := renderer.Twine().RegisterFunc(
+		func(target core.Target, args TwineEffectArgs, rect image.Rectangle) {
+			iconRects = append(iconRects, rect)
+		},
+	)
+	twine.Reset()
+	twine.Add("A").PushGfxFront(iconFn).PushPadder(TwinePadder{ MinWidth: 9 }).Pop().Pop().Add("A")
+	glyphXs = glyphXs[ : 0]
+	renderer.Twine().Draw(nil, twine, 0, 0)
+	if len(iconRects) != 1 || iconRects[0].Dx() != 9 {
+		t.Fatalf("expected a single icon rect of width 9, got %v", iconRects)
+	}
+	if iconRects[0].Min.X != wAA - wA || glyphXs[1] != iconRects[0].Max.X {
+		t.Fatalf("expected icon rect between glyphs, got %v (glyphs at %v)", iconRects[0], glyphXs)
+	}
+}
+
+func TestTwineSettingChanges(t *testing.T) {
+	// build a small font with a setting to switch between two 'a' styles
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(0)
+	narrowUID, err := fontBuilder.AddGlyph(image.NewAlpha(image.Rect(0, -4, 2, 0)))
+	if err != nil { t.Fatal(err) }
+	wideUID, err := fontBuilder.AddGlyph(image.NewAlpha(image.Rect(0, -4, 5, 0)))
+	if err != nil { t.Fatal(err) }
+	key, err := fontBuilder.AddSetting("wide-a", "off", "on")
+	if err != nil { t.Fatal(err) }
+	mapSwitch, err := fontBuilder.AddSwitch(key)
+	if err != nil { t.Fatal(err) }
+	err = fontBuilder.MapWithSwitchSingles('a', mapSwitch, narrowUID, wideUID)
+	if err != nil { t.Fatal(err) }
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+
+	// create strand and renderer
+	strand, err := NewStrand(font)
+	if err != nil { t.Fatal(err) }
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	// scoped changes
+	var twine Twine
+	twine.Add("a").PushSettingChange(key, 1).Add("a").Pop().Add("a")
+	w, _ := renderer.Twine().Measure(twine)
+	if w != 2 + 5 + 2 { t.Fatalf("expected width %d, got %d", 2 + 5 + 2, w) }
+	if strand.GetSetting(key) != 0 { t.Fatal("expected setting to be restored") }
+
+	// changes must be undone even if never popped
+	twine.Reset()
+	twine.Add("a").PushSettingChange(key, 1).Add("aa")
+	w, _ = renderer.Twine().Measure(twine)
+	if w != 2 + 5 + 5 { t.Fatalf("expected width %d, got %d", 2 + 5 + 5, w) }
+	if strand.GetSetting(key) != 0 { t.Fatal("expected setting to be restored") }
+	w, _ = renderer.Measure("aaa")
+	if w != 2*3 { t.Fatalf("expected width %d after twine, got %d", 2*3, w) }
+
+	// nested changes
+	twine.Reset()
+	twine.PushSettingChange(key, 1).Add("a").PushSettingChange(key, 0).Add("a").Pop().Add("a").Pop()
+	w, _ = renderer.Twine().Measure(twine)
+	if w != 5 + 2 + 5 { t.Fatalf("expected width %d, got %d", 5 + 2 + 5, w) }
+	if strand.GetSetting(key) != 0 { t.Fatal("expected setting to be restored") }
+}
@@ -0,0 +1,108 @@
+package ptxt
+
+import "image"
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+import "github.com/tinne26/ggfnt/builder"
+
+func TestVertical(t *testing.T) {
+	// build a small vertical font with a 4x4 'a' and a 4x2 'b'
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(0)
+	fontBuilder.SetVertLayoutUsed(true)
+	err := fontBuilder.SetVertLineWidth(6)
+	if err != nil { t.Fatal(err) }
+	err = fontBuilder.SetVertLineGap(2)
+	if err != nil { t.Fatal(err) }
+	for _, codePoint := range []rune{ 'a', 'b' } {
+		height := 4
+		if codePoint == 'b' { height = 2 }
+		mask := image.NewAlpha(image.Rect(0, -height, 4, 0))
+		for i := range mask.Pix { mask.Pix[i] = 255 }
+		uid, err := fontBuilder.AddGlyph(mask)
+		if err != nil { t.Fatal(err) }
+		err = fontBuilder.Map(codePoint, uid)
+		if err != nil { t.Fatal(err) }
+	}
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+
+	// create strand and renderer
+	fontStrand, err := NewStrand(font)
+	if err != nil { t.Fatal(err) }
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+	renderer.SetDirection(Vertical)
+
+	// measuring
+	tests := []struct {
+		boundingMode BoundingMode
+		text string
+		wrap int
+		width, height int
+	}{
+		{ LogicalBounding, "ab", 0, 6, 10 },
+		{ LogicalBounding, "ab\nab", 0, 14, 10 },
+		{ LogicalBounding, "ab\na", 0, 14, 10 },
+		{ LogicalBounding, "abab", 10, 14, 10 },
+		{ MaskBounding, "ab", 0, 4, 9 },
+		{ MaskBounding, "ab\nab", 0, 12, 9 },
+		{ MaskBounding, "abab", 10, 12, 9 },
+	}
+	for _, test := range tests {
+		renderer.Advanced().SetBoundingMode(test.boundingMode)
+		var width, height int
+		if test.wrap == 0 {
+			width, height = renderer.Measure(test.text)
+		} else {
+			width, height = renderer.MeasureWithWrap(test.text, test.wrap)
+		}
+		if width != test.width || height != test.height {
+			t.Fatalf("%s, %q: expected %dx%d, got %dx%d", test.boundingMode, test.text, test.width, test.height, width, height)
+		}
+	}
+
+	// drawing
+	var drawn []image.Point
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawn = append(drawn, image.Pt(params.X, params.Y))
+		},
+	)
+	drawTests := []struct {
+		boundingMode BoundingMode
+		align Align
+		expected []image.Point
+	}{
+		{ LogicalBounding, Top | Left, []image.Point{ {1, 4}, {1, 9}, {9, 4} } },
+		{ LogicalBounding, Bottom | Left, []image.Point{ {1, 14}, {1, 19}, {9, 19} } },
+		{ LogicalBounding, LastBaseline | Left, []image.Point{ {1, 15}, {1, 20}, {9, 20} } },
+		{ LogicalBounding, LastBaseline | HorzNeutral, []image.Point{ {8, 15}, {8, 20}, {16, 20} } },
+		{ MaskBounding, Bottom | Left, []image.Point{ {0, 15}, {0, 20}, {8, 20} } },
+		{ MaskBounding, LastBaseline | HorzNeutral, []image.Point{ {8, 15}, {8, 20}, {16, 20} } },
+	}
+	for _, test := range drawTests {
+		renderer.Advanced().SetBoundingMode(test.boundingMode)
+		renderer.SetAlign(test.align)
+		drawn = drawn[ : 0]
+		x, y := 0, 0
+		if test.align.Vert() != Top { y = 20 }
+		if test.align.Horz() == HorzNeutral { x = 10 }
+		renderer.Draw(nil, "ab\na", x, y)
+		if len(drawn) != len(test.expected) {
+			t.Fatalf("%s, %s: expected %d glyphs, got %d", test.boundingMode, test.align, len(test.expected), len(drawn))
+		}
+		for i, point := range test.expected {
+			if drawn[i] != point {
+				t.Fatalf("%s, %s: expected glyphs at %v, got %v", test.boundingMode, test.align, test.expected, drawn)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package ptxt
+
+import "unicode/utf8"
+
+import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ptxt/strand"
+import "github.com/tinne26/ggfnt"
+
+// Wrap rules (see strand.Strand.SetWrapRules()) work with code points,
+// so they are evaluated right after converting the text to glyphs,
+// while the source is still available. The results are stored in
+// renderer.run.ruleBreaks, and line wrapping treats glyphs with rule
+// breaks as if they could wrap in strand.WrapBefore mode, as long as
+// the glyph's own strand (which might be a fallback strand) has rules.
+
+// Side effects: updates renderer.run.ruleBreaks. The runeAt function
+// must return the code point at the given source offset, or false if
+// there's no code point there (e.g. raw glyphs in twines).
+func (self *Renderer) computeRuleBreaks(runeAt func(offset int) (rune, bool)) {
+	self.run.ruleBreaks = self.run.ruleBreaks[ : 0]
+	if !self.wrapRulesRequired() { return }
+
+	self.run.ruleBreaks = setBufferSize(self.run.ruleBreaks, len(self.run.glyphIndices))
+	var prevRune rune
+	prevSource, hasPrevRune := -1, false
+	for index := 0; index < len(self.run.glyphIndices); index++ {
+		self.run.ruleBreaks[index] = false
+		glyphIndex := self.run.glyphIndices[index]
+		if !isDrawableGlyph(glyphIndex) {
+			switch glyphIndex {
+			case internal.FallbackGlyph, internal.TwineEffectMarkerGlyph:
+				index += 1 // skip pair
+				self.run.ruleBreaks[index] = false
+			case ggfnt.GlyphNewLine:
+				hasPrevRune = false
+			}
+			continue
+		}
+
+		source := int(self.run.glyphSources[index])
+		if source == prevSource { continue } // same rune sequence
+		codePoint, found := runeAt(source)
+		if found && hasPrevRune {
+			self.run.ruleBreaks[index] = strand.WrapRulesKinsoku.CanWrapBetween(prevRune, codePoint)
+		}
+		prevRune, prevSource, hasPrevRune = codePoint, source, found
+	}
+}
+
+// Returns whether any of the strands that might be used for the
+// current run has wrap rules.
+func (self *Renderer) wrapRulesRequired() bool {
+	if self.run.twineContents == nil {
+		return strandHasWrapRules(self.strands[self.strandIndex])
+	}
+	for _, fontStrand := range self.strands {
+		if fontStrand != nil && strandHasWrapRules(fontStrand) { return true }
+	}
+	return false
+}
+
+// Returns whether the strand or any of its fallbacks has wrap rules.
+func strandHasWrapRules(fontStrand *strand.Strand) bool {
+	if fontStrand.GetWrapRules() != strand.WrapRulesNone { return true }
+	for _, fallback := range fontStrand.Mapping().GetFallbacks() {
+		if fallback.GetWrapRules() != strand.WrapRulesNone { return true }
+	}
+	return false
+}
+
+// Returns whether wrap rules allow wrapping before the glyph at the
+// given index. The rules are taken from the glyph's own strand, which
+// is the fallback strand for glyphs coming from fallbacks.
+func (self *Renderer) ruleBreakBefore(glyphStrand *strand.Strand, index int) bool {
+	if index >= len(self.run.ruleBreaks) || !self.run.ruleBreaks[index] { return false }
+	return glyphStrand.GetWrapRules() != strand.WrapRulesNone
+}
+
+func textRuneAt(text string) func(int) (rune, bool) {
+	return func(offset int) (rune, bool) {
+		codePoint, _ := utf8.DecodeRuneInString(text[offset : ])
+		return codePoint, true
+	}
+}
+
+// Raw glyph offsets can't be told apart from code points on their
+// own, so contents are scanned sequentially (glyph sources are
+// monotonically non-decreasing).
+func twineRuneAt(contents []byte) func(int) (rune, bool) {
+	var pos int
+	return func(offset int) (rune, bool) {
+		if offset < pos { pos = 0 }
+		for pos < offset {
+			if contents[pos] == twineCcBegin {
+				next := pos + twineCcLen(contents, pos)
+				if next > offset { return 0, false } // raw glyph
+				pos = next
+			} else {
+				_, size := utf8.DecodeRune(contents[pos : ])
+				pos += size
+			}
+		}
+		if pos >= len(contents) || contents[pos] == twineCcBegin { return 0, false }
+		codePoint, _ := utf8.DecodeRune(contents[pos : ])
+		return codePoint, true
+	}
+}
@@ -0,0 +1,96 @@
+package ptxt
+
+import "image"
+import "testing"
+import "image/color"
+
+import "github.com/tinne26/ptxt/strand"
+
+import "github.com/tinne26/ggfnt/builder"
+
+func TestWrapRules(t *testing.T) {
+	// build a small font with some CJK glyphs, all 4 pixels wide
+	fontBuilder := builder.New()
+	fontBuilder.SetAscent(4)
+	fontBuilder.SetDescent(1)
+	fontBuilder.SetUppercaseAscent(4)
+	fontBuilder.SetMidlineAscent(3)
+	fontBuilder.SetHorzInterspacing(0)
+	for _, codePoint := range []rune{ '日', '本', '。', '「', '」', 'ゃ', '\u00A0', '＄', '１', '％' } {
+		uid, err := fontBuilder.AddGlyph(image.NewAlpha(image.Rect(0, -4, 4, 0)))
+		if err != nil { t.Fatal(err) }
+		err = fontBuilder.Map(codePoint, uid)
+		if err != nil { t.Fatal(err) }
+	}
+	font, err := fontBuilder.Build()
+	if err != nil { t.Fatal(err) }
+
+	// create strand and renderer
+	fontStrand, err := NewStrand(font)
+	if err != nil { t.Fatal(err) }
+	renderer := NewRenderer()
+	renderer.SetStrand(fontStrand)
+	_, lineHeight := renderer.Measure("日")
+	_, twoLinesHeight := renderer.Measure("日\n日")
+
+	// without rules, lines are only cut when no wrap points are found
+	width, height := renderer.MeasureWithWrap("日本日本。", 16)
+	if width != 16 || height != twoLinesHeight {
+		t.Fatalf("expected 16x%d without wrap rules, got %dx%d", twoLinesHeight, width, height)
+	}
+
+	// with rules
+	fontStrand.SetWrapRules(strand.WrapRulesKinsoku)
+	tests := []struct {
+		text string
+		maxLineLen int
+		width, height int
+	}{
+		{ "日本日本", 16, 16, lineHeight },
+		{ "日本日本", 12, 12, twoLinesHeight },
+		{ "日本日本。", 16, 12, twoLinesHeight }, // no wrap before full stop
+		{ "日本「日本」", 12, 8, 2*twoLinesHeight - lineHeight }, // no wrap after opening bracket
+		{ "日本日ゃ", 12, 8, twoLinesHeight }, // no wrap before small kana
+		{ "日本＄１", 12, 8, twoLinesHeight }, // no wrap after prefix symbols
+		{ "日本１％", 12, 8, twoLinesHeight }, // no wrap before postfix symbols
+		{ "日本\u00A0日本", 12, 12, 2*twoLinesHeight - lineHeight }, // no wrap around no-break spaces
+	}
+	for _, test := range tests {
+		width, height = renderer.MeasureWithWrap(test.text, test.maxLineLen)
+		if width != test.width || height != test.height {
+			t.Fatalf("%q (max line len %d): expected %dx%d, got %dx%d", test.text, test.maxLineLen, test.width, test.height, width, height)
+		}
+	}
+
+	// twines
+	twine := Weave("日本", color.RGBA{255, 0, 0, 255}, "日本。", Pop)
+	width, height = renderer.Twine().MeasureWithWrap(twine, 16)
+	if width != 12 || height != twoLinesHeight {
+		t.Fatalf("expected twine measure 12x%d, got %dx%d", twoLinesHeight, width, height)
+	}
+
+	// rules are taken from the glyph's own strand, including fallbacks
+	mainStrand, err := NewStrand(buildTestFont(t, newTestFontBuilder(t, []rune{'a'}, nil)))
+	if err != nil { t.Fatal(err) }
+	mainStrand.Mapping().SetFallbacks(fontStrand)
+	renderer.SetStrand(mainStrand)
+	width, height = renderer.MeasureWithWrap("日本日本。", 16)
+	if width != 12 || height != twoLinesHeight {
+		t.Fatalf("expected fallback measure 12x%d, got %dx%d", twoLinesHeight, width, height)
+	}
+	mainStrand.SetWrapRules(strand.WrapRulesKinsoku)
+	fontStrand.SetWrapRules(strand.WrapRulesNone)
+	width, height = renderer.MeasureWithWrap("日本日本。", 16)
+	if width != 16 || height != twoLinesHeight {
+		t.Fatalf("expected fallback measure without rules 16x%d, got %dx%d", twoLinesHeight, width, height)
+	}
+
+	// pair rules
+	rules := strand.WrapRulesKinsoku
+	if !rules.CanWrapBetween('a', '日') || rules.CanWrapBetween('a', 'b') || !rules.CanWrapBetween('-', 'b') {
+		t.Fatal("unexpected wrap rules results")
+	}
+	if rules.CanWrapBetween('日', '\u2060') || rules.CanWrapBetween('\u00A0', '日') || rules.CanWrapBetween('日', '％') {
+		t.Fatal("unexpected wrap rules results")
+	}
+}
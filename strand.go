@@ -53,7 +53,7 @@ func newStrandFromReader(fontReader io.Reader) (*strand.Strand, error) {
 }
 
 //go:linkname lnkBeginPass github.com/tinne26/ptxt/strand.(*StrandMapping).beginPass
-func lnkBeginPass(*strand.StrandMapping, strand.GlyphPickerPass) error
+func lnkBeginPass(*strand.StrandMapping, strand.GlyphPickerPass, uint8) error
 
 //go:linkname lnkFinishPass github.com/tinne26/ptxt/strand.(*StrandMapping).finishPass
 func lnkFinishPass(*strand.StrandMapping, strand.GlyphPickerPass)
@@ -61,9 +61,18 @@ func lnkFinishPass(*strand.StrandMapping, strand.GlyphPickerPass)
 //go:linkname lnkAppendCodePoint github.com/tinne26/ptxt/strand.(*StrandMapping).appendCodePoint
 func lnkAppendCodePoint(*strand.StrandMapping, rune, []ggfnt.GlyphIndex) []ggfnt.GlyphIndex
 
+//go:linkname lnkAppendGlyphIndex github.com/tinne26/ptxt/strand.(*StrandMapping).appendGlyphIndex
+func lnkAppendGlyphIndex(*strand.StrandMapping, ggfnt.GlyphIndex, []ggfnt.GlyphIndex) []ggfnt.GlyphIndex
+
+//go:linkname lnkBreakMapping github.com/tinne26/ptxt/strand.(*StrandMapping).breakMapping
+func lnkBreakMapping(*strand.StrandMapping, []ggfnt.GlyphIndex) []ggfnt.GlyphIndex
+
 //go:linkname lnkFinishMapping github.com/tinne26/ptxt/strand.(*StrandMapping).finishMapping
 func lnkFinishMapping(*strand.StrandMapping, []ggfnt.GlyphIndex) []ggfnt.GlyphIndex
 
+//go:linkname lnkNumPendingInputs github.com/tinne26/ptxt/strand.(*StrandMapping).numPendingInputs
+func lnkNumPendingInputs(*strand.StrandMapping) int
+
 //go:linkname lnkSetBlendMode github.com/tinne26/ptxt/strand.(*Strand).setBlendMode
 func lnkSetBlendMode(*strand.Strand, core.BlendMode)
 
@@ -76,6 +85,12 @@ func lnkDrawSidewaysMask(*strand.Strand, core.Target, core.GlyphMask, int, int,
 //go:linkname lnkDrawSidewaysRightMask github.com/tinne26/ptxt/strand.(*Strand).drawSidewaysRightMask
 func lnkDrawSidewaysRightMask(*strand.Strand, core.Target, core.GlyphMask, int, int, int, [4]float32)
 
+//go:linkname lnkBeginMaskBatch github.com/tinne26/ptxt/strand.beginMaskBatch
+func lnkBeginMaskBatch()
+
+//go:linkname lnkFlushMaskBatch github.com/tinne26/ptxt/strand.flushMaskBatch
+func lnkFlushMaskBatch()
+
 func strandFullGlyphInterspacing(fontStrand *strand.Strand) int {
 	horzInterspacing := fontStrand.Font().Metrics().HorzInterspacing()
 	return int(horzInterspacing) + int(fontStrand.GlyphInterspacingShift())
@@ -0,0 +1,42 @@
+package strand
+
+// Shelf packer used to place glyph masks on atlas pages in the gpu
+// version. Regions are placed left to right on rows ("shelves"), and
+// a new shelf or page is started when they don't fit. When all pages
+// are full, the packer starts again from the first page, and all the
+// previously allocated regions become invalid.
+type atlasPacker struct {
+	pageSize int
+	maxPages int
+	numPages int // pages in use
+	x, y int // packing position on the current page
+	shelfHeight int
+}
+
+// Allocates a region of the given size, which must fit within a page.
+// Returns the page index and position for the region, and whether the
+// packer had to be reset.
+func (self *atlasPacker) Allocate(width, height int) (page, x, y int, reset bool) {
+	if width > self.pageSize || height > self.pageSize { panic(brokenCode) }
+
+	// try to fit in the current page
+	if self.numPages > 0 {
+		if self.x + width > self.pageSize { // next shelf
+			self.x, self.y, self.shelfHeight = 0, self.y + self.shelfHeight, 0
+		}
+		if self.y + height <= self.pageSize {
+			x, y := self.x, self.y
+			self.x += width
+			self.shelfHeight = max(self.shelfHeight, height)
+			return self.numPages - 1, x, y, false
+		}
+	}
+
+	// move to the next page, resetting if necessary
+	if self.numPages == self.maxPages {
+		self.numPages, reset = 0, true
+	}
+	self.numPages += 1
+	self.x, self.y, self.shelfHeight = width, 0, height
+	return self.numPages - 1, 0, 0, reset
+}
@@ -0,0 +1,32 @@
+package strand
+
+import "testing"
+
+func TestAtlasPacker(t *testing.T) {
+	packer := atlasPacker{ pageSize: 10, maxPages: 2 }
+	tests := []struct {
+		width, height int
+		page, x, y int
+		reset bool
+	}{
+		{ 4, 3, 0, 0, 0, false }, // first page
+		{ 4, 5, 0, 4, 0, false }, // same shelf
+		{ 4, 2, 0, 0, 5, false }, // next shelf, below the tallest region
+		{ 6, 6, 1, 0, 0, false }, // doesn't fit below, next page
+		{ 3, 3, 1, 6, 0, false },
+		{ 1, 1, 1, 9, 0, false }, // exact fit
+		{ 5, 4, 1, 0, 6, false },
+		{ 5, 5, 0, 0, 0, true  }, // all pages full, reset
+		{ 10, 10, 1, 0, 0, false }, // full page
+		{ 1, 1, 0, 0, 0, true },
+	}
+	for i, test := range tests {
+		page, x, y, reset := packer.Allocate(test.width, test.height)
+		if page != test.page || x != test.x || y != test.y || reset != test.reset {
+			t.Fatalf(
+				"test #%d: expected page %d at (%d, %d) with reset = %t, got page %d at (%d, %d) with reset = %t",
+				i, test.page, test.x, test.y, test.reset, page, x, y, reset,
+			)
+		}
+	}
+}
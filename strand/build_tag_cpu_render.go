@@ -9,6 +9,9 @@ import "github.com/tinne26/ggfnt"
 
 func (*Strand) notifyShaderNonMainDyeChange() {} // used to relink uniforms in gpu version
 func (*Strand) notifyShaderPaletteChange() {} // used to relink uniforms in gpu version
+func (*Strand) flushPendingMasks() {} // used to batch mask draws in gpu version
+func beginMaskBatch() {} // used to batch mask draws in gpu version
+func flushMaskBatch() {} // used to batch mask draws in gpu version
 
 type renderData struct {
 	dyeMappings []uint8
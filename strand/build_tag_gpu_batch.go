@@ -0,0 +1,162 @@
+//go:build !cputext
+
+package strand
+
+import "image"
+
+import "github.com/tinne26/ptxt/core"
+import "github.com/hajimehoshi/ebiten/v2"
+
+// While a mask batch is active (see beginMaskBatch()), masks are
+// copied to shared atlas pages and their quads are accumulated, so
+// consecutive glyphs drawn with the same strand into the same target
+// result in a single DrawTrianglesShader() call. The renderer only
+// batches its default draw passes, as custom draw functions might
+// draw other things in between glyphs.
+
+const maskAtlasPageSize = 512
+const maskAtlasMaxPages = 4
+
+var maskBatch maskBatchData
+var maskAtlas = maskAtlasData{ packer: atlasPacker{ pageSize: maskAtlasPageSize, maxPages: maskAtlasMaxPages } }
+
+type maskBatchData struct {
+	active bool
+	strand *Strand
+	target core.Target
+	page *ebiten.Image
+	vertices []ebiten.Vertex
+	indices []uint16
+}
+
+// renderer internal use linkname target
+func beginMaskBatch() {
+	maskBatch.active = true
+}
+
+// renderer internal use linkname target
+//
+// Draws any pending quads and ends the batch.
+func flushMaskBatch() {
+	drawMaskBatch()
+	maskBatch.active = false
+}
+
+// Draws any pending quads without ending the batch.
+func drawMaskBatch() {
+	if len(maskBatch.vertices) > 0 {
+		options := &maskBatch.strand.re.shaderOptions
+		options.Images[0] = maskBatch.page
+		maskBatch.target.DrawTrianglesShader(maskBatch.vertices, maskBatch.indices, maskBatch.strand.re.shader, options)
+		options.Images[0] = nil
+	}
+	maskBatch.vertices = maskBatch.vertices[ : 0]
+	maskBatch.indices = maskBatch.indices[ : 0]
+	maskBatch.strand, maskBatch.target, maskBatch.page = nil, nil, nil
+}
+
+// Must be called before modifying the strand's shader options or
+// any data referenced by them, like dye and palette colors.
+func (self *Strand) flushPendingMasks() {
+	if maskBatch.strand == self { drawMaskBatch() }
+}
+
+// Draws the mask with the strand's current shader vertices, or adds
+// the quad to the active mask batch.
+func (self *Strand) drawShaderQuad(target core.Target, mask core.GlyphMask) {
+	if maskBatch.active {
+		page, offsetX, offsetY, found := maskAtlas.Region(mask)
+		if found {
+			if maskBatch.strand != self || maskBatch.target != target || maskBatch.page != page || len(maskBatch.vertices) + 4 > ebiten.MaxVerticesCount {
+				drawMaskBatch()
+				maskBatch.strand, maskBatch.target, maskBatch.page = self, target, page
+			}
+			base := uint16(len(maskBatch.vertices))
+			for _, vertex := range self.re.shaderVertices {
+				vertex.SrcX += float32(offsetX)
+				vertex.SrcY += float32(offsetY)
+				maskBatch.vertices = append(maskBatch.vertices, vertex)
+			}
+			maskBatch.indices = append(maskBatch.indices, base, base + 1, base + 2, base + 2, base + 1, base + 3)
+			return
+		}
+		drawMaskBatch() // mask can't be batched, preserve draw order
+	}
+
+	self.re.shaderOptions.Images[0] = mask
+	target.DrawTrianglesShader(self.re.shaderVertices[:], []uint16{0, 1, 2, 2, 1, 3}, self.re.shader, &self.re.shaderOptions)
+	self.re.shaderOptions.Images[0] = nil
+}
+
+// Masks are packed on atlas pages with an atlasPacker. When all pages
+// are full, the atlas is reset and filled again from scratch, which
+// is simple and works well as long as the glyphs in use fit.
+type maskAtlasData struct {
+	pages []*ebiten.Image
+	packer atlasPacker
+	regions map[core.GlyphMask]maskAtlasRegion
+	copyVertices [4]ebiten.Vertex
+	copyOptions ebiten.DrawTrianglesOptions
+}
+
+type maskAtlasRegion struct {
+	page *ebiten.Image
+	offsetX, offsetY int // from mask coordinates to page coordinates
+}
+
+// Returns the atlas page where the mask is stored and the offsets to
+// convert from mask to page coordinates. The mask is copied to the
+// atlas if it wasn't there yet. Masks that don't fit on a page return
+// false.
+func (self *maskAtlasData) Region(mask core.GlyphMask) (*ebiten.Image, int, int, bool) {
+	region, found := self.regions[mask]
+	if found { return region.page, region.offsetX, region.offsetY, true }
+
+	// allocate space (with one pixel of padding)
+	bounds := mask.Bounds()
+	width, height := bounds.Dx() + 1, bounds.Dy() + 1
+	if width > maskAtlasPageSize || height > maskAtlasPageSize { return nil, 0, 0, false }
+	page, x, y := self.allocate(width, height)
+
+	// copy mask to the atlas page
+	self.setCopyVertices(bounds, x, y)
+	self.copyOptions.Blend = ebiten.BlendCopy
+	page.DrawTriangles(self.copyVertices[:], []uint16{0, 1, 2, 2, 1, 3}, mask, &self.copyOptions)
+
+	// store region
+	if self.regions == nil { self.regions = make(map[core.GlyphMask]maskAtlasRegion, 64) }
+	region = maskAtlasRegion{ page: page, offsetX: x - bounds.Min.X, offsetY: y - bounds.Min.Y }
+	self.regions[mask] = region
+	return region.page, region.offsetX, region.offsetY, true
+}
+
+func (self *maskAtlasData) allocate(width, height int) (*ebiten.Image, int, int) {
+	pageIndex, x, y, reset := self.packer.Allocate(width, height)
+	if reset {
+		drawMaskBatch() // pending quads might reference the pages
+		clear(self.regions)
+		for _, page := range self.pages { page.Clear() }
+	}
+	if pageIndex == len(self.pages) {
+		self.pages = append(self.pages, ebiten.NewImage(maskAtlasPageSize, maskAtlasPageSize))
+	}
+	return self.pages[pageIndex], x, y
+}
+
+func (self *maskAtlasData) setCopyVertices(bounds image.Rectangle, x, y int) {
+	// (0 = top-left, 1 = top-right, 2 = bottom-left, 3 = bottom-right)
+	minX, minY := float32(bounds.Min.X), float32(bounds.Min.Y)
+	maxX, maxY := float32(bounds.Max.X), float32(bounds.Max.Y)
+	dstX, dstY := float32(x), float32(y)
+	w, h := maxX - minX, maxY - minY
+	self.copyVertices[0] = ebiten.Vertex{ DstX: dstX, DstY: dstY, SrcX: minX, SrcY: minY }
+	self.copyVertices[1] = ebiten.Vertex{ DstX: dstX + w, DstY: dstY, SrcX: maxX, SrcY: minY }
+	self.copyVertices[2] = ebiten.Vertex{ DstX: dstX, DstY: dstY + h, SrcX: minX, SrcY: maxY }
+	self.copyVertices[3] = ebiten.Vertex{ DstX: dstX + w, DstY: dstY + h, SrcX: maxX, SrcY: maxY }
+	for i := range self.copyVertices {
+		self.copyVertices[i].ColorR = 1.0
+		self.copyVertices[i].ColorG = 1.0
+		self.copyVertices[i].ColorB = 1.0
+		self.copyVertices[i].ColorA = 1.0
+	}
+}
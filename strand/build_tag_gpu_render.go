@@ -145,6 +145,7 @@ func (self *Strand) renderDataInit() {
 }
 
 func (self *Strand) setBlendMode(blend ebiten.Blend) {
+	self.flushPendingMasks()
 	self.re.shaderOptions.Blend = blend
 }
 
@@ -171,8 +172,7 @@ func (self *Strand) drawHorzMask(target core.Target, mask core.GlyphMask, x, y i
 	self.setShaderVertColors(rgba)
 
 	// invoke the shader
-	self.re.shaderOptions.Images[0] = mask
-	target.DrawTrianglesShader(self.re.shaderVertices[:], []uint16{0, 1, 2, 2, 1, 3}, self.re.shader, &self.re.shaderOptions)
+	self.drawShaderQuad(target, mask)
 }
 
 // Precondition: scale is already overriden from the strand if necessary.
@@ -188,8 +188,7 @@ func (self *Strand) drawSidewaysMask(target core.Target, mask core.GlyphMask, x,
 	self.setShaderVertColors(rgba)
 
 	// invoke the shader
-	self.re.shaderOptions.Images[0] = mask
-	target.DrawTrianglesShader(self.re.shaderVertices[:], []uint16{0, 1, 2, 2, 1, 3}, self.re.shader, &self.re.shaderOptions)
+	self.drawShaderQuad(target, mask)
 }
 
 // Precondition: scale is already overriden from the strand if necessary.
@@ -205,8 +204,7 @@ func (self *Strand) drawSidewaysRightMask(target core.Target, mask core.GlyphMas
 	self.setShaderVertColors(rgba)
 
 	// invoke the shader
-	self.re.shaderOptions.Images[0] = mask
-	target.DrawTrianglesShader(self.re.shaderVertices[:], []uint16{0, 1, 2, 2, 1, 3}, self.re.shader, &self.re.shaderOptions)
+	self.drawShaderQuad(target, mask)
 }
 
 func (self *Strand) setShaderSrcVertices(minX, minY, maxX, maxY float32) {
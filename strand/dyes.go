@@ -15,6 +15,7 @@ func (self *Strand) SetDye(dyeKey ggfnt.DyeKey, rgba color.RGBA) {
 		// discretionary safety assertions
 		if !isPremultiplied(rgba) { panic(nonPremultRGBA) }
 		if int(dyeKey) >= self.dyes.Len() { panic("invalid dye key") }
+		self.flushPendingMasks()
 		self.dyes.Set(int(dyeKey), internal.RGBAToFloat32(rgba))
 		self.notifyShaderNonMainDyeChange()
 	}
@@ -48,6 +49,7 @@ func (self *Strand) MainDyeKey() ggfnt.DyeKey {
 func (self *Strand) SetMainDye(rgba color.RGBA) {
 	if self.mainDyeKey == NoDyeKey { panic("font doesn't have a \"main\" dye key") }
 	if !isPremultiplied(rgba) { panic(nonPremultRGBA) }
+	self.flushPendingMasks()
 	self.mainDyeRGBA8 = rgba
 	self.setFlag(strandMainDyeColorActive, true)
 	self.dyes.Set(int(self.mainDyeKey), internal.RGBAToFloat32(rgba))
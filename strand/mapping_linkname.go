@@ -1,12 +1,21 @@
 package strand
 
+import "unicode"
+
+import "github.com/tinne26/ptxt/internal"
+
 import "github.com/tinne26/ggfnt"
 
 // renderer internal use linkname target
-func (self *StrandMapping) beginPass(pass GlyphPickerPass) error {
+//
+// The glyph miss policy must be one of internal.GlyphMissPanic and
+// similar constants, and applies until the next pass begins.
+func (self *StrandMapping) beginPass(pass GlyphPickerPass, glyphMissPolicy uint8) error {
+	self.glyphMissPolicy = glyphMissPolicy
 	for i, _ := range self.pickHandlers {
 		self.pickHandlers[i].Picker.NotifyPass(pass, true)
 	}
+	self.setFlag(strandFirstAppendIncoming, true)
 	err := self.utf8Tester.BeginSequence(self.font, &self.settings)
 	if err != nil { return err }
 	return self.glyphTester.BeginSequence(self.font, &self.settings)
@@ -24,8 +33,8 @@ func (self *StrandMapping) finishPass(pass GlyphPickerPass) {
 // Precondition: neither utf8Tester rules nor rewriteRulesDisabled can be
 // modified while a process is active.
 //
-// This function will panic if the glyph index is missing. Otherwise,
-// I'd need to adjust and pass a glyph missing failure policy.
+// Missing glyph indices are handled according to the glyph miss
+// policy passed on beginPass(), which will panic by default.
 func (self *StrandMapping) appendCodePoint(codePoint rune, buffer []ggfnt.GlyphIndex) []ggfnt.GlyphIndex {
 	self.tempGlyphBuffer = buffer
 
@@ -68,6 +77,28 @@ func (self *StrandMapping) appendGlyphIndex(glyphIndex ggfnt.GlyphIndex, buffer
 	return self.releaseTempGlyphBuffer()
 }	
 
+// renderer internal use linkname target
+//
+// Flushes any glyphs pending on rewrite rule testers, without finishing
+// the sequence. Used by twines, where directives need to be placed at
+// exact positions between glyphs.
+func (self *StrandMapping) breakMapping(buffer []ggfnt.GlyphIndex) []ggfnt.GlyphIndex {
+	self.tempGlyphBuffer = buffer
+	if self.getFlag(strandLastAppendWasRune) {
+		self.utf8Tester.Break(self.testerAppendCodePointFunc)
+	}
+	self.glyphTester.Break(self.testerAppendGlyphIndexFunc)
+	return self.releaseTempGlyphBuffer()
+}
+
+// renderer internal use linkname target
+//
+// Returns the number of runes and glyphs still pending on rewrite
+// rule testers.
+func (self *StrandMapping) numPendingInputs() int {
+	return self.utf8Tester.NumPendingRunes() + self.glyphTester.NumPendingGlyphs()
+}
+
 // (internal)
 func (self *StrandMapping) finishMapping(buffer []ggfnt.GlyphIndex) []ggfnt.GlyphIndex {
 	self.tempGlyphBuffer = buffer
@@ -88,12 +119,20 @@ func (self *StrandMapping) testerAppendGlyphIndexFunc(glyphIndex ggfnt.GlyphInde
 func (self *StrandMapping) testerAppendCodePointFunc(codePoint rune) {
 	// get glyph group for the code point, pick one glyph from it
 	var glyphIndex ggfnt.GlyphIndex = ggfnt.GlyphMissing
-	var group ggfnt.GlyphMappingGroup
-	var found bool
-	if self.mappingCache != nil {
-		group, found = self.mappingCache.Get(codePoint, &self.settings)
-	} else {
-		group, found = self.font.Mapping().Utf8WithCache(codePoint, &self.settings)
+	group, found := self.getMappingGroup(codePoint)
+	if !found && codePoint != '\n' && codePoint != '\t' {
+		if self.appendFallbackGlyph(codePoint) { return }
+		if self.glyphMissPolicy & internal.GlyphMissTryUppercase != 0 {
+			upperCodePoint := unicode.ToUpper(codePoint)
+			if upperCodePoint != codePoint {
+				group, found = self.getMappingGroup(upperCodePoint)
+				if found {
+					codePoint = upperCodePoint
+				} else if self.appendFallbackGlyph(upperCodePoint) {
+					return
+				}
+			}
+		}
 	}
 	if found {
 		size := group.Size()
@@ -119,10 +158,19 @@ func (self *StrandMapping) testerAppendCodePointFunc(codePoint rune) {
 			self.glyphTester.Break(self.testerAppendGlyphIndexFunc)
 			self.testerAppendGlyphIndexFunc(ggfnt.GlyphNewLine)
 			return
-		} else if codePoint < 32 {
-			panic("no glyph index for ASCII control code " + itoaRune(codePoint) + " [" + runeToUnicodeCode(codePoint) + "]")
-		} else {
-			panic("glyph index for '" + string(codePoint) + "' [" + runeToUnicodeCode(codePoint) + "] missing")
+		}
+		if codePoint == '\t' { // tabs are handled by the renderer
+			self.glyphTester.Break(self.testerAppendGlyphIndexFunc)
+			self.testerAppendGlyphIndexFunc(internal.TabGlyph)
+			return
+		}
+
+		glyphIndex = self.getMissingGlyphIndex(codePoint)
+		if glyphIndex == ggfnt.GlyphMissing { return } // skip
+		if glyphIndex == internal.NotdefGlyph { // not a font glyph, bypass rewrite rules
+			self.glyphTester.Break(self.testerAppendGlyphIndexFunc)
+			self.testerAppendGlyphIndexFunc(glyphIndex)
+			return
 		}
 	}
 
@@ -135,6 +183,50 @@ func (self *StrandMapping) testerAppendCodePointFunc(codePoint rune) {
 	}
 }
 
+// (internal)
+func (self *StrandMapping) getMappingGroup(codePoint rune) (ggfnt.GlyphMappingGroup, bool) {
+	if self.mappingCache != nil {
+		return self.mappingCache.Get(codePoint, &self.settings)
+	}
+	return self.font.Mapping().Utf8WithCache(codePoint, &self.settings)
+}
+
+// (internal) Tries to find the code point on the fallback strands and
+// append the glyph, followed by internal.FallbackGlyph and the index of
+// the fallback. Returns false if none of the fallbacks has the glyph.
+func (self *StrandMapping) appendFallbackGlyph(codePoint rune) bool {
+	for i, fallback := range self.fallbacks {
+		group, found := fallback.Mapping().getMappingGroup(codePoint)
+		if !found { continue }
+		self.glyphTester.Break(self.testerAppendGlyphIndexFunc)
+		self.tempGlyphBuffer = append(self.tempGlyphBuffer, group.Select(0), internal.FallbackGlyph, ggfnt.GlyphIndex(i))
+		return true
+	}
+	return false
+}
+
+// (internal) Returns the glyph index to use for a code point missing
+// on the font, or ggfnt.GlyphMissing if the code point must be skipped.
+func (self *StrandMapping) getMissingGlyphIndex(codePoint rune) ggfnt.GlyphIndex {
+	switch self.glyphMissPolicy & ^internal.GlyphMissTryUppercase {
+	case internal.GlyphMissPanic:
+		if codePoint < 32 {
+			panic("no glyph index for ASCII control code " + itoaRune(codePoint) + " [" + runeToUnicodeCode(codePoint) + "]")
+		}
+		panic("glyph index for '" + string(codePoint) + "' [" + runeToUnicodeCode(codePoint) + "] missing")
+	case internal.GlyphMissSkip:
+		return ggfnt.GlyphMissing
+	case internal.GlyphMissNotdef:
+		notdef := self.font.Glyphs().FindIndexByName("notdef")
+		if notdef != ggfnt.GlyphMissing { return notdef }
+		return internal.NotdefGlyph
+	case internal.GlyphMissEmptyRect:
+		return internal.NotdefGlyph
+	default:
+		panic(brokenCode)
+	}
+}
+
 func (self *StrandMapping) releaseTempGlyphBuffer() []ggfnt.GlyphIndex {
 	buffer := self.tempGlyphBuffer
 	self.tempGlyphBuffer = nil
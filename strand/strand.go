@@ -66,11 +66,14 @@ type Strand struct {
 	// wouldn't work with twines, which need some stuff added at arbitrary points on the
 	// renderer side.
 	mappingCache *ggfnt.MappingCache
+	glyphMissPolicy uint8 // set by the renderer on each pass, see internal.GlyphMissPanic and others
+	fallbacks []*Strand
 
 	// wrap glyphs
 	spaceGlyph ggfnt.GlyphIndex
 	wrapGlyphs [sentinelWrapModesCount][]ggfnt.GlyphIndex
 	wrapGlyphRanges [sentinelWrapModesCount][]ggfnt.GlyphRange
+	wrapRules WrapRules
 	// NOTE: this is too many slices, so much overhead...
 
 	// version dependent (gpu vs cpu) rendering data
@@ -267,6 +270,7 @@ func (self *Strand) Recolor(paletteKey ggfnt.PaletteKey, colors ...color.RGBA) {
 	}
 
 	// apply each color
+	self.flushPendingMasks()
 	firstPaletteIndex := self.font.Color().NumDyeIndices()
 	fontColorIndex := firstPaletteIndex + uint8(paletteKey)
 	for i, _ := range colors {
@@ -46,6 +46,35 @@ func (self *StrandMapping) GetRewriteRulesEnabled() bool {
 	return !(*Strand)(self).getFlag(strandRewriteRulesDisabled)
 }
 
+// Sets an ordered list of fallback strands to use when a code point
+// isn't mapped on the strand's font. The glyph will be taken from the
+// first fallback that has it, and its metrics, kerning and colors will
+// also come from the fallback, while sharing the baseline and scale of
+// the main text. Passing no strands clears the fallbacks.
+//
+// Some limitations apply:
+//  - Fallbacks of fallbacks are not considered.
+//  - Rewrite rules and glyph pickers are not applied to fallback glyphs.
+//    If the fallback maps the code point to multiple glyphs, the first
+//    one is always used.
+//  - Line breaks are always handled by the main strand.
+func (self *StrandMapping) SetFallbacks(fallbacks ...*Strand) {
+	if self.utf8Tester.IsOperating() || self.glyphTester.IsOperating() {
+		panic("can't change fallback strands while operating")
+	}
+	for _, fallback := range fallbacks {
+		if fallback == nil { panic("nil fallback strand") }
+		if fallback == (*Strand)(self) { panic("a strand can't be its own fallback") }
+	}
+	self.fallbacks = append(self.fallbacks[ : 0], fallbacks...)
+}
+
+// Returns the fallback strands. See [StrandMapping.SetFallbacks]().
+// The returned slice must not be modified.
+func (self *StrandMapping) GetFallbacks() []*Strand {
+	return self.fallbacks
+}
+
 // Performance note: when a rewrite rule is added, the decision tree in
 // charge of evaluating glyph sequences needs to be recompiled. This
 // will happen automatically the next time the strand is used, or it
@@ -0,0 +1,137 @@
+package strand
+
+import "unicode"
+
+// Code point based line wrapping rules, applied on top of the wrap
+// glyphs defined through [Strand.SetWrapGlyphs]() and similar.
+// See [Strand.SetWrapRules]().
+type WrapRules uint8
+const (
+	// Only wrap glyphs are considered. This is the default.
+	WrapRulesNone WrapRules = iota
+
+	// A subset of the CJK line breaking rules (kinsoku shori):
+	//  - Lines can wrap between ideographs, kana and hangul, and
+	//    between those and other characters.
+	//  - Lines can't wrap before closing punctuation, full stops,
+	//    commas, exclamation and question marks, small kana, the
+	//    prolonged sound mark, iteration marks and postfix symbols
+	//    like '%' or '％'.
+	//  - Lines can't wrap after opening punctuation or prefix symbols
+	//    like '＄' or '￥'.
+	//  - Lines can't wrap before nor after no-break spaces and word
+	//    joiners.
+	//  - Lines can wrap after hyphens and dashes followed by letters.
+	// This is not a full implementation of the Unicode line breaking
+	// algorithm (UAX #14): outside CJK text, only the hyphen rule adds
+	// new wrap points. Wrap glyphs like spaces are still considered as
+	// usual.
+	WrapRulesKinsoku
+)
+
+// Sets the code point based line wrapping rules for the strand.
+// Like wrap glyphs, rules apply to the glyphs coming from the strand,
+// whether it's the main strand or a fallback strand being used for
+// missing glyphs (see [StrandMapping.SetFallbacks]()): wrapping before
+// a glyph depends on the rules of the glyph's own strand.
+//
+// Raw glyphs added to twines through [ptxt.Twine.AddGlyphs]() don't
+// have code points and aren't affected by wrap rules.
+//
+// [ptxt.Twine.AddGlyphs]: https://pkg.go.dev/github.com/tinne26/ptxt#Twine.AddGlyphs
+func (self *Strand) SetWrapRules(rules WrapRules) {
+	if rules > WrapRulesKinsoku { panic("invalid wrap rules") }
+	self.wrapRules = rules
+}
+
+// Returns the strand's line wrapping rules. See [Strand.SetWrapRules]().
+func (self *Strand) GetWrapRules() WrapRules {
+	return self.wrapRules
+}
+
+// Returns whether the wrap rules allow wrapping a line between the
+// two given code points.
+func (self WrapRules) CanWrapBetween(prev, next rune) bool {
+	if self == WrapRulesNone { return false }
+	if isNoWrapBefore(next) || isNoWrapAfter(prev) { return false }
+	if isWrapGlue(prev) || isWrapGlue(next) { return false }
+	if isWrapAfterHyphen(prev) && unicode.IsLetter(next) { return true }
+	return isWideWrapRune(prev) || isWideWrapRune(next)
+}
+
+// Returns whether the rune allows wrapping before or after it on its
+// own (ideographs, kana, hangul and wide punctuation).
+func isWideWrapRune(codePoint rune) bool {
+	switch {
+	case codePoint >= 0x1100 && codePoint <= 0x115F: return true // hangul jamo (leading)
+	case codePoint >= 0x2E80 && codePoint <= 0x303F: return true // cjk radicals, symbols and punctuation
+	case codePoint >= 0x3040 && codePoint <= 0x30FF: return true // hiragana and katakana
+	case codePoint >= 0x3100 && codePoint <= 0x31FF: return true // bopomofo, hangul compat, katakana ext
+	case codePoint >= 0x3400 && codePoint <= 0x4DBF: return true // cjk extension A
+	case codePoint >= 0x4E00 && codePoint <= 0x9FFF: return true // cjk unified ideographs
+	case codePoint >= 0xAC00 && codePoint <= 0xD7A3: return true // hangul syllables
+	case codePoint >= 0xF900 && codePoint <= 0xFAFF: return true // cjk compatibility ideographs
+	case codePoint >= 0xFF01 && codePoint <= 0xFF60: return true // fullwidth forms
+	case codePoint >= 0xFF61 && codePoint <= 0xFF9F: return true // halfwidth katakana
+	case codePoint >= 0x20000 && codePoint <= 0x3FFFF: return true // cjk extensions B and beyond
+	default:
+		return false
+	}
+}
+
+// Closing punctuation, stops, exclamation and question marks,
+// small kana, postfix symbols and other non-starters.
+func isNoWrapBefore(codePoint rune) bool {
+	switch codePoint {
+	case ')', ']', '}', ',', '.', ':', ';', '!', '?', '%',
+		'’', '”', '…', '‼', '⁇', '⁈', '⁉',
+		'、', '。', '々', '〉', '》', '」', '』',
+		'】', '〕', '〗', '〙', '〛', '〞', '〟',
+		'〻', 'ゝ', 'ゞ', '゠', '・', 'ー', 'ヽ', 'ヾ',
+		'！', '）', '，', '．', '：', '；', '？',
+		'］', '｝', '｠', '｡', '｣', '､', '･', 'ｰ',
+		'％', '‰', '℃', '￠':
+		return true
+	}
+	return isSmallKana(codePoint)
+}
+
+// Opening punctuation and prefix symbols.
+func isNoWrapAfter(codePoint rune) bool {
+	switch codePoint {
+	case '(', '[', '{', '‘', '“',
+		'〈', '《', '「', '『', '【', '〔',
+		'〖', '〘', '〚', '〝',
+		'（', '［', '｛', '｟', '｢',
+		'＄', '￡', '￥':
+		return true
+	}
+	return false
+}
+
+// No-break spaces, joiners and word joiners.
+func isWrapGlue(codePoint rune) bool {
+	switch codePoint {
+	case '\u00A0', '\u2007', '\u200D', '\u202F', '\u2060', '\uFEFF':
+		return true
+	}
+	return false
+}
+
+func isSmallKana(codePoint rune) bool {
+	switch codePoint {
+	case 'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ', 'っ', 'ゃ', 'ゅ', 'ょ', 'ゎ', 'ゕ', 'ゖ',
+		'ァ', 'ィ', 'ゥ', 'ェ', 'ォ', 'ッ', 'ャ', 'ュ', 'ョ', 'ヮ', 'ヵ', 'ヶ',
+		'ｧ', 'ｨ', 'ｩ', 'ｪ', 'ｫ', 'ｬ', 'ｭ', 'ｮ', 'ｯ':
+		return true
+	}
+	return codePoint >= 0x31F0 && codePoint <= 0x31FF // katakana phonetic extensions
+}
+
+func isWrapAfterHyphen(codePoint rune) bool {
+	switch codePoint {
+	case '-', '‐', '–', '—':
+		return true
+	}
+	return false
+}
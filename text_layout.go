@@ -0,0 +1,129 @@
+package ptxt
+
+import "slices"
+
+import "github.com/tinne26/ptxt/core"
+import "github.com/tinne26/ptxt/strand"
+
+// A TextLayout holds the glyphs and layout of a text, as computed
+// by [Renderer.Layout](). Layouts don't depend on the renderer's
+// buffers, so they can be kept across frames and drawn many times,
+// at any position and on any target, without mapping the text nor
+// computing its layout again. Usage example:
+//   // on setup
+//   label := renderer.Layout("Inventory", math.MaxInt32)
+//   // on draw (the renderer can be used for other text in between)
+//   label.Draw(renderer, target, x, y)
+//
+// The strand, scale, direction, align and bounding mode are captured
+// when the layout is created, while colors, blend mode, custom draw
+// functions and the reveal limit are taken from the renderer used to
+// draw. Layouts are immutable, and they keep references to the strand
+// and the fallbacks it had when the layout was created, so changing the
+// strand's fallbacks afterwards doesn't affect the layout. Changing the
+// font of any of these strands, though, will cause glyphs to be drawn
+// incorrectly, or even panics.
+type TextLayout struct {
+	run textRun
+	strands []*strand.Strand // main strand followed by its fallbacks
+	scale uint8
+	direction Direction
+	align Align
+	boundingMode BoundingMode
+	parBreakEnabled bool
+}
+
+// Lays out the given text with the current renderer's configuration
+// and returns it as an independent [TextLayout]. Line wrapping works
+// like on [Renderer.DrawWithWrap](); to disable it, pass a very big
+// 'maxLineLen' like math.MaxInt32.
+//
+// The renderer's buffered layout is left as after a measuring
+// operation, so [RendererAdvanced.DrawFromBuffer]() and similar can
+// still be used.
+//
+// Text can't exceed 32k glyphs.
+func (self *Renderer) Layout(text string, maxLineLen int) *TextLayout {
+	_, _ = self.MeasureWithWrap(text, maxLineLen)
+	mainStrand := self.strands[self.strandIndex]
+	return &TextLayout{
+		run: self.run.cloneLayout(),
+		strands: append([]*strand.Strand{ mainStrand }, mainStrand.Mapping().GetFallbacks()...),
+		scale: self.scale,
+		direction: self.direction,
+		align: self.align,
+		boundingMode: self.boundingMode,
+		parBreakEnabled: self.parBreakEnabled,
+	}
+}
+
+// Returns the dimensions of the laid out text, as [Renderer.MeasureWithWrap]()
+// would.
+func (self *TextLayout) Size() (width, height int) {
+	return self.run.right - self.run.left, self.run.bottom - self.run.top
+}
+
+// Returns the text [Direction] used for the layout.
+func (self *TextLayout) Direction() Direction {
+	return self.direction
+}
+
+// Returns the [Align] used for the layout. The coordinates passed to
+// [TextLayout.Draw]() are interpreted according to this align.
+func (self *TextLayout) Align() Align {
+	return self.align
+}
+
+// Draws the layout with the given renderer. The drawing position
+// depends on the given pixel coordinates and the layout's align.
+// The renderer's buffered layout is not modified.
+func (self *TextLayout) Draw(renderer *Renderer, target core.Target, x, y int) {
+	renderer.drawLayout(self, target, x, y)
+}
+
+// The layout's strands are passed to the draw path through
+// renderer.layoutStrands, while the rest of the renderer configuration
+// is temporarily replaced by the layout's.
+func (self *Renderer) drawLayout(layout *TextLayout, target core.Target, x, y int) {
+	run, layoutStrands := self.run, self.layoutStrands
+	scale, direction, align := self.scale, self.direction, self.align
+	boundingMode, parBreakEnabled := self.boundingMode, self.parBreakEnabled
+	defer func() {
+		self.run, self.layoutStrands = run, layoutStrands
+		self.scale, self.direction, self.align = scale, direction, align
+		self.boundingMode, self.parBreakEnabled = boundingMode, parBreakEnabled
+		self.fallbackStrand = nil
+	}()
+
+	self.run = layout.run // drawing doesn't modify the layout's slices
+	self.layoutStrands = layout.strands
+	self.scale, self.direction, self.align = layout.scale, layout.direction, layout.align
+	self.boundingMode, self.parBreakEnabled = layout.boundingMode, layout.parBreakEnabled
+	self.drawFromBuffer(target, x, y)
+}
+
+// Returns a copy of the run data needed for drawing, without
+// aux buffers.
+func (self *textRun) cloneLayout() textRun {
+	if self.twineContents != nil { panic(brokenCode) }
+	return textRun{
+		left: self.left, right: self.right, top: self.top, bottom: self.bottom,
+		glyphIndices: slices.Clone(self.glyphIndices),
+		glyphSources: slices.Clone(self.glyphSources),
+		sourceLen: self.sourceLen,
+		lineLengths: slices.Clone(self.lineLengths),
+		lineIndents: slices.Clone(self.lineIndents),
+		lineLefts: slices.Clone(self.lineLefts),
+		advances: slices.Clone(self.advances),
+		horzShifts: slices.Clone(self.horzShifts),
+		kernings: slices.Clone(self.kernings),
+		wrapIndices: slices.Clone(self.wrapIndices),
+		lineAdvances: slices.Clone(self.lineAdvances),
+		firstRowAscent: self.firstRowAscent,
+		lastRowDescent: self.lastRowDescent,
+		isMultiline: self.isMultiline,
+		hyphenWraps: slices.Clone(self.hyphenWraps),
+		bidiLevels: slices.Clone(self.bidiLevels),
+		bidiPositions: slices.Clone(self.bidiPositions),
+	}
+}
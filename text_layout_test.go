@@ -0,0 +1,103 @@
+package ptxt
+
+import "slices"
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+
+func TestTextLayout(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+	renderer.SetAlign(Center)
+	renderer.SetScale(2)
+
+	var drawn []GlyphLayout
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawn = append(drawn, GlyphLayout{ GlyphIndex: glyphIndex, X: params.X, Y: params.Y, Scale: params.Scale })
+		},
+	)
+
+	// layouts must draw like the renderer did when they were created
+	text := "AB\nCD EF"
+	maxLineLen, _ := renderer.Measure("CD E")
+	for _, dir := range []Direction{ Horizontal, Sideways, SidewaysRight } {
+		renderer.SetDirection(dir)
+		drawn = drawn[ : 0]
+		renderer.DrawWithWrap(nil, text, 8, 9, maxLineLen)
+		expected := slices.Clone(drawn)
+		width, height := renderer.MeasureWithWrap(text, maxLineLen)
+
+		layout := renderer.Layout(text, maxLineLen)
+		if w, h := layout.Size(); w != width || h != height {
+			t.Fatalf("%s: expected layout size %dx%d, got %dx%d", dir, width, height, w, h)
+		}
+
+		// change the renderer configuration and buffered layout
+		renderer.SetDirection(Horizontal)
+		renderer.SetAlign(Left | Top)
+		renderer.SetScale(1)
+		_, _ = renderer.Measure("other text")
+		drawn = drawn[ : 0]
+		renderer.Advanced().DrawFromBuffer(nil, 0, 0)
+		expectedBuffer := slices.Clone(drawn)
+
+		for i := 0; i < 2; i++ {
+			drawn = drawn[ : 0]
+			layout.Draw(renderer, nil, 8, 9)
+			if !slices.Equal(drawn, expected) {
+				t.Fatalf("%s: expected layout draw %v, got %v", dir, expected, drawn)
+			}
+		}
+
+		// renderer state must be restored after drawing
+		if renderer.GetDirection() != Horizontal || renderer.GetAlign() != (Left | Top) || renderer.GetScale() != 1 {
+			t.Fatalf("%s: renderer configuration changed by layout draw", dir)
+		}
+		drawn = drawn[ : 0]
+		renderer.Advanced().DrawFromBuffer(nil, 0, 0)
+		if !slices.Equal(drawn, expectedBuffer) {
+			t.Fatalf("%s: renderer buffer changed by layout draw", dir)
+		}
+
+		renderer.SetAlign(Center)
+		renderer.SetScale(2)
+	}
+
+	// fallbacks are captured when the layout is created
+	fallbackStrand, _ := NewStrand(buildTestFont(t, newTestFontBuilder(t, []rune{'日'}, nil)))
+	strand.Mapping().SetFallbacks(fallbackStrand)
+	text = "A日B"
+	drawn = drawn[ : 0]
+	renderer.Draw(nil, text, 8, 9)
+	expected := slices.Clone(drawn)
+	layout := renderer.Layout(text, maxInt32)
+	strand.Mapping().SetFallbacks()
+	drawn = drawn[ : 0]
+	layout.Draw(renderer, nil, 8, 9)
+	if !slices.Equal(drawn, expected) {
+		t.Fatalf("expected fallback layout draw %v, got %v", expected, drawn)
+	}
+
+	// renderer state must be restored even if drawing panics
+	renderer.SetScale(1)
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			panic("draw")
+		},
+	)
+	func() {
+		defer func() { _ = recover() }()
+		layout.Draw(renderer, nil, 8, 9)
+	}()
+	if renderer.GetScale() != 1 || renderer.Strand() != strand {
+		t.Fatal("renderer state not restored after panicking layout draw")
+	}
+}
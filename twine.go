@@ -1,11 +1,13 @@
 package ptxt
 
+import "fmt"
+import "slices"
+import "strings"
+import "unicode/utf8"
 import "image/color"
 
 import "github.com/tinne26/ggfnt"
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
 // A flexible type that can have text content added as utf8, raw
 // glyphs or a mix of both, with some styling directives also being
 // supported through control codes and custom functions.
@@ -19,183 +21,467 @@ type Twine struct {
 	contents []byte
 }
 
+// --- twine encoding ---
+
+// Internally, twine contents are stored as utf8, with control sequences
+// interleaved when necessary. Control sequences start with twineCcBegin,
+// which is never valid within utf8 text, followed by a control code byte
+// and the code's operands, if any.
+//
+// Multi-byte operands are always encoded in little endian order.
+const twineCcBegin byte = 0xFF
+
+const (
+	twineCcGlyphs byte = iota + 1 // uint16 count followed by count uint16 glyph indices
+	twineCcLineMetricsRefresh
+	twineCcPop
+	twineCcPopAll
+	twineCcStop
+	twineCcPushColor // RGBA
+	twineCcPushStrand // strand index
+	twineCcPushScale // scale
+	twineCcPushScaleShift // int8 shift
+	twineCcPushPadder // 5 uint16 values + 1 flags byte
+	twineCcPushSettingChange // setting key + option
+	twineCcPushLineRestartMarker
+	twineCcPushColorChanger // func ID + payload len + payload
+	twineCcPushMotion // func ID + payload len + payload
+	twineCcPushGfxFront // func ID + payload len + payload
+	twineCcPushGfxBack // func ID + payload len + payload
+	twineCcPushRevealDelay // delay in ticks
+	twineCcSentinel // (first invalid code)
+)
+
+const twinePadderUnitsScaledFlag byte = 0b0000_0001
+
+// Returns the size of the control sequence starting at the given offset,
+// including the twineCcBegin byte. The offset must point to a twineCcBegin
+// byte, and the control sequence must be well formed.
+func twineCcLen(contents []byte, offset int) int {
+	switch contents[offset + 1] {
+	case twineCcGlyphs:
+		count := int(contents[offset + 2]) | int(contents[offset + 3]) << 8
+		return 4 + (count << 1)
+	case twineCcLineMetricsRefresh, twineCcPop, twineCcPopAll, twineCcStop, twineCcPushLineRestartMarker:
+		return 2
+	case twineCcPushColor:
+		return 6
+	case twineCcPushStrand, twineCcPushScale, twineCcPushScaleShift, twineCcPushRevealDelay:
+		return 3
+	case twineCcPushPadder:
+		return 13
+	case twineCcPushSettingChange:
+		return 4
+	case twineCcPushColorChanger, twineCcPushMotion, twineCcPushGfxFront, twineCcPushGfxBack:
+		return 4 + int(contents[offset + 3])
+	default:
+		panic("invalid twine control code")
+	}
+}
+
 // --- twine creation ---
 
 type twinePopSpecialDirective uint8
 
 // Constants for popping special directives when working with [Weave]()
-// and [Twine.Weave](). 
+// and [Twine.Weave]().
 const (
 	Pop    twinePopSpecialDirective = 66 // pop last effect function still active
 	PopAll twinePopSpecialDirective = 67 // pop all effect functions still active
 	Stop   twinePopSpecialDirective = 68 // pop last motion function still active
 )
 
-
-// NOTICE: TWINES ARE UNIMPLEMENTED
-//
 // Creates a [Twine] from the given arguments. For example:
 //   rgba  := color.RGBA{ 80, 200, 120, 255 }
 //   twine := ptxt.Weave("NICE ", rgba, "EMERALD", ptxt.Pop, '!')
-// You can also pass a twine as the first argument to append to it
-// instead of creating a new one. To pop fonts, colors, effects or
-// motions, you can use the ptxt.[Pop] and ptxt.[PopAll] constants. 
+// You can also pass a twine as the first argument to append to a copy
+// of it, or a *Twine to append to it in place. To pop fonts, colors,
+// effects or motions, you can use the ptxt.[Pop] and ptxt.[PopAll]
+// constants.
+//
+// See [Twine.Weave]() for the list of accepted argument types.
 func Weave(args ...any) Twine {
-	panic("unimplemented")
+	var twine Twine
+	if len(args) > 0 {
+		switch typedArg := args[0].(type) {
+		case Twine:
+			twine.contents = slices.Clone(typedArg.contents)
+			args = args[1 : ]
+		case *Twine:
+			typedArg.Weave(args[1 : ]...)
+			return *typedArg
+		}
+	}
+	twine.Weave(args...)
+	return twine
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Appends the given arguments to the twine. The accepted types are:
+//  - string, rune and []rune: text content, see [Twine.Add]().
+//  - [ggfnt.GlyphIndex] and [][ggfnt.GlyphIndex]: see [Twine.AddGlyphs]().
+//  - [color.RGBA]: see [Twine.PushColor]().
+//  - [StrandIndex]: see [Twine.PushStrand]().
+//  - [TwinePadder]: see [Twine.PushPadder]().
+//  - [Twine] and [*Twine]: the contents are appended directly.
+//  - ptxt.[Pop], ptxt.[PopAll] and ptxt.[Stop].
+// Any other type will make the method panic.
 func (self *Twine) Weave(args ...any) *Twine {
-	panic("unimplemented")
+	for _, arg := range args {
+		switch typedArg := arg.(type) {
+		case string:
+			self.Add(typedArg)
+		case rune:
+			self.AddRunes(typedArg)
+		case []rune:
+			self.AddRunes(typedArg...)
+		case ggfnt.GlyphIndex:
+			self.AddGlyphs(typedArg)
+		case []ggfnt.GlyphIndex:
+			self.AddGlyphs(typedArg...)
+		case color.RGBA:
+			self.PushColor(typedArg)
+		case StrandIndex:
+			self.PushStrand(typedArg)
+		case TwinePadder:
+			self.PushPadder(typedArg)
+		case Twine:
+			self.contents = append(self.contents, typedArg.contents...)
+		case *Twine:
+			self.contents = append(self.contents, typedArg.contents...)
+		case twinePopSpecialDirective:
+			switch typedArg {
+			case Pop    : self.Pop()
+			case PopAll : self.PopAll()
+			case Stop   : self.Stop()
+			default:
+				panic("invalid twine pop directive")
+			}
+		default:
+			panic(fmt.Sprintf("[ptxt.Twine.Weave] unsupported argument type %T", arg))
+		}
+	}
+	return self
 }
 
 // --- twine basic text content addition ---
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Appends the given text to the twine. The text must be
+// valid utf8, or the method will panic.
 func (self *Twine) Add(text string) *Twine {
-	panic("unimplemented")
+	if strings.IndexByte(text, twineCcBegin) != -1 || !utf8.ValidString(text) {
+		panic("[ptxt.Twine.Add] invalid utf8 text")
+	}
+	self.contents = append(self.contents, text...)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Appends the given code points to the twine.
 func (self *Twine) AddRunes(codePoints ...rune) *Twine {
-	panic("unimplemented")
+	for _, codePoint := range codePoints {
+		if !utf8.ValidRune(codePoint) {
+			panic("[ptxt.Twine.AddRunes] invalid code point")
+		}
+		self.contents = utf8.AppendRune(self.contents, codePoint)
+	}
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Appends the given glyph indices to the twine. Glyph indices
+// are not converted back and forth from code points, so they
+// are always interpreted with respect to the font [*strand.Strand]
+// that's active when they are reached.
+//
+// Control glyph indices like [ggfnt.GlyphNewLine] are also
+// accepted. Up to 65535 glyphs can be added at once.
 func (self *Twine) AddGlyphs(indices ...ggfnt.GlyphIndex) *Twine {
-	panic("unimplemented")
+	if len(indices) == 0 { return self }
+	if len(indices) > 65535 { panic("[ptxt.Twine.AddGlyphs] too many glyph indices") }
+
+	count := len(indices)
+	self.contents = append(self.contents, twineCcBegin, twineCcGlyphs, byte(count), byte(count >> 8))
+	for _, glyphIndex := range indices {
+		self.contents = append(self.contents, byte(glyphIndex), byte(glyphIndex >> 8))
+	}
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Appends the given raw utf8 bytes to the twine. The bytes
+// must be valid utf8, or the method will panic.
 func (self *Twine) AddUtf8(bytes ...byte) *Twine {
-	panic("unimplemented")
+	if !utf8.Valid(bytes) { panic("[ptxt.Twine.AddUtf8] invalid utf8 bytes") }
+	self.contents = append(self.contents, bytes...)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Appends a line break to the twine. Equivalent to adding '\n'.
 func (self *Twine) AddLineBreak() *Twine {
-	panic("unimplemented")
+	self.contents = append(self.contents, '\n')
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// By default, the height of a line is determined by the font strands
+// and scales of the glyphs on it. This directive makes the currently
+// active strand and scale count towards the current line metrics even
+// if no glyphs are drawn with them (e.g., for empty lines that should
+// have the height of a bigger font).
 func (self *Twine) AddLineMetricsRefresh() *Twine {
-	panic("unimplemented")
+	self.contents = append(self.contents, twineCcBegin, twineCcLineMetricsRefresh)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Clears the twine contents while retaining the underlying buffer
+// for reuse.
 func (self *Twine) Reset() {
-	panic("unimplemented")
+	self.contents = self.contents[ : 0]
+}
+
+// Returns whether the twine has no contents at all.
+func (self *Twine) IsEmpty() bool {
+	return len(self.contents) == 0
+}
+
+// Returns a new twine with the contents between the given byte
+// offsets, preceded by the push directives still active at 'start'.
+// This can be used to draw parts of a twine independently, like the
+// pages returned by [RendererTwine.AppendPages]().
+//
+// Offsets must be at rune, raw glyph or directive boundaries, as
+// the ones reported by [RendererTwine.AppendPages]().
+func (self *Twine) Excerpt(start, end int) Twine {
+	// find push directives still active at start
+	var stack []int
+	offset := 0
+	for offset < start {
+		if self.contents[offset] != twineCcBegin {
+			_, size := utf8.DecodeRune(self.contents[offset : ])
+			offset += size
+			continue
+		}
+		size := twineCcLen(self.contents, offset)
+		switch self.contents[offset + 1] {
+		case twineCcGlyphs, twineCcLineMetricsRefresh:
+			// not push directives
+		case twineCcPop:
+			if len(stack) > 0 { stack = stack[ : len(stack) - 1] }
+		case twineCcPopAll:
+			stack = stack[ : 0]
+		case twineCcStop:
+			for i := len(stack) - 1; i >= 0; i-- {
+				if self.contents[stack[i] + 1] != twineCcPushMotion { continue }
+				stack = append(stack[ : i], stack[i + 1 : ]...)
+				break
+			}
+		default:
+			stack = append(stack, offset)
+		}
+		if offset + size > start { break } // start within raw glyphs
+		offset += size
+	}
+
+	// copy directives and contents
+	var excerpt Twine
+	for _, pushOffset := range stack {
+		size := twineCcLen(self.contents, pushOffset)
+		excerpt.contents = append(excerpt.contents, self.contents[pushOffset : pushOffset + size]...)
+	}
+	for offset < end {
+		if self.contents[offset] != twineCcBegin {
+			_, size := utf8.DecodeRune(self.contents[offset : ])
+			excerpt.contents = append(excerpt.contents, self.contents[offset : offset + size]...)
+			offset += size
+			continue
+		}
+		size := twineCcLen(self.contents, offset)
+		if self.contents[offset + 1] == twineCcGlyphs && (offset < start || offset + size > end) {
+			// partial raw glyphs
+			var glyphs []ggfnt.GlyphIndex
+			for glyphOffset := offset + 4; glyphOffset < offset + size; glyphOffset += 2 {
+				if glyphOffset < start || glyphOffset >= end { continue }
+				glyphIndex := ggfnt.GlyphIndex(self.contents[glyphOffset]) | ggfnt.GlyphIndex(self.contents[glyphOffset + 1]) << 8
+				glyphs = append(glyphs, glyphIndex)
+			}
+			excerpt.AddGlyphs(glyphs...)
+		} else {
+			excerpt.contents = append(excerpt.contents, self.contents[offset : offset + size]...)
+		}
+		offset += size
+	}
+	return excerpt
 }
 
 // --- push / pop ---
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Pops the most recent push directive still active, whatever its
+// type (color, strand, scale, effect...).
+//
+// Pops without any matching push are ignored.
 func (self *Twine) Pop() *Twine {
-	panic("unimplemented")
+	self.contents = append(self.contents, twineCcBegin, twineCcPop)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Pops all the push directives still active.
 func (self *Twine) PopAll() *Twine {
-	panic("unimplemented")
+	self.contents = append(self.contents, twineCcBegin, twineCcPopAll)
+	return self
+}
+
+// Pops the most recent motion directive still active (see
+// [Twine.PushMotion]()), even if other directives have been
+// pushed after it.
+func (self *Twine) Stop() *Twine {
+	self.contents = append(self.contents, twineCcBegin, twineCcStop)
+	return self
 }
 
 // --- effects ---
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Changes the main text color until popped. The color takes
+// precedence over both [Renderer.SetColor]() and the strand's
+// main dye. Shadows are not affected.
 func (self *Twine) PushColor(textColor color.RGBA) *Twine {
-	panic("unimplemented")
+	self.contents = append(
+		self.contents, twineCcBegin, twineCcPushColor,
+		textColor.R, textColor.G, textColor.B, textColor.A,
+	)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-//
 // For changing the font strand at any point in the text. Unlike with
 // vectorial fonts, where more arbitrary changes might be used, pixel
 // fonts typically will only change between variants of the same font
 // in a single block of text. If you are using multiple pixel art fonts
 // in the same paragraph, chances are that the fonts have been designed
 // to work together from the start.
+//
+// Strand indices refer to the strands stored on the renderer (see
+// [RendererStrands]).
 func (self *Twine) PushStrand(index StrandIndex) *Twine {
-	panic("unimplemented")
+	self.contents = append(self.contents, twineCcBegin, twineCcPushStrand, uint8(index))
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Changes the text scale until popped. The scale can't be zero.
 func (self *Twine) PushScale(scale uint8) *Twine {
-	panic("unimplemented")
+	if scale == 0 { panic("[ptxt.Twine.PushScale] scale can't be zero") }
+	self.contents = append(self.contents, twineCcBegin, twineCcPushScale, scale)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Like [Twine.PushScale](), but relative to the currently active
+// scale. The resulting scale is clamped to [1, 255].
 func (self *Twine) PushScaleShift(scaleShift int8) *Twine {
-	panic("unimplemented")
+	self.contents = append(self.contents, twineCcBegin, twineCcPushScaleShift, uint8(scaleShift))
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Pushes a [TwinePadder] to reserve some space around a block of text.
+// The block ends when the padder is popped.
 func (self *Twine) PushPadder(spacer TwinePadder) *Twine {
-	panic("unimplemented")
+	var flags byte
+	if spacer.UnitsScaled { flags |= twinePadderUnitsScaledFlag }
+	self.contents = append(
+		self.contents, twineCcBegin, twineCcPushPadder,
+		byte(spacer.PrePad), byte(spacer.PrePad >> 8),
+		byte(spacer.PostPad), byte(spacer.PostPad >> 8),
+		byte(spacer.MinWidth), byte(spacer.MinWidth >> 8),
+		byte(spacer.LineStartPad), byte(spacer.LineStartPad >> 8),
+		byte(spacer.LineBreakPad), byte(spacer.LineBreakPad >> 8),
+		flags,
+	)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-func (self *Twine) PushSettingChange(key ggfnt.SettingKey, value uint8) {
-	// NOTE: this is for changing a setting in the current font strand.
-	// This probably can't be done arbitrarily outside this function
-	// because sometimes we might need to backtrack on twine formatting
-	// or something...
-
-	// TODO: doesn't make much sense for this to be a push, at least in public
-	// API terms. To be fair, strands, colors, scales and shifts should
-	// all be able to be changed "permanently". But at least with those
-	// you can just push and never pop in a fairly reasonable way. But
-	// with setting changes, it feels much more icky.
-	// Ok, there are some use cases for scope limited changes, but it's
-	// not particularly common.
-
-	// TODO: maybe document that in some cases it's actually safe to
-	// change settings at any point? like, with a custom function if
-	// we are not using any padding or back graphics effect, and no
-	// wrap?
-	panic("unimplemented")
+// Changes a setting of the currently active font strand for the
+// rest of the scope. For example, with a font that defines a setting
+// to switch between two styles of 'a':
+//   twine.Add("a").PushSettingChange(key, 1).Add("a").Pop().Add("a")
+// Only the second 'a' will use the alternative style. The previous
+// value is restored when the directive is popped, and any setting
+// change still active is undone after the twine is processed, so
+// the strand's settings are never modified permanently.
+//
+// Setting changes only affect glyph mapping and rewrite rules, so they
+// can be combined with padders, graphical effects and line wrapping
+// without restrictions. Changing settings on every small fragment of
+// a long text may have a small performance impact, though, as mapping
+// caches might need to be refreshed at each boundary.
+//
+// If the setting key is not valid for the active strand's font, or
+// the value is not a valid option, drawing or measuring the twine
+// will panic.
+func (self *Twine) PushSettingChange(key ggfnt.SettingKey, value uint8) *Twine {
+	self.contents = append(self.contents, twineCcBegin, twineCcPushSettingChange, uint8(key), value)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-//
 // Registers the current horizontal position in the text and sets it as the new
 // line restart position. This is useful to create itemized lists or any other
-// kind of text block that requires indentation for multiple lines.
+// kind of text block that requires indentation for multiple lines:
+//   twine.Add("- ").PushLineRestartMarker().Add("Long item text...").Pop()
+// While the marker is active, both wrapped lines and lines after explicit line
+// breaks will start at the marked position. Popping the marker restores the
+// previous restart position.
 func (self *Twine) PushLineRestartMarker() *Twine {
-	panic("unimplemented")
+	self.contents = append(self.contents, twineCcBegin, twineCcPushLineRestartMarker)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// For changing the text color glyph by glyph (rainbows, flashes,
+// fades, etc). The function must be a [TwineColorChangerFunc]
+// registered through [RendererTwine.RegisterFunc](). Color changers
+// are applied on top of [Twine.PushColor]() and only affect the main
+// draw pass, not shadows.
 func (self *Twine) PushColorChanger(fn TwineFuncID, payload ...byte) *Twine {
-	panic("unimplemented")
+	return self.pushFunc(twineCcPushColorChanger, fn, payload)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// For adding text movement (jumpy, wavy, etc). The function must be
+// a [TwineMotionFunc] registered through [RendererTwine.RegisterFunc]().
+// Some motion functions are already implemented in tinne26/ptxt/twine.
 //
-// For adding text movement (jumpy, wavy, etc). Some motion functions
-// and structs are already implemented in tinne26/ptxt/twine (TODO).
+// Motions can be popped with [Twine.Pop]() like any other directive,
+// but [Twine.Stop]() can also be used to stop the most recent motion
+// without affecting other directives pushed after it.
 func (self *Twine) PushMotion(fn TwineFuncID, payload ...byte) *Twine {
-	panic("unimplemented")
+	return self.pushFunc(twineCcPushMotion, fn, payload)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-//
-// For custom rendering over the underlying text.
+// For custom rendering over the underlying text. The function must be
+// a [TwineGfxFunc] registered through [RendererTwine.RegisterFunc]().
 // Some examples:
 //  - Crude strikethrough effect.
 //  - Crude underline effect.
 //  - Spoiler cover.
 //  - Wrap within a [TwinePadder] to draw your own graphics at an
 //    arbitrary point in the text.
+// Some of these effects are already implemented in tinne26/ptxt/twine.
 func (self *Twine) PushGfxFront(fn TwineFuncID, payload ...byte) *Twine {
-	panic("unimplemented")
+	return self.pushFunc(twineCcPushGfxFront, fn, payload)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
+// Like [Twine.PushGfxFront](), but drawing behind the text instead.
 func (self *Twine) PushGfxBack(fn TwineFuncID, payload ...byte) *Twine {
-	panic("unimplemented")
+	return self.pushFunc(twineCcPushGfxBack, fn, payload)
+}
+
+// Sets the delay between glyph reveals for a [Typewriter], in ticks,
+// until the directive is popped. A zero delay reveals the affected
+// glyphs all at once. For example, to slow down dramatically:
+//   twine.Add("I'm ").PushRevealDelay(12).Add("...").Pop().Add(" fine.")
+// The directive has no effect on measuring and drawing.
+func (self *Twine) PushRevealDelay(ticks uint8) *Twine {
+	self.contents = append(self.contents, twineCcBegin, twineCcPushRevealDelay, ticks)
+	return self
+}
+
+func (self *Twine) pushFunc(controlCode byte, fn TwineFuncID, payload []byte) *Twine {
+	if len(payload) > 255 { panic("twine function payload can't exceed 255 bytes") }
+	self.contents = append(self.contents, twineCcBegin, controlCode, uint8(fn), uint8(len(payload)))
+	self.contents = append(self.contents, payload...)
+	return self
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-//
 // For custom user configurations, callbacks and notifications.
 // Some examples:
 //  - Change user-side configuration for custom glyph drawing function
@@ -0,0 +1,13 @@
+//go:build cputext
+
+package twine
+
+import "image"
+import "image/draw"
+import "image/color"
+
+import "github.com/tinne26/ptxt/core"
+
+func fillRect(target core.Target, rect image.Rectangle, rgba color.RGBA) {
+	draw.Draw(target, rect, image.NewUniform(rgba), image.Point{}, draw.Over)
+}
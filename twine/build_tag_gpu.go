@@ -0,0 +1,15 @@
+//go:build !cputext
+
+package twine
+
+import "image"
+import "image/color"
+
+import "github.com/tinne26/ptxt/core"
+import "github.com/hajimehoshi/ebiten/v2/vector"
+
+func fillRect(target core.Target, rect image.Rectangle, rgba color.RGBA) {
+	x, y := float32(rect.Min.X), float32(rect.Min.Y)
+	w, h := float32(rect.Dx()), float32(rect.Dy())
+	vector.DrawFilledRect(target, x, y, w, h, rgba, false)
+}
@@ -0,0 +1,113 @@
+package twine
+
+import "image"
+import "image/color"
+
+import "github.com/tinne26/ptxt"
+import "github.com/tinne26/ptxt/core"
+
+// Function IDs for the graphics effects in this package, as returned
+// by [RegisterGfx]().
+type Gfx struct {
+	Underline     ptxt.TwineFuncID
+	Strikethrough ptxt.TwineFuncID
+	Highlight     ptxt.TwineFuncID
+	Spoiler       ptxt.TwineFuncID
+}
+
+// Registers all the graphics effects of this package on the given
+// renderer and returns their function IDs. Usage example:
+//   gfx := twine.RegisterGfx(renderer)
+//   var text ptxt.Twine
+//   text.Add("SEE ").PushGfxFront(gfx.Underline, twine.LinePayload(blue, 1)...)
+//   text.Add("THE MANUAL").Pop()
+// Underlines and strikethroughs are typically used with
+// [ptxt.Twine.PushGfxFront](), highlights with [ptxt.Twine.PushGfxBack]()
+// and spoilers with [ptxt.Twine.PushGfxFront]().
+func RegisterGfx(renderer *ptxt.Renderer) Gfx {
+	return Gfx{
+		Underline:     renderer.Twine().RegisterFunc(ptxt.TwineGfxFunc(Underline)),
+		Strikethrough: renderer.Twine().RegisterFunc(ptxt.TwineGfxFunc(Strikethrough)),
+		Highlight:     renderer.Twine().RegisterFunc(ptxt.TwineGfxFunc(Highlight)),
+		Spoiler:       renderer.Twine().RegisterFunc(ptxt.TwineGfxFunc(Spoiler)),
+	}
+}
+
+// Releases the effects previously registered with [RegisterGfx]().
+func (self *Gfx) Release(renderer *ptxt.Renderer) {
+	renderer.Twine().ReleaseFunc(self.Underline)
+	renderer.Twine().ReleaseFunc(self.Strikethrough)
+	renderer.Twine().ReleaseFunc(self.Highlight)
+	renderer.Twine().ReleaseFunc(self.Spoiler)
+}
+
+// Draws a line one pixel below the baseline. Payload:
+//  - [0:4] RGBA color (premultiplied alpha).
+//  - [4] line thickness in pixels, optional (default 1).
+// The line is scaled with the text and kept inside the effect rect,
+// so fonts without descent will get the line on the baseline row
+// instead. Use [LinePayload]() to create payloads.
+func Underline(target core.Target, args ptxt.TwineEffectArgs, rect image.Rectangle) {
+	rgba, thickness := linePayloadValues(args.Payload)
+	thickness *= int(args.Renderer.GetScale())
+	y := min(args.OY + int(args.Renderer.GetScale()), rect.Max.Y - thickness)
+	fillRect(target, image.Rect(rect.Min.X, y, rect.Max.X, y + thickness), rgba)
+}
+
+// Draws a line through the middle of lowercase letters, or through the
+// middle of the ascent if the font doesn't define a midline. The payload
+// is the same as for [Underline](). Use [LinePayload]() to create payloads.
+func Strikethrough(target core.Target, args ptxt.TwineEffectArgs, rect image.Rectangle) {
+	rgba, thickness := linePayloadValues(args.Payload)
+	scale := int(args.Renderer.GetScale())
+	thickness *= scale
+	height := int(args.Renderer.Strand().Font().Metrics().MidlineAscent())*scale
+	if height == 0 { height = args.OY - rect.Min.Y }
+	y := args.OY - (height + thickness)/2
+	fillRect(target, image.Rect(rect.Min.X, y, rect.Max.X, y + thickness), rgba)
+}
+
+// Fills the effect rect. Payload:
+//  - [0:4] RGBA color (premultiplied alpha).
+// Use [ColorPayload]() to create payloads.
+func Highlight(target core.Target, args ptxt.TwineEffectArgs, rect image.Rectangle) {
+	args.AssertPayloadLen(4)
+	fillRect(target, rect, payloadRGBA(args.Payload))
+}
+
+// Like [Highlight](), but extending the rect one pixel horizontally
+// on each side, except at line wraps, so the covered glyphs can't
+// be guessed from any overshoot. Meant to be used as a front effect.
+// Use [ColorPayload]() to create payloads.
+func Spoiler(target core.Target, args ptxt.TwineEffectArgs, rect image.Rectangle) {
+	args.AssertPayloadLen(4)
+	scale := int(args.Renderer.GetScale())
+	if !args.StartWrap { rect.Min.X -= scale }
+	if !args.EndWrap { rect.Max.X += scale }
+	fillRect(target, rect, payloadRGBA(args.Payload))
+}
+
+// Returns a payload for [Highlight]() or [Spoiler]().
+func ColorPayload(rgba color.RGBA) []byte {
+	return []byte{rgba.R, rgba.G, rgba.B, rgba.A}
+}
+
+// Returns a payload for [Underline]() or [Strikethrough]().
+func LinePayload(rgba color.RGBA, thickness uint8) []byte {
+	return []byte{rgba.R, rgba.G, rgba.B, rgba.A, thickness}
+}
+
+// ---- helpers ----
+
+func payloadRGBA(payload []byte) color.RGBA {
+	return color.RGBA{payload[0], payload[1], payload[2], payload[3]}
+}
+
+func linePayloadValues(payload []byte) (color.RGBA, int) {
+	switch len(payload) {
+	case 4: return payloadRGBA(payload), 1
+	case 5: return payloadRGBA(payload), max(int(payload[4]), 1)
+	default:
+		panic("invalid line payload length")
+	}
+}
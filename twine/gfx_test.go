@@ -0,0 +1,47 @@
+//go:build cputext
+
+package twine
+
+import "testing"
+import "image"
+import "image/color"
+
+import "github.com/tinne26/ptxt"
+
+func TestGfx(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	renderer := ptxt.NewRenderer()
+	renderer.SetScale(2)
+	rect := image.Rect(4, 0, 20, 14) // baseline at y = 10
+	args := ptxt.TwineEffectArgs{ Renderer: renderer, OX: 4, OY: 10 }
+
+	// underline
+	target := image.NewRGBA(image.Rect(0, 0, 24, 16))
+	args.Payload = LinePayload(red, 1)
+	Underline(target, args, rect)
+	expectFilled(t, "Underline", target, image.Rect(4, 12, 20, 14))
+
+	// highlight
+	target = image.NewRGBA(image.Rect(0, 0, 24, 16))
+	args.Payload = ColorPayload(red)
+	Highlight(target, args, rect)
+	expectFilled(t, "Highlight", target, rect)
+
+	// spoiler
+	target = image.NewRGBA(image.Rect(0, 0, 24, 16))
+	args.EndWrap = true
+	Spoiler(target, args, rect)
+	expectFilled(t, "Spoiler", target, image.Rect(2, 0, 20, 14))
+}
+
+func expectFilled(t *testing.T, name string, target *image.RGBA, rect image.Rectangle) {
+	bounds := target.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			filled := (target.RGBAAt(x, y).A != 0)
+			if filled != image.Pt(x, y).In(rect) {
+				t.Fatalf("%s: expected filled rect %v, unexpected pixel state at (%d, %d)", name, rect, x, y)
+			}
+		}
+	}
+}
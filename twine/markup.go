@@ -0,0 +1,378 @@
+package twine
+
+import "fmt"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+import "image/color"
+
+import "github.com/tinne26/ptxt"
+
+// Kinds of twine functions that can be referenced from markup tags.
+type MarkupFuncKind uint8
+
+const (
+	MarkupMotion MarkupFuncKind = iota // see [ptxt.Twine.PushMotion]()
+	MarkupGfxFront // see [ptxt.Twine.PushGfxFront]()
+	MarkupGfxBack // see [ptxt.Twine.PushGfxBack]()
+	MarkupColorChanger // see [ptxt.Twine.PushColorChanger]()
+)
+
+// A twine function that can be referenced from markup through
+// [MarkupOptions].Funcs.
+type MarkupFunc struct {
+	Kind MarkupFuncKind
+	ID ptxt.TwineFuncID
+	Payload []byte // payload used when the tag has no value
+	ParsePayload func(value string) ([]byte, error) // nil if the tag doesn't accept values
+}
+
+// An inline icon that can be referenced from markup through
+// [MarkupOptions].Icons. Icons are drawn by a [ptxt.TwineGfxFunc]
+// pushed as a front effect, with a padder reserving Width pixels
+// for it. The width is scaled with the text.
+type MarkupIcon struct {
+	Func ptxt.TwineFuncID
+	Payload []byte
+	Width uint16
+}
+
+// Options for [ParseMarkup](). All the maps are optional.
+type MarkupOptions struct {
+	Strands map[string]ptxt.StrandIndex // names for [font=name] tags
+	Colors map[string]color.RGBA // names for [color=name] tags
+	Funcs map[string]MarkupFunc // [name]...[/name] and [name=value]...[/name] tags
+	Icons map[string]MarkupIcon // names for [icon=name] tags
+}
+
+// Adds the motions from [RegisterMotions]() to Funcs as "wave",
+// "shake", "jump" and "bounce" tags. Tag values are parsed with
+// [ParseBytePayload](), so you can write [wave=3,8,60] to override
+// the default wave parameters.
+func (self *MarkupOptions) AddMotions(motions Motions) {
+	self.addFunc("wave", MarkupFunc{ Kind: MarkupMotion, ID: motions.Wave, ParsePayload: ParseBytePayload })
+	self.addFunc("shake", MarkupFunc{ Kind: MarkupMotion, ID: motions.Shake, ParsePayload: ParseBytePayload })
+	self.addFunc("jump", MarkupFunc{ Kind: MarkupMotion, ID: motions.Jump, ParsePayload: ParseBytePayload })
+	self.addFunc("bounce", MarkupFunc{ Kind: MarkupMotion, ID: motions.Bounce, ParsePayload: ParseBytePayload })
+}
+
+// Adds the effects from [RegisterGfx]() to Funcs as "u" (underline),
+// "s" (strikethrough), "highlight" and "spoiler" tags. Tag values
+// are parsed as colors, like [u=#f00], and the given color is used
+// when no value is given.
+func (self *MarkupOptions) AddGfx(gfx Gfx, rgba color.RGBA) {
+	parseLine := func(value string) ([]byte, error) {
+		rgba, err := self.parseColor(value)
+		return LinePayload(rgba, 1), err
+	}
+	parseColor := func(value string) ([]byte, error) {
+		rgba, err := self.parseColor(value)
+		return ColorPayload(rgba), err
+	}
+	self.addFunc("u", MarkupFunc{ Kind: MarkupGfxFront, ID: gfx.Underline, Payload: LinePayload(rgba, 1), ParsePayload: parseLine })
+	self.addFunc("s", MarkupFunc{ Kind: MarkupGfxFront, ID: gfx.Strikethrough, Payload: LinePayload(rgba, 1), ParsePayload: parseLine })
+	self.addFunc("highlight", MarkupFunc{ Kind: MarkupGfxBack, ID: gfx.Highlight, Payload: ColorPayload(rgba), ParsePayload: parseColor })
+	self.addFunc("spoiler", MarkupFunc{ Kind: MarkupGfxFront, ID: gfx.Spoiler, Payload: ColorPayload(rgba), ParsePayload: parseColor })
+}
+
+func (self *MarkupOptions) addFunc(name string, fn MarkupFunc) {
+	if self.Funcs == nil { self.Funcs = make(map[string]MarkupFunc, 8) }
+	self.Funcs[name] = fn
+}
+
+// Parses colors in #RGB, #RGBA, #RRGGBB or #RRGGBBAA hex formats, or
+// by name from the options' Colors map. Hex colors with alpha are
+// converted to premultiplied alpha.
+func (self *MarkupOptions) parseColor(value string) (color.RGBA, error) {
+	if !strings.HasPrefix(value, "#") {
+		if self != nil {
+			rgba, found := self.Colors[value]
+			if found { return rgba, nil }
+		}
+		return color.RGBA{}, fmt.Errorf("unknown color %q", value)
+	}
+
+	hex := value[1 : ]
+	var digits [8]uint8
+	switch len(hex) {
+	case 3, 4, 6, 8:
+		for i := 0; i < len(hex); i++ {
+			digit, err := strconv.ParseUint(hex[i : i + 1], 16, 8)
+			if err != nil { return color.RGBA{}, fmt.Errorf("invalid hex color %q", value) }
+			digits[i] = uint8(digit)
+		}
+	default:
+		return color.RGBA{}, fmt.Errorf("invalid hex color %q", value)
+	}
+
+	channels := [4]uint8{0, 0, 0, 255}
+	if len(hex) <= 4 {
+		for i := 0; i < len(hex); i++ { channels[i] = digits[i]*17 }
+	} else {
+		for i := 0; i < len(hex); i += 2 { channels[i >> 1] = digits[i] << 4 | digits[i + 1] }
+	}
+	rgba := color.RGBA{channels[0], channels[1], channels[2], channels[3]}
+	if rgba.A != 255 {
+		rgba.R = uint8(uint16(rgba.R)*uint16(rgba.A)/255)
+		rgba.G = uint8(uint16(rgba.G)*uint16(rgba.A)/255)
+		rgba.B = uint8(uint16(rgba.B)*uint16(rgba.A)/255)
+	}
+	return rgba, nil
+}
+
+// Parses a comma separated list of byte values, like "3,8,60".
+// An empty value results in an empty payload.
+func ParseBytePayload(value string) ([]byte, error) {
+	if value == "" { return nil, nil }
+	fields := strings.Split(value, ",")
+	payload := make([]byte, 0, len(fields))
+	for _, field := range fields {
+		n, err := strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+		if err != nil { return nil, fmt.Errorf("invalid byte value %q", field) }
+		payload = append(payload, byte(n))
+	}
+	return payload, nil
+}
+
+// Error returned by [ParseMarkup](). Lines and columns start at 1,
+// and columns are counted in code points.
+type MarkupError struct {
+	Line int
+	Column int
+	Message string
+}
+
+// Implements the error interface.
+func (self *MarkupError) Error() string {
+	return fmt.Sprintf("markup error at line %d, column %d: %s", self.Line, self.Column, self.Message)
+}
+
+// Compiles the given markup text into a [ptxt.Twine]. For example:
+//   var opts twine.MarkupOptions
+//   opts.AddMotions(twine.RegisterMotions(renderer))
+//   text, err := twine.ParseMarkup("[color=#f00]HP[/color] [wave]low![/wave]", &opts)
+// Tags are written between square brackets, and must be closed in
+// reverse order of opening. Built-in tags:
+//  - [color=value]...[/color]: #RGB, #RGBA, #RRGGBB, #RRGGBBAA or
+//    a name from [MarkupOptions].Colors.
+//  - [font=value]...[/font]: a name from [MarkupOptions].Strands or
+//    a numeric strand index.
+//  - [scale=N]...[/scale]: an absolute scale, or a relative scale
+//    shift if the value starts with '+' or '-'.
+//  - [indent]...[/indent]: see [ptxt.Twine.PushLineRestartMarker]().
+//  - [delay=N]...[/delay]: see [ptxt.Twine.PushRevealDelay]().
+//  - [icon=name]: a name from [MarkupOptions].Icons. No closing tag.
+// Any other tag is looked up in [MarkupOptions].Funcs. Built-in tag
+// names take precedence.
+//
+// Use "[[" to write a literal '['. Line breaks can't appear inside
+// tags. The options can be nil if only built-in tags are used.
+func ParseMarkup(src string, opts *MarkupOptions) (ptxt.Twine, error) {
+	var parser markupParser
+	parser.src  = src
+	parser.opts = opts
+	parser.line = 1
+	parser.column = 1
+	err := parser.Parse()
+	return parser.twine, err
+}
+
+// ---- parser ----
+
+type markupOpenTag struct {
+	name string
+	line int
+	column int
+}
+
+type markupParser struct {
+	src string
+	opts *MarkupOptions
+	twine ptxt.Twine
+	openTags []markupOpenTag
+	index int
+	line int
+	column int
+	textStart int
+}
+
+func (self *markupParser) Parse() error {
+	for self.index < len(self.src) {
+		if self.src[self.index] != '[' {
+			codePoint, size := utf8.DecodeRuneInString(self.src[self.index : ])
+			if codePoint == utf8.RuneError && size <= 1 { return self.errorf("invalid utf8") }
+			self.advance(size, codePoint == '\n')
+			continue
+		}
+
+		// escaped bracket
+		if strings.HasPrefix(self.src[self.index : ], "[[") {
+			self.flushText()
+			self.twine.AddRunes('[')
+			self.advance(2, false)
+			self.textStart = self.index
+			continue
+		}
+
+		// tag
+		self.flushText()
+		err := self.parseTag()
+		if err != nil { return err }
+		self.textStart = self.index
+	}
+	self.flushText()
+
+	if len(self.openTags) > 0 {
+		tag := self.openTags[len(self.openTags) - 1]
+		return &MarkupError{ tag.line, tag.column, fmt.Sprintf("tag [%s] never closed", tag.name) }
+	}
+	return nil
+}
+
+func (self *markupParser) advance(numBytes int, lineBreak bool) {
+	if lineBreak {
+		self.line += 1
+		self.column = 1
+	} else {
+		self.column += utf8.RuneCountInString(self.src[self.index : self.index + numBytes])
+	}
+	self.index += numBytes
+}
+
+func (self *markupParser) flushText() {
+	if self.textStart < self.index {
+		self.twine.Add(self.src[self.textStart : self.index])
+	}
+	self.textStart = self.index
+}
+
+func (self *markupParser) errorf(format string, args ...any) error {
+	return &MarkupError{ self.line, self.column, fmt.Sprintf(format, args...) }
+}
+
+func (self *markupParser) parseTag() error {
+	line, column := self.line, self.column
+	end := strings.IndexAny(self.src[self.index : ], "]\n")
+	if end == -1 || self.src[self.index + end] == '\n' {
+		return self.errorf("unterminated tag")
+	}
+	content := self.src[self.index + 1 : self.index + end]
+	if !utf8.ValidString(content) { return self.errorf("invalid utf8") }
+	self.column += utf8.RuneCountInString(content) + 2
+	self.index += end + 1
+
+	// closing tags
+	if strings.HasPrefix(content, "/") {
+		name := content[1 : ]
+		if len(self.openTags) == 0 {
+			return &MarkupError{ line, column, fmt.Sprintf("closing tag [/%s] without opening tag", name) }
+		}
+		tag := self.openTags[len(self.openTags) - 1]
+		if tag.name != name {
+			return &MarkupError{ line, column, fmt.Sprintf("closing tag [/%s] doesn't match open tag [%s]", name, tag.name) }
+		}
+		self.openTags = self.openTags[ : len(self.openTags) - 1]
+		self.twine.Pop()
+		return nil
+	}
+
+	// opening tags
+	name, value, hasValue := strings.Cut(content, "=")
+	if !isValidMarkupTagName(name) {
+		return &MarkupError{ line, column, fmt.Sprintf("invalid tag name %q", name) }
+	}
+	err := self.pushTag(name, value, hasValue)
+	if err != nil {
+		return &MarkupError{ line, column, fmt.Sprintf("tag [%s]: %s", name, err.Error()) }
+	}
+	if name != "icon" {
+		self.openTags = append(self.openTags, markupOpenTag{ name, line, column })
+	}
+	return nil
+}
+
+func (self *markupParser) pushTag(name, value string, hasValue bool) error {
+	switch name {
+	case "color":
+		if !hasValue { return fmt.Errorf("missing color value") }
+		rgba, err := self.opts.parseColor(value)
+		if err != nil { return err }
+		self.twine.PushColor(rgba)
+	case "font":
+		if !hasValue { return fmt.Errorf("missing font value") }
+		if self.opts != nil {
+			index, found := self.opts.Strands[value]
+			if found {
+				self.twine.PushStrand(index)
+				return nil
+			}
+		}
+		index, err := strconv.ParseUint(value, 10, 8)
+		if err != nil { return fmt.Errorf("unknown font %q", value) }
+		self.twine.PushStrand(ptxt.StrandIndex(index))
+	case "scale":
+		if !hasValue { return fmt.Errorf("missing scale value") }
+		if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+			shift, err := strconv.ParseInt(value, 10, 8)
+			if err != nil { return fmt.Errorf("invalid scale shift %q", value) }
+			self.twine.PushScaleShift(int8(shift))
+		} else {
+			scale, err := strconv.ParseUint(value, 10, 8)
+			if err != nil || scale == 0 { return fmt.Errorf("invalid scale %q", value) }
+			self.twine.PushScale(uint8(scale))
+		}
+	case "delay":
+		if !hasValue { return fmt.Errorf("missing delay value") }
+		ticks, err := strconv.ParseUint(value, 10, 8)
+		if err != nil { return fmt.Errorf("invalid delay %q", value) }
+		self.twine.PushRevealDelay(uint8(ticks))
+	case "indent":
+		if hasValue { return fmt.Errorf("unexpected value") }
+		self.twine.PushLineRestartMarker()
+	case "icon":
+		if !hasValue { return fmt.Errorf("missing icon name") }
+		var icon MarkupIcon
+		var found bool
+		if self.opts != nil { icon, found = self.opts.Icons[value] }
+		if !found { return fmt.Errorf("unknown icon %q", value) }
+		self.twine.PushGfxFront(icon.Func, icon.Payload...)
+		self.twine.PushPadder(ptxt.TwinePadder{ MinWidth: icon.Width })
+		self.twine.Pop().Pop()
+	default:
+		var fn MarkupFunc
+		var found bool
+		if self.opts != nil { fn, found = self.opts.Funcs[name] }
+		if !found { return fmt.Errorf("unknown tag") }
+		payload := fn.Payload
+		if hasValue {
+			if fn.ParsePayload == nil { return fmt.Errorf("unexpected value") }
+			var err error
+			payload, err = fn.ParsePayload(value)
+			if err != nil { return err }
+		}
+		if len(payload) > 255 { return fmt.Errorf("payload too long") }
+		switch fn.Kind {
+		case MarkupMotion       : self.twine.PushMotion(fn.ID, payload...)
+		case MarkupGfxFront     : self.twine.PushGfxFront(fn.ID, payload...)
+		case MarkupGfxBack      : self.twine.PushGfxBack(fn.ID, payload...)
+		case MarkupColorChanger : self.twine.PushColorChanger(fn.ID, payload...)
+		default:
+			return fmt.Errorf("invalid func kind %d", fn.Kind)
+		}
+	}
+	return nil
+}
+
+func isValidMarkupTagName(name string) bool {
+	if name == "" { return false }
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '_', ch == '-':
+			// valid
+		default:
+			return false
+		}
+	}
+	return true
+}
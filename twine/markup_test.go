@@ -0,0 +1,76 @@
+package twine
+
+import "testing"
+import "errors"
+import "reflect"
+import "image/color"
+
+import "github.com/tinne26/ptxt"
+
+func TestParseMarkup(t *testing.T) {
+	var opts MarkupOptions
+	opts.Strands = map[string]ptxt.StrandIndex{ "bold": 1 }
+	opts.Colors = map[string]color.RGBA{ "gold": {255, 215, 0, 255} }
+	opts.Icons = map[string]MarkupIcon{ "sword": { Func: 7, Width: 9 } }
+	opts.AddMotions(Motions{ Wave: 3, Shake: 4, Jump: 5, Bounce: 6 })
+	red := color.RGBA{255, 0, 0, 255}
+
+	tests := []struct {
+		src string
+		expected ptxt.Twine
+	}{
+		{ "plain text", ptxt.Weave("plain text") },
+		{ "[color=#f00]HP[/color] LOW", ptxt.Weave(red, "HP", ptxt.Pop, " LOW") },
+		{ "[color=#ff000080]A[/color]", ptxt.Weave(color.RGBA{128, 0, 0, 128}, "A", ptxt.Pop) },
+		{ "[color=gold]A[/color]", ptxt.Weave(opts.Colors["gold"], "A", ptxt.Pop) },
+		{ "[font=bold]A[font=0]B[/font][/font]", ptxt.Weave(ptxt.StrandIndex(1), "A", ptxt.StrandIndex(0), "B", ptxt.Pop, ptxt.Pop) },
+		{ "[[not a tag]", ptxt.Weave("[not a tag]") },
+		{ "x]y", ptxt.Weave("x]y") },
+		{ "[scale=2]A[/scale][scale=-1]B[/scale]", *new(ptxt.Twine).PushScale(2).Add("A").Pop().PushScaleShift(-1).Add("B").Pop() },
+		{ "[wave]low![/wave]", *new(ptxt.Twine).PushMotion(3).Add("low!").Pop() },
+		{ "[wave=3,8,60]A[/wave]", *new(ptxt.Twine).PushMotion(3, 3, 8, 60).Add("A").Pop() },
+		{ "[delay=9]...[/delay]", *new(ptxt.Twine).PushRevealDelay(9).Add("...").Pop() },
+		{ "- [indent]A[/indent]", *new(ptxt.Twine).Add("- ").PushLineRestartMarker().Add("A").Pop() },
+		{ "[icon=sword]!", *new(ptxt.Twine).PushGfxFront(7).PushPadder(ptxt.TwinePadder{ MinWidth: 9 }).Pop().Pop().Add("!") },
+	}
+	for _, test := range tests {
+		twine, err := ParseMarkup(test.src, &opts)
+		if err != nil { t.Fatalf("%q: unexpected error: %s", test.src, err) }
+		if !reflect.DeepEqual(twine, test.expected) {
+			t.Fatalf("%q: unexpected twine %v, expected %v", test.src, twine, test.expected)
+		}
+	}
+
+	// errors
+	errorTests := []struct {
+		src string
+		line, column int
+	}{
+		{ "[color=#f00]A", 1, 1 },
+		{ "AB\n[wave]A[/color]", 2, 8 },
+		{ "AB\nñ[nope]", 2, 2 },
+		{ "[color=#ff]A[/color]", 1, 1 },
+		{ "[/wave]", 1, 1 },
+		{ "A\n\nB [wave", 3, 3 },
+		{ "[icon=shield]", 1, 1 },
+		{ "[font=italic]A[/font]", 1, 1 },
+		{ "[[[[x[bogus]", 1, 6 },
+		{ "[[ñ\n[[[bogus]", 2, 3 },
+	}
+	for _, test := range errorTests {
+		_, err := ParseMarkup(test.src, &opts)
+		var markupErr *MarkupError
+		if !errors.As(err, &markupErr) {
+			t.Fatalf("%q: expected markup error, got %v", test.src, err)
+		}
+		if markupErr.Line != test.line || markupErr.Column != test.column {
+			t.Fatalf("%q: expected error at %d:%d, got %s", test.src, test.line, test.column, err)
+		}
+	}
+
+	// nil options
+	_, err := ParseMarkup("[scale=2]A[/scale]", nil)
+	if err != nil { t.Fatalf("unexpected error with nil options: %s", err) }
+	_, err = ParseMarkup("[wave]A[/wave]", nil)
+	if err == nil { t.Fatal("expected error for unknown tag with nil options") }
+}
@@ -0,0 +1,171 @@
+package twine
+
+import "math"
+
+import "github.com/tinne26/ptxt"
+
+// Function IDs for the motions in this package, as returned by
+// [RegisterMotions]().
+type Motions struct {
+	Wave   ptxt.TwineFuncID
+	Shake  ptxt.TwineFuncID
+	Jump   ptxt.TwineFuncID
+	Bounce ptxt.TwineFuncID
+}
+
+// Registers all the motions of this package on the given renderer
+// and returns their function IDs. Usage example:
+//   motions := twine.RegisterMotions(renderer)
+//   var text ptxt.Twine
+//   text.Add("I'M ").PushMotion(motions.Wave).Add("WAVY").Stop()
+// Animations are driven by the tick set through [ptxt.RendererTwine.SetTick]().
+//
+// Each motion can also be registered individually if you don't
+// need all of them.
+func RegisterMotions(renderer *ptxt.Renderer) Motions {
+	return Motions{
+		Wave:   renderer.Twine().RegisterFunc(ptxt.TwineMotionFunc(Wave)),
+		Shake:  renderer.Twine().RegisterFunc(ptxt.TwineMotionFunc(Shake)),
+		Jump:   renderer.Twine().RegisterFunc(ptxt.TwineMotionFunc(Jump)),
+		Bounce: renderer.Twine().RegisterFunc(ptxt.TwineMotionFunc(Bounce)),
+	}
+}
+
+// Releases the motions previously registered with [RegisterMotions]().
+func (self *Motions) Release(renderer *ptxt.Renderer) {
+	renderer.Twine().ReleaseFunc(self.Wave)
+	renderer.Twine().ReleaseFunc(self.Shake)
+	renderer.Twine().ReleaseFunc(self.Jump)
+	renderer.Twine().ReleaseFunc(self.Bounce)
+}
+
+// Vertical sine wave moving along the text. Optional payload:
+//  - [0] amplitude in pixels (default 2).
+//  - [1] wavelength in glyphs (default 8).
+//  - [2] period in ticks (default 60).
+// Use [WavePayload]() to create payloads.
+func Wave(args ptxt.TwineEffectArgs, glyphNum int) (x, y int) {
+	amplitude, wavelength, period := payloadValues3(args.Payload, 2, 8, 60)
+	if amplitude == 0 { return 0, 0 }
+	wavelength, period = max(wavelength, 1), max(period, 1)
+	phase := float64(args.Tick % uint64(period))/float64(period)
+	phase += float64(glyphNum % wavelength)/float64(wavelength)
+	return 0, int(math.Round(float64(amplitude)*math.Sin(2*math.Pi*phase)))
+}
+
+// Returns a payload for [Wave]().
+func WavePayload(amplitude, wavelength, period uint8) []byte {
+	return []byte{amplitude, wavelength, period}
+}
+
+// Random jitter in both axes. The same glyph keeps the same offsets
+// for the whole interval, so the effect doesn't flicker on every
+// frame. Optional payload:
+//  - [0] amplitude in pixels (default 1).
+//  - [1] interval in ticks (default 6).
+// Use [ShakePayload]() to create payloads.
+func Shake(args ptxt.TwineEffectArgs, glyphNum int) (x, y int) {
+	amplitude, interval := payloadValues2(args.Payload, 1, 6)
+	if amplitude == 0 { return 0, 0 }
+	interval = max(interval, 1)
+	hash := mix(args.Tick/uint64(interval), uint64(glyphNum))
+	span := uint64(amplitude)*2 + 1
+	x = int(hash % span) - amplitude
+	y = int((hash >> 32) % span) - amplitude
+	return x, y
+}
+
+// Returns a payload for [Shake]().
+func ShakePayload(amplitude, interval uint8) []byte {
+	return []byte{amplitude, interval}
+}
+
+// Glyphs hop one after another, like a ripple running through the
+// text, and then rest until the next cycle. Optional payload:
+//  - [0] jump height in pixels (default 3).
+//  - [1] jump duration in ticks (default 12).
+//  - [2] delay between consecutive glyphs in ticks (default 3).
+//  - [3] rest time after the last glyph in ticks (default 60).
+// Use [JumpPayload]() to create payloads.
+//
+// Since the motion doesn't know the total number of glyphs in advance,
+// the cycle is only synchronized for spans of up to 32 glyphs.
+func Jump(args ptxt.TwineEffectArgs, glyphNum int) (x, y int) {
+	height, duration, delay, rest := payloadValues4(args.Payload, 3, 12, 3, 60)
+	duration = max(duration, 1)
+	const maxSyncGlyphs = 32
+	cycle := uint64(maxSyncGlyphs*delay + duration + rest)
+	tick := int(args.Tick % cycle) - (glyphNum % maxSyncGlyphs)*delay
+	if tick < 0 || tick >= duration { return 0, 0 }
+	return 0, -hop(height, tick, duration)
+}
+
+// Returns a payload for [Jump]().
+func JumpPayload(height, duration, delay, rest uint8) []byte {
+	return []byte{height, duration, delay, rest}
+}
+
+// Glyphs bounce continuously as if they were falling on the baseline,
+// with each glyph slightly out of phase with the previous one. Optional
+// payload:
+//  - [0] bounce height in pixels (default 2).
+//  - [1] bounce period in ticks (default 30).
+//  - [2] phase shift between consecutive glyphs in ticks (default 4).
+// Use [BouncePayload]() to create payloads.
+func Bounce(args ptxt.TwineEffectArgs, glyphNum int) (x, y int) {
+	height, period, shift := payloadValues3(args.Payload, 2, 30, 4)
+	period = max(period, 1)
+	tick := int((args.Tick + uint64(glyphNum*shift)) % uint64(period))
+	return 0, -hop(height, tick, period)
+}
+
+// Returns a payload for [Bounce]().
+func BouncePayload(height, period, phaseShift uint8) []byte {
+	return []byte{height, period, phaseShift}
+}
+
+// ---- helpers ----
+
+// Parabolic hop height at the given tick, for a hop of the given
+// duration in ticks.
+func hop(height, tick, duration int) int {
+	t := (float64(tick) + 0.5)/float64(duration) // (0, 1)
+	return int(math.Round(float64(height)*4*t*(1 - t)))
+}
+
+// Simple integer hash (splitmix64 finalizer).
+func mix(a, b uint64) uint64 {
+	z := a*0x9E3779B97F4A7C15 + b + 0x632BE59BD9B4E019
+	z = (z ^ (z >> 30))*0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27))*0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// Returns the payload values, or the given defaults if the payload
+// is empty.
+func payloadValues2(payload []byte, a, b uint8) (int, int) {
+	switch len(payload) {
+	case 0: return int(a), int(b)
+	case 2: return int(payload[0]), int(payload[1])
+	default:
+		panic("invalid motion payload length")
+	}
+}
+
+func payloadValues3(payload []byte, a, b, c uint8) (int, int, int) {
+	switch len(payload) {
+	case 0: return int(a), int(b), int(c)
+	case 3: return int(payload[0]), int(payload[1]), int(payload[2])
+	default:
+		panic("invalid motion payload length")
+	}
+}
+
+func payloadValues4(payload []byte, a, b, c, d uint8) (int, int, int, int) {
+	switch len(payload) {
+	case 0: return int(a), int(b), int(c), int(d)
+	case 4: return int(payload[0]), int(payload[1]), int(payload[2]), int(payload[3])
+	default:
+		panic("invalid motion payload length")
+	}
+}
@@ -0,0 +1,50 @@
+package twine
+
+import "testing"
+
+import "github.com/tinne26/ptxt"
+
+func TestMotions(t *testing.T) {
+	motions := []struct {
+		name string
+		fn ptxt.TwineMotionFunc
+		payload []byte
+		maxOffset int
+	}{
+		{ "Wave"  , Wave  , WavePayload(3, 5, 20), 3 },
+		{ "Shake" , Shake , ShakePayload(2, 4), 2 },
+		{ "Jump"  , Jump  , JumpPayload(4, 10, 2, 30), 4 },
+		{ "Bounce", Bounce, BouncePayload(5, 17, 3), 5 },
+		{ "Wave (default)"  , Wave  , nil, 2 },
+		{ "Bounce (default)", Bounce, nil, 2 },
+	}
+
+	for _, motion := range motions {
+		var moved bool
+		for tick := uint64(0); tick < 200; tick++ {
+			for glyphNum := 0; glyphNum < 40; glyphNum++ {
+				args := ptxt.TwineEffectArgs{ Payload: motion.payload, Tick: tick }
+				x, y := motion.fn(args, glyphNum)
+				x2, y2 := motion.fn(args, glyphNum)
+				if x != x2 || y != y2 {
+					t.Fatalf("%s: expected deterministic offsets", motion.name)
+				}
+				if abs(x) > motion.maxOffset || abs(y) > motion.maxOffset {
+					t.Fatalf("%s: offsets (%d, %d) exceeding max %d", motion.name, x, y, motion.maxOffset)
+				}
+				if x != 0 || y != 0 { moved = true }
+			}
+		}
+		if !moved { t.Fatalf("%s: expected some motion", motion.name) }
+	}
+
+	// zero payload values must not panic
+	_, _ = Wave(ptxt.TwineEffectArgs{ Payload: WavePayload(1, 0, 0) }, 3)
+	_, _ = Jump(ptxt.TwineEffectArgs{ Payload: JumpPayload(1, 0, 0, 0) }, 3)
+	_, _ = Bounce(ptxt.TwineEffectArgs{ Payload: BouncePayload(1, 0, 0) }, 3)
+}
+
+func abs(x int) int {
+	if x < 0 { return -x }
+	return x
+}
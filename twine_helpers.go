@@ -1,35 +1,87 @@
 package ptxt
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
-// Related to [RendererTwine.RegisterFunc]().
+import "image"
+import "image/color"
+import "strconv"
+
+import "github.com/tinne26/ptxt/core"
+
+// Arguments passed to the functions registered through
+// [RendererTwine.RegisterFunc]().
 type TwineEffectArgs struct {
 	Renderer *Renderer
-	Payload []byte
-	OX, OY int
-	StartIndex int
-	EndIndex int
+	Payload []byte // the payload given when pushing the function. Don't modify it
+	Tick uint64 // see [RendererTwine.SetTick]()
+	OX, OY int // glyph origin for motions and color changers, segment baseline start for gfx effects
+	StartIndex int // for gfx effects, index of the first glyph of the segment within the span
+	EndIndex int // for gfx effects, index of the glyph after the segment within the span
 	MinWidth int
 	StartWrap bool // whether the effect is re-starting after a line break
 	EndWrap bool // whether the effect splits at a line break
-	// DrawPass (not really, I still have to figure out the model,
-	//           sometimes we only apply the func at measure time?
-	//           Maybe I can tell based on the func type if it's
-	//           only measuring, only drawing, or both)
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
-// ...
+// Panics if the payload length doesn't match the given number of
+// bytes. Useful to validate payloads in twine functions.
 func (self *TwineEffectArgs) AssertPayloadLen(numBytes int) {
-	panic("unimplemented")
+	if len(self.Payload) != numBytes {
+		panic("expected twine function payload of " + strconv.Itoa(numBytes) + " bytes, got " + strconv.Itoa(len(self.Payload)))
+	}
 }
 
-// NOTICE: TWINES ARE UNIMPLEMENTED
-// 
+// Signature for motion functions, used with [Twine.PushMotion]().
+// The function is called for each glyph drawn while the motion is
+// active, receiving the number of glyphs drawn since the motion was
+// pushed (starting at 0), and must return the offsets to apply to
+// the glyph. Offsets are automatically multiplied by the current
+// renderer scale.
+//
+// Motion functions are called once per glyph on each draw pass
+// (see [DrawPass]), so they should return the same values when given
+// the same arguments. Several active motions add up.
+type TwineMotionFunc = func(args TwineEffectArgs, glyphNum int) (x, y int)
+
+// Signature for color changing functions, used with [Twine.PushColorChanger]().
+// The function is called for each glyph drawn in the [MainDrawPass] while
+// the changer is active, receiving the number of glyphs drawn since the
+// changer was pushed (starting at 0) and the color the glyph would have
+// otherwise, and must return the color to use for the glyph. Shadows and
+// other draw passes are not affected.
+//
+// If several color changers are active, they are chained in the order
+// they were pushed, each one receiving the color returned by the previous.
+type TwineColorChangerFunc = func(args TwineEffectArgs, glyphNum int, textColor color.RGBA) color.RGBA
+
+// Signature for graphics functions, used with [Twine.PushGfxFront]() and
+// [Twine.PushGfxBack](). The function is called once per line for the
+// span of text affected by the effect, with a rect that covers the
+// span segment horizontally and the ascent and descent of the strand
+// and scale active at the point where the effect was pushed vertically.
+// If the span breaks across lines, [TwineEffectArgs] StartWrap and
+// EndWrap will indicate it.
+//
+// While the function is being called, the renderer's strand and scale
+// are also set to the ones active when the effect was pushed. Lines
+// without any glyphs in the span are skipped.
+//
+// Graphics functions are only invoked for the [Horizontal] and
+// [RightToLeft] directions. See [RendererTwine] for bidi limitations.
+type TwineGfxFunc = func(target core.Target, args TwineEffectArgs, rect image.Rectangle)
+
 // Related to [Twine.PushPadder](). Most of the time, you
 // create padders directly with TwinePadder{ PrePad: 16 } or
 // similar, defining only the required fields.
+//
+// Padders reserve horizontal space around a block of text, which
+// can be empty. A common use-case is leaving space for inline icons,
+// which can be drawn through a [TwineGfxFunc] pushed right before
+// the padder:
+//   twine.PushGfxFront(iconFuncID).PushPadder(ptxt.TwinePadder{ MinWidth: 9 }).Pop().Pop()
+// If the block breaks across lines, LineBreakPad is added at the end
+// of the line and LineStartPad at the start of the next, while MinWidth
+// is applied only to the last segment.
+//
+// Unless UnitsScaled is set, all units are multiplied by the scale
+// active when the padder is pushed.
 type TwinePadder struct {
 	PrePad       uint16 // padding before the block
 	PostPad      uint16 // padding after the block
@@ -0,0 +1,361 @@
+package ptxt
+
+import "image/color"
+
+import "github.com/tinne26/ptxt/internal"
+
+import "github.com/tinne26/ggfnt"
+
+// Helper type to process twine directives while mapping, measuring
+// and drawing. The operator keeps a stack with the push directives
+// that are still active, and applies strand and scale changes directly
+// to the renderer, so the rest of the code can keep using Renderer.Strand()
+// and Renderer.scale as usual. The original renderer values are restored
+// on twineOperator.End().
+//
+// Setting changes are only applied to the strands when the operator
+// is started with twineOperator.BeginMapping(), as settings only
+// affect glyph mapping. Their original values are also restored on
+// pops and twineOperator.End().
+type twineOperator struct {
+	renderer *Renderer
+	contents []byte
+	mapping bool // whether setting changes have to be applied
+	stack []twineStackEntry
+	popped []twineStackEntry // entries popped on the last Apply(), in stack order
+	state twineOperatorState
+	baseState twineOperatorState
+
+	// memorized state for line wrapping rewinds
+	memoStack []twineStackEntry
+	memoState twineOperatorState
+}
+
+type twineOperatorState struct {
+	strandIndex StrandIndex
+	scale uint8
+	colorActive bool
+	color color.RGBA
+}
+
+type twineStackEntry struct {
+	controlCode byte
+	offset uint16 // offset of the directive within the twine contents
+	glyphCount uint16 // glyphs drawn since the push, only used for motions and color changers
+	x int // block segment start for padders, restart position for line restart markers
+	prevSetting uint8 // previous setting value for setting changes
+	prevState twineOperatorState
+}
+
+// Flags returned by twineOperator.Apply() to notify changes.
+const (
+	twineStrandChange       uint8 = 0b0001
+	twineScaleChange        uint8 = 0b0010
+	twineColorChange        uint8 = 0b0100
+	twineLineMetricsRefresh uint8 = 0b1000
+	twinePadderPush         uint8 = 0b0001_0000
+	twinePadderPop          uint8 = 0b0010_0000
+	twineLineRestartMarker  uint8 = 0b0100_0000
+)
+
+func (self *twineOperator) Begin(renderer *Renderer, contents []byte) {
+	self.renderer = renderer
+	self.contents = contents
+	self.mapping = false
+	self.stack = self.stack[ : 0]
+	self.state = twineOperatorState{ strandIndex: renderer.strandIndex, scale: renderer.scale }
+	self.baseState = self.state
+}
+
+// Like twineOperator.Begin(), but also applying setting changes.
+func (self *twineOperator) BeginMapping(renderer *Renderer, contents []byte) {
+	self.Begin(renderer, contents)
+	self.mapping = true
+}
+
+// Restores the original renderer strand and scale, and any setting
+// changes still active.
+func (self *twineOperator) End() {
+	if self.mapping {
+		for i := len(self.stack) - 1; i >= 0; i-- {
+			self.restoreSetting(&self.stack[i])
+		}
+	}
+	_ = self.setState(self.baseState)
+	self.renderer = nil
+	self.contents = nil
+}
+
+// Applies the directive at the given offset of the twine contents
+// and returns the relevant change flags.
+func (self *twineOperator) Apply(offset int) uint8 {
+	newState := self.state
+	self.popped = self.popped[ : 0]
+	switch self.contents[offset + 1] {
+	case twineCcLineMetricsRefresh:
+		return twineLineMetricsRefresh
+	case twineCcPop:
+		if len(self.stack) == 0 { return 0 } // unmatched pops are ignored
+		newState = self.stack[len(self.stack) - 1].prevState
+		self.popped = append(self.popped, self.stack[len(self.stack) - 1])
+		self.stack = self.stack[ : len(self.stack) - 1]
+	case twineCcPopAll:
+		if len(self.stack) == 0 { return 0 }
+		newState = self.stack[0].prevState
+		self.popped = append(self.popped, self.stack...)
+		self.stack = self.stack[ : 0]
+	case twineCcStop:
+		// motions don't modify the operator state, so we can
+		// remove the entry without any further adjustments
+		for i := len(self.stack) - 1; i >= 0; i-- {
+			if self.stack[i].controlCode != twineCcPushMotion { continue }
+			self.stack = append(self.stack[ : i], self.stack[i + 1 : ]...)
+			break
+		}
+		return 0
+	case twineCcPushColor:
+		self.push(offset)
+		newState.colorActive = true
+		newState.color = color.RGBA{
+			self.contents[offset + 2], self.contents[offset + 3],
+			self.contents[offset + 4], self.contents[offset + 5],
+		}
+	case twineCcPushStrand:
+		index := StrandIndex(self.contents[offset + 2])
+		if int(index) >= len(self.renderer.strands) || self.renderer.strands[index] == nil {
+			panic("twine pushing a strand index not present on the renderer")
+		}
+		self.push(offset)
+		newState.strandIndex = index
+	case twineCcPushScale:
+		self.push(offset)
+		newState.scale = self.contents[offset + 2]
+	case twineCcPushScaleShift:
+		self.push(offset)
+		shift := int(int8(self.contents[offset + 2]))
+		newState.scale = uint8(clamp(int(newState.scale) + shift, 1, 255))
+	case twineCcPushSettingChange:
+		self.push(offset)
+		if !self.mapping { return 0 }
+		fontStrand := self.renderer.Strand()
+		key := ggfnt.SettingKey(self.contents[offset + 2])
+		if int(key) >= int(fontStrand.Font().Settings().Count()) {
+			panic("twine setting change using a setting key not present on the active strand's font")
+		}
+		self.stack[len(self.stack) - 1].prevSetting = fontStrand.GetSetting(key)
+		fontStrand.SetSetting(key, self.contents[offset + 3])
+		return 0
+	case twineCcPushPadder:
+		self.push(offset)
+		return twinePadderPush
+	case twineCcPushLineRestartMarker:
+		self.push(offset)
+		return twineLineRestartMarker
+	default: // other push directives, no operator state changes
+		self.push(offset)
+		return 0
+	}
+
+	if self.mapping {
+		for i := len(self.popped) - 1; i >= 0; i-- { // innermost first
+			self.restoreSetting(&self.popped[i])
+		}
+	}
+	changes := self.setState(newState)
+	for i, _ := range self.popped {
+		if self.popped[i].controlCode == twineCcPushPadder { return changes | twinePadderPop }
+	}
+	return changes
+}
+
+func (self *twineOperator) push(offset int) {
+	if len(self.stack) >= 65535 { panic("too many active twine push directives") }
+	self.stack = append(self.stack, twineStackEntry{
+		controlCode: self.contents[offset + 1],
+		offset: uint16(offset),
+		prevState: self.state,
+	})
+}
+
+func (self *twineOperator) setState(state twineOperatorState) uint8 {
+	var changes uint8
+	if state.strandIndex != self.state.strandIndex { changes |= twineStrandChange }
+	if state.scale != self.state.scale { changes |= twineScaleChange }
+	if state.colorActive != self.state.colorActive || state.color != self.state.color {
+		changes |= twineColorChange
+	}
+	self.state = state
+	self.renderer.strandIndex = state.strandIndex
+	self.renderer.scale = state.scale
+	return changes
+}
+
+// Memorizes the current state so it can be restored later with
+// twineOperator.RestoreState(). Used for line wrapping, as wrapping
+// may force us to go back to a previous point in the text.
+func (self *twineOperator) MemorizeState() {
+	self.memoStack = append(self.memoStack[ : 0], self.stack...)
+	self.memoState = self.state
+}
+
+// Restores the last memorized state and returns the change flags.
+func (self *twineOperator) RestoreState() uint8 {
+	if self.mapping { panic(brokenCode) } // setting changes can't be rewinded
+	self.stack = append(self.stack[ : 0], self.memoStack...)
+	return self.setState(self.memoState)
+}
+
+// Returns the accumulated offsets of all the active motions for the
+// next glyph, already scaled, and increases the motions' glyph counts.
+// The given glyph origin is passed to the motion functions.
+func (self *twineOperator) MotionOffsets(x, y int) (int, int) {
+	var offsetX, offsetY int
+	for i, _ := range self.stack {
+		if self.stack[i].controlCode != twineCcPushMotion { continue }
+		
+		offset := int(self.stack[i].offset)
+		motionFn, isMotion := self.renderer.getTwineFunc(self.contents[offset + 2]).(TwineMotionFunc)
+		if !isMotion { panic("twine motion using an unregistered or non-motion function ID") }
+		args := self.effectArgs(offset)
+		args.OX, args.OY = x, y
+		mx, my := motionFn(args, int(self.stack[i].glyphCount))
+		offsetX += mx
+		offsetY += my
+		if self.stack[i].glyphCount < 65535 { self.stack[i].glyphCount += 1 }
+	}
+	scale := int(self.state.scale)
+	return offsetX*scale, offsetY*scale
+}
+
+// Returns the draw parameters with the colors of all the active
+// color changers applied, and increases the changers' glyph counts.
+// Only the main draw pass is affected. The given glyph origin is
+// passed to the color changer functions.
+func (self *twineOperator) ChangeColor(pass DrawPass, x, y int, params MaskDrawParameters) MaskDrawParameters {
+	if pass != MainDrawPass { return params }
+	for i, _ := range self.stack {
+		if self.stack[i].controlCode != twineCcPushColorChanger { continue }
+		
+		offset := int(self.stack[i].offset)
+		changerFn, isChanger := self.renderer.getTwineFunc(self.contents[offset + 2]).(TwineColorChangerFunc)
+		if !isChanger { panic("twine color changer using an unregistered or non-color-changer function ID") }
+		args := self.effectArgs(offset)
+		args.OX, args.OY = x, y
+		textColor := changerFn(args, int(self.stack[i].glyphCount), internal.Float32ToRGBA(params.RGBA))
+		params.RGBA = internal.RGBAToFloat32(textColor)
+		if self.stack[i].glyphCount < 65535 { self.stack[i].glyphCount += 1 }
+	}
+	return params
+}
+
+// Returns the reveal delay of the most recent reveal delay directive
+// still active, if any.
+func (self *twineOperator) RevealDelay() (uint8, bool) {
+	for i := len(self.stack) - 1; i >= 0; i-- {
+		if self.stack[i].controlCode != twineCcPushRevealDelay { continue }
+		return self.contents[int(self.stack[i].offset) + 2], true
+	}
+	return 0, false
+}
+
+// Returns the base effect arguments for the function directive
+// at the given offset.
+func (self *twineOperator) effectArgs(offset int) TwineEffectArgs {
+	payloadLen := int(self.contents[offset + 3])
+	return TwineEffectArgs{
+		Renderer: self.renderer,
+		Payload: self.contents[offset + 4 : offset + 4 + payloadLen : offset + 4 + payloadLen],
+		Tick: self.renderer.twineTick,
+	}
+}
+
+// Restores the previous setting value if the entry is a setting change.
+func (self *twineOperator) restoreSetting(entry *twineStackEntry) {
+	if entry.controlCode != twineCcPushSettingChange { return }
+	key := ggfnt.SettingKey(self.contents[int(entry.offset) + 2])
+	fontStrand := self.renderer.strands[entry.prevState.strandIndex]
+	if fontStrand.GetSetting(key) != entry.prevSetting {
+		fontStrand.SetSetting(key, entry.prevSetting)
+	}
+}
+
+// Returns the padding to apply after the last Apply() call for the
+// padders and line restart markers, given the current x position.
+// Padders and restart markers are also updated with the relevant
+// block segment starts and restart positions.
+func (self *twineOperator) ApplyPadding(changes uint8, x int) int {
+	var padding int
+	if changes & twinePadderPop != 0 {
+		for i := len(self.popped) - 1; i >= 0; i-- { // innermost first
+			if self.popped[i].controlCode != twineCcPushPadder { continue }
+			padder, scale := self.padderAt(&self.popped[i])
+			minRight := self.popped[i].x + int(padder.MinWidth)*scale
+			padding = max(padding, minRight - x)
+			padding += int(padder.PostPad)*scale
+		}
+	}
+	if changes & twinePadderPush != 0 {
+		entry := &self.stack[len(self.stack) - 1]
+		entry.x = x
+		padder, scale := self.padderAt(entry)
+		padding += int(padder.PrePad)*scale
+	}
+	if changes & twineLineRestartMarker != 0 {
+		self.stack[len(self.stack) - 1].x = x
+	}
+	return padding
+}
+
+// Returns the x position where new lines have to start, based on
+// the active line restart markers and padders. Padders are also
+// updated to start their block segments on the new line.
+func (self *twineOperator) LineStart() int {
+	var x int
+	for i, _ := range self.stack {
+		switch self.stack[i].controlCode {
+		case twineCcPushLineRestartMarker:
+			x = self.stack[i].x
+		case twineCcPushPadder:
+			self.stack[i].x = x
+			padder, scale := self.padderAt(&self.stack[i])
+			x += int(padder.LineStartPad)*scale
+		}
+	}
+	return x
+}
+
+// Returns the padding to add at the end of a line when a line break
+// happens with padders active.
+func (self *twineOperator) LineBreakPad() int {
+	var padding int
+	for i, _ := range self.stack {
+		if self.stack[i].controlCode != twineCcPushPadder { continue }
+		padder, scale := self.padderAt(&self.stack[i])
+		padding += int(padder.LineBreakPad)*scale
+	}
+	return padding
+}
+
+// Returns the padder for the given stack entry and the scaling
+// factor to apply to its units.
+func (self *twineOperator) padderAt(entry *twineStackEntry) (TwinePadder, int) {
+	data := self.contents[int(entry.offset) + 2 : ]
+	padder := TwinePadder{
+		PrePad:       uint16(data[0]) | uint16(data[1]) << 8,
+		PostPad:      uint16(data[2]) | uint16(data[3]) << 8,
+		MinWidth:     uint16(data[4]) | uint16(data[5]) << 8,
+		LineStartPad: uint16(data[6]) | uint16(data[7]) << 8,
+		LineBreakPad: uint16(data[8]) | uint16(data[9]) << 8,
+		UnitsScaled:  data[10] & twinePadderUnitsScaledFlag != 0,
+	}
+	if padder.UnitsScaled { return padder, 1 }
+	return padder, int(entry.prevState.scale)
+}
+
+// Returns the main draw color for the current state.
+func (self *twineOperator) MainColor() [4]float32 {
+	if self.state.colorActive {
+		return internal.RGBAToFloat32(self.state.color)
+	}
+	return self.renderer.strandMainColor(self.renderer.Strand())
+}
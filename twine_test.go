@@ -0,0 +1,70 @@
+package ptxt
+
+import "testing"
+import "image/color"
+
+import "github.com/tinne26/ggfnt"
+
+func TestTwineEncoding(t *testing.T) {
+	rgba := color.RGBA{80, 200, 120, 255}
+	woven := Weave("NICE ", rgba, "EMERALD", Pop, '!', ggfnt.GlyphIndex(7), StrandIndex(1), PopAll)
+
+	var manual Twine
+	manual.Add("NICE ").PushColor(rgba).Add("EMERALD").Pop().AddRunes('!')
+	manual.AddGlyphs(7).PushStrand(1).PopAll()
+	if !equalSlices(woven.contents, manual.contents) {
+		t.Fatalf("expected woven and manual twines to match\n%v\n%v", woven.contents, manual.contents)
+	}
+
+	// appending through Weave
+	appended := Weave(woven, "MORE")
+	if string(appended.contents[len(appended.contents) - 4 : ]) != "MORE" {
+		t.Fatal("expected Weave to append to the given twine")
+	}
+
+	// appending must not share the given twine's spare capacity
+	var base Twine
+	base.contents = make([]byte, 0, 16)
+	base.Add("ab")
+	x, y := Weave(base, "X"), Weave(base, "Y")
+	if string(x.contents) != "abX" || string(y.contents) != "abY" || string(base.contents) != "ab" {
+		t.Fatalf("expected \"ab\", \"abX\" and \"abY\", got %q, %q and %q", base.contents, x.contents, y.contents)
+	}
+	z := Weave(&base, "Z")
+	if string(base.contents) != "abZ" || string(z.contents) != "abZ" {
+		t.Fatalf("expected Weave to append to *Twine in place, got %q and %q", base.contents, z.contents)
+	}
+
+	// walk the contents and count control sequences
+	var numControlSequences, numTextBytes int
+	for offset := 0; offset < len(manual.contents); {
+		if manual.contents[offset] == twineCcBegin {
+			numControlSequences += 1
+			offset += twineCcLen(manual.contents, offset)
+		} else {
+			numTextBytes += 1
+			offset += 1
+		}
+	}
+	if numControlSequences != 5 {
+		t.Fatalf("expected 5 control sequences, got %d", numControlSequences)
+	}
+	if numTextBytes != len("NICE EMERALD!") {
+		t.Fatalf("expected %d text bytes, got %d", len("NICE EMERALD!"), numTextBytes)
+	}
+
+	// payloads and resets
+	var twine Twine
+	twine.PushMotion(3, 1, 2, 3).Add("X").Stop()
+	if twineCcLen(twine.contents, 0) != 7 {
+		t.Fatalf("expected motion control sequence length 7, got %d", twineCcLen(twine.contents, 0))
+	}
+	twine.Reset()
+	if !twine.IsEmpty() { t.Fatal("expected empty twine after reset") }
+
+	// invalid utf8 must panic
+	defer func() {
+		if recover() == nil { t.Fatal("expected invalid utf8 to panic") }
+	}()
+	twine.Add(string([]byte{'A', 0xFF, 'B'}))
+}
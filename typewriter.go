@@ -0,0 +1,139 @@
+package ptxt
+
+import "github.com/tinne26/ptxt/internal"
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+
+// Helper type to reveal text progressively, glyph by glyph, as in
+// dialogues and typewriter effects. Usage example:
+//   // on dialogue start
+//   renderer.Twine().MeasureWithWrap(text, maxLineLen)
+//   typewriter.Load(renderer)
+//   // on update (once per tick)
+//   typewriter.Update()
+//   // on draw
+//   typewriter.DrawFromBuffer(renderer, target, x, y)
+// The layout is only computed once, and the text doesn't shift or
+// rewrap while being revealed. If the renderer is used for other text
+// between draws, use [Typewriter.Draw]() or [Typewriter.DrawTwine]()
+// instead.
+//
+// Reveal delays can be adjusted for specific fragments of a twine
+// through [Twine.PushRevealDelay]().
+type Typewriter struct {
+	delays []uint8 // reveal delay for each glyph, in ticks
+	glyphs []ggfnt.GlyphIndex
+	revealed int
+	elapsed int // ticks since the last reveal
+	delay uint8 // default delay
+	revealListener func(glyphNum int, glyphIndex ggfnt.GlyphIndex)
+}
+
+// Creates a new [Typewriter] that reveals a glyph every ticksPerGlyph
+// ticks by default. A zero delay reveals all glyphs at once.
+func NewTypewriter(ticksPerGlyph uint8) *Typewriter {
+	return &Typewriter{ delay: ticksPerGlyph }
+}
+
+// Sets a function to be invoked each time a glyph is revealed on
+// [Typewriter.Update](). Typically used to play typing sounds.
+// The glyph number is the index of the glyph among the visible
+// glyphs of the text, starting at zero.
+func (self *Typewriter) SetRevealListener(fn func(glyphNum int, glyphIndex ggfnt.GlyphIndex)) {
+	self.revealListener = fn
+}
+
+// Loads the glyphs from the renderer's last measuring or drawing
+// operation and resets the reveal progress. Line breaks and other
+// control glyphs are not counted.
+func (self *Typewriter) Load(renderer *Renderer) {
+	self.delays = self.delays[ : 0]
+	self.glyphs = self.glyphs[ : 0]
+	self.revealed = 0
+	self.elapsed = 0
+
+	twining := (renderer.run.twineContents != nil)
+	if twining { renderer.twineOperator.Begin(renderer, renderer.run.twineContents) }
+	for index := 0; index < len(renderer.run.glyphIndices); index++ {
+		glyphIndex := renderer.run.glyphIndices[index]
+		if isDrawableGlyph(glyphIndex) {
+			delay := self.delay
+			if twining {
+				twineDelay, found := renderer.twineOperator.RevealDelay()
+				if found { delay = twineDelay }
+			}
+			self.delays = append(self.delays, delay)
+			self.glyphs = append(self.glyphs, glyphIndex)
+		} else if glyphIndex == internal.TwineEffectMarkerGlyph {
+			index += 1 // skip directive offset
+			_ = renderer.twineOperator.Apply(int(renderer.run.glyphIndices[index]))
+		} else if glyphIndex == internal.FallbackGlyph {
+			index += 1 // skip fallback index
+		}
+	}
+	if twining { renderer.twineOperator.End() }
+}
+
+// Advances the typewriter by one tick, revealing glyphs as required.
+func (self *Typewriter) Update() {
+	if self.IsDone() { return }
+	self.elapsed += 1
+	for self.revealed < len(self.delays) && self.elapsed >= int(self.delays[self.revealed]) {
+		self.elapsed -= int(self.delays[self.revealed])
+		if self.revealListener != nil {
+			self.revealListener(self.revealed, self.glyphs[self.revealed])
+		}
+		self.revealed += 1
+	}
+	if self.IsDone() { self.elapsed = 0 }
+}
+
+// Reveals all the remaining glyphs at once. The reveal listener
+// is not invoked.
+func (self *Typewriter) Skip() {
+	self.revealed = len(self.delays)
+	self.elapsed = 0
+}
+
+// Returns whether all the glyphs have been revealed.
+func (self *Typewriter) IsDone() bool {
+	return self.revealed >= len(self.delays)
+}
+
+// Returns the number of glyphs revealed so far.
+func (self *Typewriter) Revealed() int {
+	return self.revealed
+}
+
+// Returns the total number of glyphs to reveal.
+func (self *Typewriter) NumGlyphs() int {
+	return len(self.delays)
+}
+
+// Draws the renderer's last measured or drawn text with
+// [RendererAdvanced.DrawFromBuffer](), limited to the glyphs
+// revealed so far.
+func (self *Typewriter) DrawFromBuffer(renderer *Renderer, target core.Target, x, y int) {
+	prevLimit := renderer.revealLimit
+	renderer.revealLimit = self.revealed
+	renderer.drawFromBuffer(target, x, y)
+	renderer.revealLimit = prevLimit
+}
+
+// Draws the given text with [Renderer.DrawWithWrap](), limited to the
+// glyphs revealed so far. The text must be the same that was loaded.
+func (self *Typewriter) Draw(renderer *Renderer, target core.Target, text string, x, y int, maxLineLen int) {
+	prevLimit := renderer.revealLimit
+	renderer.revealLimit = self.revealed
+	renderer.DrawWithWrap(target, text, x, y, maxLineLen)
+	renderer.revealLimit = prevLimit
+}
+
+// Twine version of [Typewriter.Draw]().
+func (self *Typewriter) DrawTwine(renderer *Renderer, target core.Target, twine Twine, x, y int, maxLineLen int) {
+	prevLimit := renderer.revealLimit
+	renderer.revealLimit = self.revealed
+	renderer.Twine().DrawWithWrap(target, twine, x, y, maxLineLen)
+	renderer.revealLimit = prevLimit
+}
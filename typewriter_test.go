@@ -0,0 +1,69 @@
+package ptxt
+
+import "testing"
+
+import "github.com/tinne26/ptxt/core"
+
+import "github.com/tinne26/ggfnt"
+
+func TestTypewriter(t *testing.T) {
+	ensureTestAssetsLoaded()
+	if testFont == nil { t.SkipNow() }
+
+	// create strand and renderer
+	strand, _ := NewStrand(testFont)
+	renderer := NewRenderer()
+	renderer.SetStrand(strand)
+
+	var drawnXs []int
+	renderer.Advanced().SetDrawFunc(
+		func(target core.Target, glyphIndex ggfnt.GlyphIndex, params MaskDrawParameters) {
+			drawnXs = append(drawnXs, params.X)
+		},
+	)
+
+	// reveal limits must not affect layout
+	renderer.SetAlign(Center)
+	renderer.Draw(nil, "AB\nCD", 0, 0)
+	fullXs := append([]int(nil), drawnXs...)
+	renderer.Advanced().SetRevealLimit(3)
+	drawnXs = drawnXs[ : 0]
+	renderer.Advanced().DrawFromBuffer(nil, 0, 0)
+	if len(drawnXs) != 3 || drawnXs[2] != fullXs[2] {
+		t.Fatalf("expected 3 glyphs drawn at the full layout positions %v, got %v", fullXs, drawnXs)
+	}
+	renderer.Advanced().SetRevealLimit(-1)
+
+	// typewriter with reveal delays
+	var twine Twine
+	twine.Add("AB").PushRevealDelay(4).Add("C").Pop().PushRevealDelay(0).Add("DE").Pop()
+	renderer.Twine().Measure(twine)
+	typewriter := NewTypewriter(2)
+	var revealed []int
+	typewriter.SetRevealListener(func(glyphNum int, _ ggfnt.GlyphIndex) {
+		revealed = append(revealed, glyphNum)
+	})
+	typewriter.Load(renderer)
+	if typewriter.NumGlyphs() != 5 {
+		t.Fatalf("expected 5 glyphs, got %d", typewriter.NumGlyphs())
+	}
+	expected := []int{ 0, 1, 1, 2, 2, 2, 2, 5 } // revealed count after each tick
+	for tick, count := range expected {
+		typewriter.Update()
+		if typewriter.Revealed() != count {
+			t.Fatalf("tick %d: expected %d revealed glyphs, got %d", tick, count, typewriter.Revealed())
+		}
+	}
+	if !typewriter.IsDone() || len(revealed) != 5 || revealed[4] != 4 {
+		t.Fatalf("unexpected reveal notifications %v", revealed)
+	}
+
+	// drawing
+	drawnXs = drawnXs[ : 0]
+	typewriter.Load(renderer)
+	for i := 0; i < 4; i++ { typewriter.Update() }
+	typewriter.DrawFromBuffer(renderer, nil, 0, 0)
+	if len(drawnXs) != 2 || renderer.Advanced().GetRevealLimit() != -1 {
+		t.Fatalf("expected 2 glyphs drawn, got %d", len(drawnXs))
+	}
+}